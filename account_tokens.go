@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mail"
+	"github.com/google/uuid"
+)
+
+const (
+	emailVerificationTTL = 48 * time.Hour
+	passwordResetTTL     = time.Hour
+	// maxAccountTokensPerHour limits how many mails of one kind a user can be
+	// sent, so the endpoints that send them can't be used to flood an inbox.
+	maxAccountTokensPerHour = 3
+	mailSendTimeout         = 30 * time.Second
+)
+
+var errTooManyAccountTokens = errors.New("too many emails sent recently; try again later")
+
+// issueAccountToken creates a token for purpose and returns it, to be
+// mailed as a link. Only its hash is stored.
+func (cfg *apiConfig) issueAccountToken(ctx context.Context, userID uuid.UUID, purpose database.AccountTokenPurpose, ttl time.Duration) (string, error) {
+	recent, err := cfg.db.CountAccountTokens(ctx, userID, purpose, time.Now().Add(-time.Hour))
+	if err != nil {
+		return "", err
+	}
+	if recent >= maxAccountTokensPerHour {
+		return "", errTooManyAccountTokens
+	}
+
+	token, err := auth.MakeToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = cfg.db.CreateAccountToken(ctx, database.CreateAccountTokenParams{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// appLink returns a link into the web app that carries a token in the
+// query parameter param.
+func (cfg *apiConfig) appLink(param, token string) string {
+	return cfg.appBaseURL + "/app/?" + url.Values{param: {token}}.Encode()
+}
+
+// sendMail sends msg, logging rather than returning failures: the request
+// that sent it has done its work either way, and the user can ask again.
+func (cfg *apiConfig) sendMail(ctx context.Context, msg mail.Message) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mailSendTimeout)
+	defer cancel()
+	if err := cfg.mailer.Send(ctx, msg); err != nil {
+		log.Printf("Couldn't send %q to %s: %v", msg.Subject, msg.To, err)
+	}
+}
@@ -1,4 +1,7 @@
 document.addEventListener('DOMContentLoaded', async () => {
+  await handleEmailLink();
+  await handleOIDCRedirect();
+
   const token = localStorage.getItem('token');
 
   if (token) {
@@ -9,6 +12,7 @@ document.addEventListener('DOMContentLoaded', async () => {
     document.getElementById('auth-section').style.display = 'block';
     document.getElementById('video-section').style.display = 'none';
   }
+  await loadOIDCProviders();
 });
 
 document.getElementById('video-draft-form').addEventListener('submit', async (event) => {
@@ -26,11 +30,10 @@ async function createVideoDraft() {
   const description = document.getElementById('video-description').value;
 
   try {
-    const res = await fetch('/api/videos', {
+    const res = await authFetch('/api/videos', {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
       },
       body: JSON.stringify({ title, description }),
     });
@@ -67,10 +70,7 @@ async function login() {
     }
 
     if (data.token) {
-      localStorage.setItem('token', data.token);
-      document.getElementById('auth-section').style.display = 'none';
-      document.getElementById('video-section').style.display = 'block';
-      await getVideos();
+      await startSession(data);
     } else {
       alert('Login failed. Please check your credentials.');
     }
@@ -79,6 +79,146 @@ async function login() {
   }
 }
 
+async function startSession(data) {
+  localStorage.setItem('token', data.token);
+  localStorage.setItem('refresh_token', data.refresh_token);
+  document.getElementById('auth-section').style.display = 'none';
+  document.getElementById('video-section').style.display = 'block';
+  await getVideos();
+}
+
+// loadOIDCProviders adds a button for each provider users can log in with.
+async function loadOIDCProviders() {
+  const container = document.getElementById('oidc-providers');
+  try {
+    const res = await fetch('/api/oidc/providers');
+    if (!res.ok) {
+      return;
+    }
+    const providers = await res.json();
+    container.innerHTML = '';
+    for (const provider of providers) {
+      const button = document.createElement('button');
+      button.type = 'button';
+      button.textContent = `Log in with ${provider.name}`;
+      button.onclick = () => {
+        window.location.href = provider.login_url;
+      };
+      container.appendChild(button);
+    }
+  } catch (error) {
+    console.log(`Couldn't load login providers: ${error.message}`);
+  }
+}
+
+// handleOIDCRedirect finishes a login with a provider, which sends the
+// browser back here with a one-time code or an error.
+async function handleOIDCRedirect() {
+  const params = new URLSearchParams(window.location.search);
+  const code = params.get('oidc_code');
+  const loginError = params.get('oidc_error');
+  if (!code && !loginError) {
+    return;
+  }
+  window.history.replaceState(null, '', window.location.pathname);
+
+  try {
+    if (loginError) {
+      throw new Error(`Failed to login: ${loginError}`);
+    }
+    const res = await fetch('/api/oidc/token', {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ code }),
+    });
+    const data = await res.json();
+    if (!res.ok) {
+      throw new Error(`Failed to login: ${data.error}`);
+    }
+    localStorage.setItem('token', data.token);
+    localStorage.setItem('refresh_token', data.refresh_token);
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
+// handleEmailLink finishes what a link from a verification or password
+// reset email started, then drops the token from the address bar.
+async function handleEmailLink() {
+  const params = new URLSearchParams(window.location.search);
+  const verifyToken = params.get('verify_email');
+  const resetToken = params.get('reset_password');
+  if (!verifyToken && !resetToken) {
+    return;
+  }
+  window.history.replaceState(null, '', window.location.pathname);
+
+  try {
+    if (verifyToken) {
+      const res = await fetch('/api/verify_email', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ token: verifyToken }),
+      });
+      if (!res.ok) {
+        const data = await res.json();
+        throw new Error(`Failed to verify email: ${data.error}`);
+      }
+      alert('Email verified! You can now upload videos.');
+      return;
+    }
+
+    const password = prompt('Choose a new password');
+    if (!password) {
+      return;
+    }
+    const res = await fetch('/api/password_reset/confirm', {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ token: resetToken, password }),
+    });
+    if (!res.ok) {
+      const data = await res.json();
+      throw new Error(`Failed to reset password: ${data.error}`);
+    }
+    logout();
+    alert('Password changed. Log in with your new password.');
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
+async function forgotPassword() {
+  const email = document.getElementById('email').value;
+  if (!email) {
+    alert('Enter your email address first.');
+    return;
+  }
+
+  try {
+    const res = await fetch('/api/password_reset', {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ email }),
+    });
+    if (!res.ok) {
+      const data = await res.json();
+      throw new Error(`Failed to request password reset: ${data.error}`);
+    }
+    alert('If that email has an account, a reset link is on its way.');
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
 async function signup() {
   const email = document.getElementById('email').value;
   const password = document.getElementById('password').value;
@@ -95,7 +235,7 @@ async function signup() {
       const data = await res.json();
       throw new Error(`Failed to create user: ${data.error}`);
     }
-    console.log('User created!');
+    console.log('User created! Check your email to verify your address.');
     await login();
   } catch (error) {
     alert(`Error: ${error.message}`);
@@ -103,11 +243,73 @@ async function signup() {
 }
 
 function logout() {
+  const refreshToken = localStorage.getItem('refresh_token');
+  if (refreshToken) {
+    fetch('/api/revoke', {
+      method: 'POST',
+      headers: {
+        Authorization: `Bearer ${refreshToken}`,
+      },
+    });
+  }
   localStorage.removeItem('token');
+  localStorage.removeItem('refresh_token');
   document.getElementById('auth-section').style.display = 'block';
   document.getElementById('video-section').style.display = 'none';
 }
 
+// authFetch sends the access token. Access tokens are short-lived, so when
+// one is rejected it refreshes it once and retries.
+async function authFetch(url, options = {}) {
+  const send = () =>
+    fetch(url, {
+      ...options,
+      headers: {
+        ...options.headers,
+        Authorization: `Bearer ${localStorage.getItem('token')}`,
+      },
+    });
+
+  const res = await send();
+  const challenge = res.headers.get('WWW-Authenticate') || '';
+  if (res.status === 401 && challenge.includes('invalid_token') && (await refreshTokens())) {
+    return send();
+  }
+  return res;
+}
+
+let refreshing = null;
+
+// refreshTokens trades the refresh token for new tokens. Concurrent callers
+// share one refresh, since sending a refresh token twice revokes the session.
+function refreshTokens() {
+  if (!refreshing) {
+    refreshing = (async () => {
+      const refreshToken = localStorage.getItem('refresh_token');
+      if (!refreshToken) {
+        return false;
+      }
+      const res = await fetch('/api/refresh', {
+        method: 'POST',
+        headers: {
+          Authorization: `Bearer ${refreshToken}`,
+        },
+      });
+      if (!res.ok) {
+        logout();
+        return false;
+      }
+      const data = await res.json();
+      localStorage.setItem('token', data.token);
+      localStorage.setItem('refresh_token', data.refresh_token);
+      return true;
+    })().finally(() => {
+      refreshing = null;
+    });
+  }
+  return refreshing;
+}
+
 function setUploadButtonState(uploading, selector) {
   const uploadBtn = document.getElementById(selector);
   if (uploading) {
@@ -130,11 +332,8 @@ async function uploadThumbnail(videoID) {
   setUploadButtonState(true, uploadBtnSelector);
 
   try {
-    const res = await fetch(`/api/thumbnail_upload/${videoID}`, {
+    const res = await authFetch(`/api/thumbnail_upload/${videoID}`, {
       method: 'POST',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
       body: formData,
     });
     if (!res.ok) {
@@ -163,11 +362,8 @@ async function uploadVideoFile(videoID) {
   setUploadButtonState(true, uploadBtnSelector);
 
   try {
-    const res = await fetch(`/api/video_upload/${videoID}`, {
+    const res = await authFetch(`/api/video_upload/${videoID}`, {
       method: 'POST',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
       body: formData,
     });
     if (!res.ok) {
@@ -188,18 +384,24 @@ const videoStateHandler = createVideoStateHandler();
 
 async function getVideos() {
   try {
-    const res = await fetch('/api/videos', {
-      method: 'GET',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
-    });
-    if (!res.ok) {
+    const videos = [];
+    let cursor = null;
+    do {
+      const params = new URLSearchParams({ limit: '100' });
+      if (cursor) {
+        params.set('after', cursor);
+      }
+      const res = await authFetch(`/api/videos?${params}`, {
+        method: 'GET',
+      });
       const data = await res.json();
-      throw new Error(`Failed to get videos. Error: ${data.error}`);
-    }
+      if (!res.ok) {
+        throw new Error(`Failed to get videos. Error: ${data.error}`);
+      }
+      videos.push(...data.videos);
+      cursor = data.next_cursor;
+    } while (cursor);
 
-    const videos = await res.json();
     const videoList = document.getElementById('video-list');
     videoList.innerHTML = '';
     for (const video of videos) {
@@ -231,11 +433,8 @@ function createVideoStateHandler() {
 
 async function getVideo(videoID) {
   try {
-    const res = await fetch(`/api/videos/${videoID}`, {
+    const res = await authFetch(`/api/videos/${videoID}`, {
       method: 'GET',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
     });
     if (!res.ok) {
       throw new Error('Failed to get video.');
@@ -283,11 +482,8 @@ async function deleteVideo() {
   }
 
   try {
-    const res = await fetch(`/api/videos/${currentVideo.id}`, {
+    const res = await authFetch(`/api/videos/${currentVideo.id}`, {
       method: 'DELETE',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
     });
     if (!res.ok) {
       throw new Error('Failed to delete video.');
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// errVideoForbidden is returned by authorizeVideo when the caller may know
+// the video exists but lacks the role the action needs.
+var errVideoForbidden = errors.New("you don't have access to this video")
+
+// videoRole returns the role userID has on video: owner for the user who
+// created it, the granted role for collaborators, and "" for everyone else,
+// including anonymous callers (uuid.Nil).
+func (cfg *apiConfig) videoRole(ctx context.Context, video database.Video, userID uuid.UUID) (database.VideoRole, error) {
+	if userID == uuid.Nil {
+		return "", nil
+	}
+	if video.UserID == userID {
+		return database.VideoRoleOwner, nil
+	}
+	collaborator, err := cfg.db.GetVideoCollaborator(ctx, video.ID, userID)
+	if errors.Is(err, database.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return collaborator.Role, nil
+}
+
+// authorizeVideo loads a video and checks that userID may perform an action
+// needing the given role. It is the single place video access is decided.
+//
+// Unlisted and public videos can be viewed by anyone. Callers with no role
+// on a private video get database.ErrNotFound, so they can't tell it exists;
+// callers who can see the video but lack the role get errVideoForbidden.
+func (cfg *apiConfig) authorizeVideo(ctx context.Context, videoID, userID uuid.UUID, need database.VideoRole) (database.Video, database.VideoRole, error) {
+	video, err := cfg.db.GetVideo(ctx, videoID)
+	if err != nil {
+		return database.Video{}, "", err
+	}
+	role, err := cfg.videoRole(ctx, video, userID)
+	if err != nil {
+		return database.Video{}, "", err
+	}
+
+	if role.Includes(need) {
+		return video, role, nil
+	}
+	if role == "" && video.Visibility == database.VideoVisibilityPrivate {
+		return database.Video{}, "", database.ErrNotFound
+	}
+	if need == database.VideoRoleViewer {
+		return video, role, nil
+	}
+	return database.Video{}, "", errVideoForbidden
+}
+
+// authorizeErrorStatus maps an authorizeVideo error to an HTTP status code.
+func authorizeErrorStatus(err error) int {
+	if errors.Is(err, errVideoForbidden) {
+		return http.StatusForbidden
+	}
+	return storeErrorStatus(err)
+}
@@ -0,0 +1,127 @@
+// Command jwtkey manages the Ed25519 keys access tokens are signed with.
+//
+// Usage:
+//
+//	jwtkey [-dir path] new [id]     generate a private key (id defaults to today's date)
+//	jwtkey [-dir path] retire <id>  replace a private key with its public key
+//
+// The key directory defaults to JWT_KEYS_DIR from the environment or .env
+// file. See "Rotating signing keys" in the README for how to use them.
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	_ = godotenv.Load(".env")
+
+	dir := flag.String("dir", os.Getenv("JWT_KEYS_DIR"), "directory holding the keys")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-dir path] new [id] | retire <id>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *dir == "" {
+		log.Fatal("No key directory given: set JWT_KEYS_DIR or pass -dir")
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	args := flag.Args()
+	switch args[0] {
+	case "new":
+		kid := time.Now().UTC().Format("2006-01-02")
+		if len(args) > 1 {
+			kid = args[1]
+		}
+		err = newKey(*dir, kid)
+	case "retire":
+		if len(args) != 2 {
+			log.Fatal("usage: jwtkey retire <id>")
+		}
+		err = retireKey(*dir, args[1])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func newKey(dir, kid string) error {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	data, err := auth.EncodePrivateKeyPEM(private)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, kid+".pem")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("key %s already exists", kid)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Printf("Wrote key %s to %s", kid, path)
+	return nil
+}
+
+// retireKey keeps a key's public half, so tokens it signed stay valid until
+// they expire, but it can't sign new ones.
+func retireKey(dir, kid string) error {
+	path := filepath.Join(dir, kid+".pem")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	private, public, err := auth.ParseKeyPEM(data)
+	if err != nil {
+		return err
+	}
+	if private == nil {
+		return fmt.Errorf("key %s is already retired", kid)
+	}
+	data, err = auth.EncodePublicKeyPEM(public)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	log.Printf("Retired key %s; delete %s once tokens it signed have expired", kid, path)
+	return nil
+}
@@ -0,0 +1,106 @@
+// Command migrate inspects and changes the schema version of the Tubely database.
+//
+// Usage:
+//
+//	migrate [-db path] up            apply every pending migration
+//	migrate [-db path] to <version>  migrate up or down to an exact version
+//	migrate [-db path] down [steps]  roll back the last N migrations (default 1)
+//	migrate [-db path] status        list migrations and whether they are applied
+//
+// The database path defaults to DB_PATH from the environment or .env file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	_ = godotenv.Load(".env")
+
+	pathToDB := flag.String("db", os.Getenv("DB_PATH"), "path to the database")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-db path] up | to <version> | down [steps] | status\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *pathToDB == "" {
+		log.Fatal("No database given: set DB_PATH or pass -db")
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := database.Open(*pathToDB)
+	if err != nil {
+		log.Fatalf("Couldn't open database: %v", err)
+	}
+	defer db.Close()
+
+	args := flag.Args()
+	switch args[0] {
+	case "up":
+		err = db.MigrateUp()
+	case "to":
+		if len(args) != 2 {
+			log.Fatal("usage: migrate to <version>")
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			log.Fatalf("Invalid version %q: %v", args[1], convErr)
+		}
+		err = db.MigrateTo(version)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid step count %q", args[1])
+			}
+		}
+		err = db.Rollback(steps)
+	case "status":
+		err = printStatus(db)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+
+	if args[0] != "status" {
+		version, err := db.SchemaVersion()
+		if err != nil {
+			log.Fatalf("Couldn't read schema version: %v", err)
+		}
+		log.Printf("Schema is at version %d", version)
+	}
+}
+
+func printStatus(db database.Client) error {
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range statuses {
+		appliedAt := "pending"
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+	}
+	return w.Flush()
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 )
 
 // MustGetenv is a helper function to get environment variables and panic if they are not set
@@ -13,3 +14,25 @@ func MustGetenv(key string) string {
 	}
 	return value
 }
+
+// GetenvDefault returns the environment variable key, or fallback if it is not set
+func GetenvDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// GetenvDuration parses the environment variable key as a duration such as
+// "15m", returning fallback if it is not set and exiting if it is invalid
+func GetenvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Fatalf("Environment variable %s must be a positive duration such as 15m, got %q", key, value)
+	}
+	return d
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// apiKeyPrefix starts every API key, so leaked keys are easy to spot.
+	apiKeyPrefix = "tubely_"
+	// apiKeyDisplayLength is how much of a key is kept to identify it.
+	apiKeyDisplayLength = len(apiKeyPrefix) + 8
+	maxAPIKeyNameLength = 100
+	maxAPIKeysPerUser   = 20
+	// apiKeyUseResolution is how stale a key's last_used_at can get, so busy
+	// keys don't cost a write on every request.
+	apiKeyUseResolution = time.Minute
+)
+
+// createAPIKeyResponse is the only response that includes the key itself;
+// it can't be fetched again later.
+type createAPIKeyResponse struct {
+	database.APIKey
+	Key string `json:"key"`
+}
+
+// handlerAPIKeysCreate issues a key a machine client can send as
+// "Authorization: ApiKey <key>":
+//
+//	{ "name": "CI uploads", "scopes": ["videos:read", "videos:write"], "expires_at": "2027-01-01T00:00:00Z" }
+func (cfg *apiConfig) handlerAPIKeysCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	userID := auth.UserIDFromContext(r.Context())
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || len(params.Name) > maxAPIKeyNameLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("name must be 1-%d characters", maxAPIKeyNameLength), nil)
+		return
+	}
+	scopes, err := auth.ParseScopes(params.Scopes, auth.APIKeyScopes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if params.ExpiresAt != nil && !params.ExpiresAt.After(time.Now()) {
+		respondWithError(w, http.StatusBadRequest, "expires_at must be in the future", nil)
+		return
+	}
+
+	existing, err := cfg.db.GetAPIKeys(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get API keys", err)
+		return
+	}
+	if len(existing) >= maxAPIKeysPerUser {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("You can have at most %d API keys", maxAPIKeysPerUser), nil)
+		return
+	}
+
+	token, err := auth.MakeToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create API key", err)
+		return
+	}
+	key := apiKeyPrefix + token
+
+	apiKey, err := cfg.db.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		UserID:    userID,
+		Name:      params.Name,
+		Prefix:    key[:apiKeyDisplayLength],
+		KeyHash:   auth.HashToken(key),
+		Scopes:    auth.ScopeStrings(scopes),
+		ExpiresAt: params.ExpiresAt,
+	})
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't create API key", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, createAPIKeyResponse{APIKey: apiKey, Key: key})
+}
+
+func (cfg *apiConfig) handlerAPIKeysList(w http.ResponseWriter, r *http.Request) {
+	keys, err := cfg.db.GetAPIKeys(r.Context(), auth.UserIDFromContext(r.Context()))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get API keys", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, keys)
+}
+
+func (cfg *apiConfig) handlerAPIKeyDelete(w http.ResponseWriter, r *http.Request) {
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid API key ID", err)
+		return
+	}
+
+	if err := cfg.db.DeleteAPIKey(r.Context(), auth.UserIDFromContext(r.Context()), keyID); err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't delete API key", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resolveAPIKey is the auth.APIKeyResolver for keys issued by
+// handlerAPIKeysCreate.
+func (cfg *apiConfig) resolveAPIKey(ctx context.Context, key string) (auth.AccessClaims, error) {
+	apiKey, err := cfg.db.GetAPIKeyByHash(ctx, auth.HashToken(key))
+	if err != nil {
+		return auth.AccessClaims{}, err
+	}
+	now := time.Now()
+	if !apiKey.Active(now) {
+		return auth.AccessClaims{}, errors.New("API key expired")
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyUseResolution {
+		if err := cfg.db.RecordAPIKeyUse(ctx, apiKey.ID, now); err != nil {
+			log.Printf("Couldn't record use of API key %s: %v", apiKey.ID, err)
+		}
+	}
+
+	return auth.AccessClaims{
+		UserID:   apiKey.UserID,
+		APIKeyID: apiKey.ID,
+		Scopes:   auth.ScopesFromStrings(apiKey.Scopes),
+	}, nil
+}
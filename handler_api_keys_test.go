@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// createAPIKey issues an API key with scopes to the user token belongs to.
+func (api *testAPI) createAPIKey(t *testing.T, token string, scopes ...auth.Scope) createAPIKeyResponse {
+	t.Helper()
+	var key createAPIKeyResponse
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/api_keys", token, map[string]any{"name": "ci", "scopes": scopes}, &key)
+	return key
+}
+
+// expectChallenge fails unless res has the WWW-Authenticate challenge.
+func expectChallenge(t *testing.T, res *http.Response, challenge string) {
+	t.Helper()
+	if got := res.Header.Get("WWW-Authenticate"); got != challenge {
+		t.Fatalf("WWW-Authenticate = %s, want %s", got, challenge)
+	}
+}
+
+const invalidAPIKeyChallenge = `ApiKey realm="tubely", error="invalid_token", error_description="Couldn't validate API key"`
+
+func TestAPIKeys(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signup(t, "machine@example.com")
+
+	key := api.createAPIKey(t, user.Token, auth.ScopeVideosRead, auth.ScopeVideosRead)
+	if !strings.HasPrefix(key.Key, apiKeyPrefix) || !strings.HasPrefix(key.Key, key.Prefix) || key.UserID != user.ID {
+		t.Fatalf("created key %+v", key)
+	}
+	if len(key.Scopes) != 1 || key.Scopes[0] != string(auth.ScopeVideosRead) {
+		t.Fatalf("Scopes = %v, want videos:read once", key.Scopes)
+	}
+
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos", key.Key, nil, nil)
+	if stored, err := api.db.GetAPIKeyByHash(context.Background(), auth.HashToken(key.Key)); err != nil || stored.LastUsedAt == nil {
+		t.Fatalf("key after use = %+v, %v; want last_used_at set", stored, err)
+	}
+
+	// The list never includes the key itself.
+	var keys []map[string]any
+	api.expectStatus(t, http.StatusOK, "GET", "/api/api_keys", user.Token, nil, &keys)
+	if len(keys) != 1 || keys[0]["key"] != nil || keys[0]["key_hash"] != nil {
+		t.Fatalf("GET /api/api_keys = %v", keys)
+	}
+
+	api.expectStatus(t, http.StatusNoContent, "DELETE", "/api/api_keys/"+key.ID.String(), user.Token, nil, nil)
+	res := api.expectStatus(t, http.StatusUnauthorized, "GET", "/api/videos", key.Key, nil, nil)
+	expectChallenge(t, res, invalidAPIKeyChallenge)
+	api.expectStatus(t, http.StatusNotFound, "DELETE", "/api/api_keys/"+key.ID.String(), user.Token, nil, nil)
+}
+
+func TestAPIKeyRejected(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signup(t, "machine@example.com")
+
+	// Keys are checked by hash, so a made-up key is as unknown as a
+	// deleted one.
+	res := api.expectStatus(t, http.StatusUnauthorized, "GET", "/api/videos", apiKeyPrefix+"unknown", nil, nil)
+	expectChallenge(t, res, invalidAPIKeyChallenge)
+
+	expired := apiKeyPrefix + "expired-key"
+	expiredAt := time.Now().Add(-time.Minute)
+	if _, err := api.db.CreateAPIKey(context.Background(), database.CreateAPIKeyParams{
+		UserID:    user.ID,
+		Name:      "expired",
+		Prefix:    expired[:apiKeyDisplayLength],
+		KeyHash:   auth.HashToken(expired),
+		Scopes:    auth.ScopeStrings(auth.APIKeyScopes),
+		ExpiresAt: &expiredAt,
+	}); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	res = api.expectStatus(t, http.StatusUnauthorized, "GET", "/api/videos", expired, nil, nil)
+	expectChallenge(t, res, invalidAPIKeyChallenge)
+}
+
+func TestAPIKeyCreateValidation(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signup(t, "machine@example.com")
+
+	for name, body := range map[string]map[string]any{
+		"no scopes":       {"name": "ci"},
+		"empty scopes":    {"name": "ci", "scopes": []string{}},
+		"admin scope":     {"name": "ci", "scopes": []string{"videos:read", "admin"}},
+		"unknown scope":   {"name": "ci", "scopes": []string{"videos:everything"}},
+		"no name":         {"name": "  ", "scopes": []string{"videos:read"}},
+		"already expired": {"name": "ci", "scopes": []string{"videos:read"}, "expires_at": time.Now().Add(-time.Hour)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			api.expectStatus(t, http.StatusBadRequest, "POST", "/api/api_keys", user.Token, body, nil)
+		})
+	}
+}
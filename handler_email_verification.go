@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mail"
+	"github.com/google/uuid"
+)
+
+// sendEmailVerification mails user a link that confirms their address.
+func (cfg *apiConfig) sendEmailVerification(ctx context.Context, user database.User) error {
+	token, err := cfg.issueAccountToken(ctx, user.ID, database.AccountTokenEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	cfg.sendMail(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your Tubely email address",
+		Body: "Confirm your email address to start uploading videos:\n\n" +
+			cfg.appLink("verify_email", token) + "\n\n" +
+			"The link expires in 48 hours. If you didn't sign up for Tubely, you can ignore this email.\n",
+	})
+	return nil
+}
+
+// handlerVerifyEmail confirms the address a verification link was mailed
+// to. It doesn't need a login, since the link may be opened anywhere:
+//
+//	{ "token": "..." }
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	err := cfg.db.WithTx(r.Context(), func(tx database.Store) error {
+		token, err := tx.UseAccountToken(r.Context(), database.AccountTokenEmailVerification, auth.HashToken(params.Token))
+		if err != nil {
+			return err
+		}
+		return tx.MarkEmailVerified(r.Context(), token.UserID)
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusBadRequest, "Verification link is invalid or has expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerVerifyEmailResend mails the caller a new verification link.
+func (cfg *apiConfig) handlerVerifyEmailResend(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.db.GetUser(r.Context(), auth.UserIDFromContext(r.Context()))
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't get user", err)
+		return
+	}
+	if user.EmailVerified() {
+		respondWithError(w, http.StatusConflict, "Email is already verified", nil)
+		return
+	}
+
+	err = cfg.sendEmailVerification(r.Context(), *user)
+	if errors.Is(err, errTooManyAccountTokens) {
+		respondWithError(w, http.StatusTooManyRequests, err.Error(), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// requireVerifiedEmail responds and returns false unless userID has
+// confirmed their email address. Uploads need one, so accounts made with
+// someone else's address can't host files.
+func (cfg *apiConfig) requireVerifiedEmail(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't get user", err)
+		return false
+	}
+	if !user.EmailVerified() {
+		respondWithError(w, http.StatusForbidden, "Verify your email address before uploading", nil)
+		return false
+	}
+	return true
+}
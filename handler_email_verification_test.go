@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// expiredAccountToken stores a token for purpose that expired a minute ago
+// and returns it.
+func (api *testAPI) expiredAccountToken(t *testing.T, userID uuid.UUID, purpose database.AccountTokenPurpose) string {
+	t.Helper()
+	token, err := auth.MakeToken()
+	if err != nil {
+		t.Fatalf("MakeToken: %v", err)
+	}
+	_, err = api.db.CreateAccountToken(context.Background(), database.CreateAccountTokenParams{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("CreateAccountToken: %v", err)
+	}
+	return token
+}
+
+func TestVerifyEmail(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.signupUnverified(t, "a@example.com")
+	token := api.mailLink(t, "a@example.com", 1, "verify_email")
+
+	api.expectStatus(t, http.StatusBadRequest, "POST", "/api/verify_email", "", map[string]string{"token": "not-a-token"}, nil)
+	api.expectStatus(t, http.StatusNoContent, "POST", "/api/verify_email", "", map[string]string{"token": token}, nil)
+	if user, _ := api.getUser(t, login.ID); !user.EmailVerified() {
+		t.Fatal("user isn't verified after following the link")
+	}
+	// Links work once.
+	api.expectStatus(t, http.StatusBadRequest, "POST", "/api/verify_email", "", map[string]string{"token": token}, nil)
+	api.expectStatus(t, http.StatusConflict, "POST", "/api/verify_email/resend", login.Token, nil, nil)
+}
+
+func TestVerifyEmailRejectsExpiredLinks(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.signupUnverified(t, "a@example.com")
+
+	token := api.expiredAccountToken(t, login.ID, database.AccountTokenEmailVerification)
+	api.expectStatus(t, http.StatusBadRequest, "POST", "/api/verify_email", "", map[string]string{"token": token}, nil)
+	if user, _ := api.getUser(t, login.ID); user.EmailVerified() {
+		t.Fatal("an expired link verified the user")
+	}
+}
+
+func TestVerifyEmailResendIsRateLimited(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.signupUnverified(t, "a@example.com")
+
+	// Signing up sent the first link.
+	for i := 1; i < maxAccountTokensPerHour; i++ {
+		api.expectStatus(t, http.StatusAccepted, "POST", "/api/verify_email/resend", login.Token, nil, nil)
+	}
+	api.expectStatus(t, http.StatusTooManyRequests, "POST", "/api/verify_email/resend", login.Token, nil, nil)
+	if n := api.mailCount("a@example.com"); n != maxAccountTokensPerHour {
+		t.Fatalf("sent %d verification mails, want %d", n, maxAccountTokensPerHour)
+	}
+
+	// Every link sent still works.
+	token := api.mailLink(t, "a@example.com", 2, "verify_email")
+	api.expectStatus(t, http.StatusNoContent, "POST", "/api/verify_email", "", map[string]string{"token": token}, nil)
+}
+
+func TestUnverifiedUsersCantUpload(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.signupUnverified(t, "a@example.com")
+
+	var video database.Video
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", login.Token, map[string]any{"title": "first"}, &video)
+	id := video.ID.String()
+	api.expectStatus(t, http.StatusForbidden, "POST", "/api/video_upload/"+id, login.Token, nil, nil)
+	api.expectStatus(t, http.StatusForbidden, "POST", "/api/thumbnail_upload/"+id, login.Token, nil, nil)
+	api.expectStatus(t, http.StatusForbidden, "POST", "/api/videos/"+id+"/import", login.Token, map[string]string{"url": "https://example.com/video.mp4"}, nil)
+
+	token := api.mailLink(t, "a@example.com", 1, "verify_email")
+	api.expectStatus(t, http.StatusNoContent, "POST", "/api/verify_email", "", map[string]string{"token": token}, nil)
+	// Now the upload gets as far as finding there's no file in it.
+	api.expectStatus(t, http.StatusBadRequest, "POST", "/api/thumbnail_upload/"+id, login.Token, nil, nil)
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"net/http"
+)
+
+// jwksMaxAge is how long verifiers may cache our keys. A new key must be
+// published at least this long before tokens are signed with it.
+const jwksMaxAge = "max-age=300"
+
+// handlerJWKS publishes the public keys access tokens can be verified with,
+// so other services can check them without sharing a secret.
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, "+jwksMaxAge)
+	respondWithJSON(w, http.StatusOK, cfg.jwtKeys.JWKS())
+}
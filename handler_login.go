@@ -2,6 +2,8 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -13,13 +15,10 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Password string `json:"password"`
 		Email    string `json:"email"`
+		// Scopes narrows what the session's access tokens can do. It
+		// defaults to every scope.
+		Scopes []string `json:"scopes"`
 	}
-	type response struct {
-		database.User
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
-	}
-
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
 	err := decoder.Decode(&params)
@@ -28,45 +27,74 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.GetUserByEmail(params.Email)
-	if err != nil {
+	scopes := auth.AllScopes
+	if params.Scopes != nil {
+		scopes, err = auth.ParseScopes(params.Scopes, auth.AllScopes)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+
+	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	if errors.Is(err, database.ErrNotFound) {
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
 		return
 	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
 
 	if err := auth.CheckPasswordHash(params.Password, user.Password); err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.jwtSecret,
-		time.Hour*24*30,
-	)
+	res, err := cfg.startSession(r, user, scopes)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start session", err)
 		return
 	}
+	respondWithJSON(w, http.StatusOK, res)
+}
 
+// loginResponse is what a successful login returns, however the user
+// logged in.
+type loginResponse struct {
+	database.User
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// startSession creates a session for user and returns its first access and
+// refresh tokens.
+func (cfg *apiConfig) startSession(r *http.Request, user database.User, scopes []auth.Scope) (loginResponse, error) {
 	refreshToken, err := auth.MakeRefreshToken()
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token", err)
-		return
+		return loginResponse{}, fmt.Errorf("couldn't create refresh token: %w", err)
 	}
 
-	if _, err = cfg.db.CreateRefreshToken(database.CreateRefreshTokenParams{
+	session, err := cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
 		UserID:    user.ID,
-		Token:     refreshToken,
+		TokenHash: auth.HashToken(refreshToken),
 		ExpiresAt: time.Now().UTC().Add(time.Hour * 24 * 60),
-	}); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't save refresh token", err)
-		return
+		UserAgent: clientUserAgent(r),
+		IPAddress: clientIP(r),
+		Scopes:    auth.ScopeStrings(scopes),
+	})
+	if err != nil {
+		return loginResponse{}, fmt.Errorf("couldn't save refresh token: %w", err)
 	}
 
-	respondWithJSON(w, http.StatusOK, response{
+	accessToken, err := cfg.jwtKeys.MakeJWT(user.ID, session.FamilyID, scopes)
+	if err != nil {
+		return loginResponse{}, fmt.Errorf("couldn't create access JWT: %w", err)
+	}
+
+	return loginResponse{
 		User:         user,
 		Token:        accessToken,
 		RefreshToken: refreshToken,
-	})
+	}, nil
 }
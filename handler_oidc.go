@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/oidc"
+)
+
+const (
+	// oidcCookieName holds the AuthRequest of a login in progress, so the
+	// callback can check it came from a login this browser started.
+	oidcCookieName = "tubely_oidc"
+	oidcLoginTTL   = 10 * time.Minute
+	// oidcLoginCodeTTL is how long the app has to trade the code it is
+	// sent back with for tokens.
+	oidcLoginCodeTTL = time.Minute
+)
+
+var errOIDCEmailUnverified = errors.New("your account at the provider has no verified email address")
+
+// oidcLogin is what the login cookie holds.
+type oidcLogin struct {
+	Provider string `json:"provider"`
+	oidc.AuthRequest
+}
+
+// handlerOIDCProviders lists the providers users can log in with.
+func (cfg *apiConfig) handlerOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	type provider struct {
+		Name     string `json:"name"`
+		LoginURL string `json:"login_url"`
+	}
+
+	providers := []provider{}
+	for name := range cfg.oidcProviders {
+		providers = append(providers, provider{Name: name, LoginURL: "/api/oidc/" + name + "/login"})
+	}
+	slices.SortFunc(providers, func(a, b provider) int { return strings.Compare(a.Name, b.Name) })
+
+	respondWithJSON(w, http.StatusOK, providers)
+}
+
+// handlerOIDCLogin sends the browser to a provider to log in.
+func (cfg *apiConfig) handlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Unknown login provider", nil)
+		return
+	}
+
+	req, err := oidc.NewAuthRequest()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start login", err)
+		return
+	}
+	authURL, err := provider.AuthCodeURL(r.Context(), cfg.oidcRedirectURI(provider), req)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "Couldn't reach login provider", err)
+		return
+	}
+
+	value, err := json.Marshal(oidcLogin{Provider: provider.Name(), AuthRequest: req})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start login", err)
+		return
+	}
+	http.SetCookie(w, cfg.oidcCookie(base64.RawURLEncoding.EncodeToString(value), int(oidcLoginTTL.Seconds())))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// handlerOIDCCallback is where the provider sends the browser back. It
+// finishes the login and sends the browser on to the app, with a one-time
+// code for handlerOIDCToken or with an error.
+func (cfg *apiConfig) handlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	fail := func(msg string, err error) {
+		if err != nil {
+			log.Printf("OIDC login failed: %s: %v", msg, err)
+		}
+		http.Redirect(w, r, cfg.appLink("oidc_error", msg), http.StatusFound)
+	}
+
+	provider, ok := cfg.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Unknown login provider", nil)
+		return
+	}
+
+	// The cookie is only good for one callback.
+	http.SetCookie(w, cfg.oidcCookie("", -1))
+	login, err := readOIDCLogin(r)
+	if err != nil {
+		fail("Login expired; try again", err)
+		return
+	}
+	state := r.URL.Query().Get("state")
+	if login.Provider != provider.Name() || subtle.ConstantTimeCompare([]byte(state), []byte(login.State)) != 1 {
+		fail("Login expired; try again", errors.New("state doesn't match"))
+		return
+	}
+	if errCode := r.URL.Query().Get("error"); errCode != "" {
+		fail("Login was cancelled", errors.New(errCode))
+		return
+	}
+
+	idToken, err := provider.Exchange(r.Context(), cfg.oidcRedirectURI(provider), r.URL.Query().Get("code"), login.AuthRequest)
+	if err != nil {
+		fail("Couldn't verify login with the provider", err)
+		return
+	}
+
+	user, err := cfg.resolveOIDCUser(r.Context(), idToken)
+	if errors.Is(err, errOIDCEmailUnverified) {
+		fail("Your account at the provider has no verified email address", nil)
+		return
+	}
+	if err != nil {
+		fail("Couldn't log in", err)
+		return
+	}
+
+	code, err := auth.MakeToken()
+	if err != nil {
+		fail("Couldn't log in", err)
+		return
+	}
+	_, err = cfg.db.CreateAccountToken(r.Context(), database.CreateAccountTokenParams{
+		UserID:    user.ID,
+		Purpose:   database.AccountTokenOIDCLogin,
+		TokenHash: auth.HashToken(code),
+		ExpiresAt: time.Now().Add(oidcLoginCodeTTL),
+	})
+	if err != nil {
+		fail("Couldn't log in", err)
+		return
+	}
+
+	http.Redirect(w, r, cfg.appLink("oidc_code", code), http.StatusFound)
+}
+
+// handlerOIDCToken trades the code an OIDC login sent the app for the same
+// response as POST /api/login:
+//
+//	{ "code": "...", "scopes": ["videos:read"] }
+func (cfg *apiConfig) handlerOIDCToken(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code   string   `json:"code"`
+		Scopes []string `json:"scopes"`
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	scopes := auth.AllScopes
+	if params.Scopes != nil {
+		var err error
+		scopes, err = auth.ParseScopes(params.Scopes, auth.AllScopes)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+
+	token, err := cfg.db.UseAccountToken(r.Context(), database.AccountTokenOIDCLogin, auth.HashToken(params.Code))
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusUnauthorized, "Login code is invalid or has expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't use login code", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), token.UserID)
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't get user", err)
+		return
+	}
+
+	res, err := cfg.startSession(r, *user, scopes)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start session", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// resolveOIDCUser returns the user a provider account logs in as. An
+// account that isn't linked yet is linked by its email address, which the
+// provider must have verified: to the user with that address, or to a new
+// user if there is none.
+func (cfg *apiConfig) resolveOIDCUser(ctx context.Context, idToken oidc.IDToken) (database.User, error) {
+	user, err := cfg.db.GetUserByIdentity(ctx, idToken.Issuer, idToken.Subject)
+	if err == nil {
+		return *user, nil
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		return database.User{}, err
+	}
+	if idToken.Email == "" || !idToken.EmailVerified {
+		return database.User{}, errOIDCEmailUnverified
+	}
+
+	// Users who log in with a provider have no password until they reset
+	// it, so give them one nobody knows.
+	password, err := auth.MakeToken()
+	if err != nil {
+		return database.User{}, err
+	}
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	var linked database.User
+	err = cfg.db.WithTx(ctx, func(tx database.Store) error {
+		existing, err := tx.GetUserByEmail(ctx, idToken.Email)
+		if err == nil && !existing.EmailVerified() {
+			// Whoever signed up with this address never proved it was
+			// theirs, and the provider says it belongs to someone else.
+			// Their account goes, with everything in it, so nothing they
+			// set up, such as a webhook, outlives it to watch the real
+			// owner's videos, and their access tokens name a user that no
+			// longer exists. Unverified users can't upload, so no files
+			// are left behind.
+			if err := tx.DeleteUser(ctx, existing.ID); err != nil {
+				return err
+			}
+			err = database.ErrNotFound
+		}
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			created, err := tx.CreateUser(ctx, database.CreateUserParams{Email: idToken.Email, Password: hashedPassword})
+			if err != nil {
+				return err
+			}
+			existing = *created
+		case err != nil:
+			return err
+		}
+
+		if err := tx.MarkEmailVerified(ctx, existing.ID); err != nil {
+			return err
+		}
+		if err := tx.LinkUserIdentity(ctx, existing.ID, idToken.Issuer, idToken.Subject); err != nil {
+			return err
+		}
+		user, err := tx.GetUser(ctx, existing.ID)
+		if err != nil {
+			return err
+		}
+		linked = *user
+		return nil
+	})
+	// A concurrent callback for the same account linked it first.
+	if errors.Is(err, database.ErrConflict) {
+		user, err := cfg.db.GetUserByIdentity(ctx, idToken.Issuer, idToken.Subject)
+		if err != nil {
+			return database.User{}, err
+		}
+		return *user, nil
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+	return linked, nil
+}
+
+func (cfg *apiConfig) oidcRedirectURI(provider *oidc.Provider) string {
+	return cfg.appBaseURL + "/api/oidc/" + provider.Name() + "/callback"
+}
+
+// oidcCookie returns the login cookie. A negative maxAge deletes it.
+func (cfg *apiConfig) oidcCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcCookieName,
+		Value:    value,
+		Path:     "/api/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.appBaseURL, "https://"),
+		// Lax, so the cookie comes back with the provider's redirect.
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func readOIDCLogin(r *http.Request) (oidcLogin, error) {
+	cookie, err := r.Cookie(oidcCookieName)
+	if err != nil {
+		return oidcLogin{}, err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return oidcLogin{}, err
+	}
+	var login oidcLogin
+	if err := json.Unmarshal(data, &login); err != nil {
+		return oidcLogin{}, err
+	}
+	return login, nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/oidc"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oidcUserEmail is who the mock provider logs everyone in as by default.
+const oidcUserEmail = "oidc-user@example.com"
+
+// addOIDCProvider starts a mock provider and lets users log in with it as
+// "test".
+func (api *testAPI) addOIDCProvider(t *testing.T) *oidctest.Provider {
+	t.Helper()
+	idp, err := oidctest.NewProvider()
+	if err != nil {
+		t.Fatalf("oidctest.NewProvider: %v", err)
+	}
+	t.Cleanup(idp.Close)
+	api.cfg.oidcProviders = map[string]*oidc.Provider{
+		"test": oidc.NewProvider(oidc.Config{
+			Name:         "test",
+			Issuer:       idp.Issuer(),
+			ClientID:     idp.ClientID,
+			ClientSecret: idp.ClientSecret,
+		}, idp.Client()),
+	}
+	return idp
+}
+
+// oidcCallback logs in with the provider as a browser would, and returns
+// the query the callback sends the app. tamper, if not nil, can change the
+// request to the callback first.
+func (api *testAPI) oidcCallback(t *testing.T, idp *oidctest.Provider, tamper func(req *http.Request)) url.Values {
+	t.Helper()
+	noRedirects := func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	client := &http.Client{CheckRedirect: noRedirects}
+	idpClient := *idp.Client()
+	idpClient.CheckRedirect = noRedirects
+
+	res, err := client.Get(api.server.URL + "/api/oidc/test/login")
+	if err != nil {
+		t.Fatalf("GET /api/oidc/test/login: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("GET /api/oidc/test/login: status %d, want %d", res.StatusCode, http.StatusFound)
+	}
+	cookies := res.Cookies()
+
+	res, err = idpClient.Get(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("logging in at the provider: %v", err)
+	}
+	res.Body.Close()
+
+	req, err := http.NewRequest(http.MethodGet, res.Header.Get("Location"), nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	if tamper != nil {
+		tamper(req)
+	}
+	res, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", req.URL.Path, err)
+	}
+	res.Body.Close()
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || res.StatusCode != http.StatusFound || location.Path != "/app/" {
+		t.Fatalf("callback responded %d, redirecting to %q", res.StatusCode, res.Header.Get("Location"))
+	}
+	return location.Query()
+}
+
+// oidcCode logs in with the provider and returns the code the app is sent.
+func (api *testAPI) oidcCode(t *testing.T, idp *oidctest.Provider) string {
+	t.Helper()
+	query := api.oidcCallback(t, idp, nil)
+	if query.Get("oidc_code") == "" {
+		t.Fatalf("login failed: %q", query.Get("oidc_error"))
+	}
+	return query.Get("oidc_code")
+}
+
+// loginWithOIDC logs in with the provider and trades the code for tokens.
+func (api *testAPI) loginWithOIDC(t *testing.T, idp *oidctest.Provider) loginResponse {
+	t.Helper()
+	var res loginResponse
+	api.expectStatus(t, http.StatusOK, "POST", "/api/oidc/token", "", map[string]string{"code": api.oidcCode(t, idp)}, &res)
+	return res
+}
+
+// expectOIDCError logs in with the provider and fails unless the login
+// fails.
+func (api *testAPI) expectOIDCError(t *testing.T, idp *oidctest.Provider, tamper func(req *http.Request)) string {
+	t.Helper()
+	query := api.oidcCallback(t, idp, tamper)
+	if query.Get("oidc_code") != "" || query.Get("oidc_error") == "" {
+		t.Fatalf("callback sent the app %v, want an error", query)
+	}
+	if _, err := api.db.GetUserByEmail(context.Background(), oidcUserEmail); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("failed login left a user behind: %v", err)
+	}
+	return query.Get("oidc_error")
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	api := newTestAPI(t)
+	idp := api.addOIDCProvider(t)
+
+	login := api.loginWithOIDC(t, idp)
+	if login.Email != oidcUserEmail || !login.EmailVerified() || login.Token == "" || login.RefreshToken == "" {
+		t.Fatalf("login response = %+v", login)
+	}
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos", login.Token, nil, nil)
+
+	// The provider account is linked now, so the next login is the same
+	// user, even if the provider changed the address.
+	idp.SetUser(oidctest.User{Subject: "user-1", Email: "renamed@example.com", EmailVerified: true})
+	if again := api.loginWithOIDC(t, idp); again.ID != login.ID {
+		t.Fatalf("second login was user %v, want %v", again.ID, login.ID)
+	}
+}
+
+func TestOIDCLoginCodeWorksOnce(t *testing.T) {
+	api := newTestAPI(t)
+	idp := api.addOIDCProvider(t)
+
+	code := api.oidcCode(t, idp)
+	api.expectStatus(t, http.StatusUnauthorized, "POST", "/api/oidc/token", "", map[string]string{"code": "not-a-code"}, nil)
+	api.expectStatus(t, http.StatusOK, "POST", "/api/oidc/token", "", map[string]string{"code": code}, nil)
+	api.expectStatus(t, http.StatusUnauthorized, "POST", "/api/oidc/token", "", map[string]string{"code": code}, nil)
+}
+
+func TestOIDCCallbackChecksState(t *testing.T) {
+	api := newTestAPI(t)
+	idp := api.addOIDCProvider(t)
+
+	api.expectOIDCError(t, idp, func(req *http.Request) {
+		q := req.URL.Query()
+		q.Set("state", "another-login")
+		req.URL.RawQuery = q.Encode()
+	})
+	// A callback without the cookie from the login it belongs to could
+	// have been started by someone else.
+	api.expectOIDCError(t, idp, func(req *http.Request) {
+		req.Header.Del("Cookie")
+	})
+}
+
+func TestOIDCCallbackChecksNonce(t *testing.T) {
+	api := newTestAPI(t)
+	idp := api.addOIDCProvider(t)
+
+	idp.ModifyClaims(func(claims jwt.MapClaims) { claims["nonce"] = "another-login" })
+	api.expectOIDCError(t, idp, nil)
+}
+
+func TestOIDCCallbackRejectsBadIDTokens(t *testing.T) {
+	api := newTestAPI(t)
+	idp := api.addOIDCProvider(t)
+
+	for _, modify := range []func(jwt.MapClaims){
+		func(claims jwt.MapClaims) { claims["aud"] = "someone-else" },
+		func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example" },
+		func(claims jwt.MapClaims) { claims["exp"] = 1 },
+	} {
+		idp.ModifyClaims(modify)
+		api.expectOIDCError(t, idp, nil)
+	}
+}
+
+func TestOIDCRequiresVerifiedEmail(t *testing.T) {
+	api := newTestAPI(t)
+	idp := api.addOIDCProvider(t)
+
+	idp.SetUser(oidctest.User{Subject: "user-1", Email: oidcUserEmail, EmailVerified: false})
+	if msg := api.expectOIDCError(t, idp, nil); !strings.Contains(msg, "verified email") {
+		t.Fatalf("oidc_error = %q, want it to explain the email isn't verified", msg)
+	}
+}
+
+func TestOIDCLinksVerifiedUser(t *testing.T) {
+	api := newTestAPI(t)
+	idp := api.addOIDCProvider(t)
+	existing := api.signup(t, oidcUserEmail)
+
+	login := api.loginWithOIDC(t, idp)
+	if login.ID != existing.ID {
+		t.Fatalf("OIDC login was user %v, want the existing user %v", login.ID, existing.ID)
+	}
+	// The user who proved the address keeps their password and sessions.
+	api.login(t, oidcUserEmail, testPassword)
+	api.expectStatus(t, http.StatusOK, "POST", "/api/refresh", existing.RefreshToken, nil, nil)
+}
+
+func TestOIDCReplacesUnverifiedUser(t *testing.T) {
+	api := newTestAPI(t)
+	idp := api.addOIDCProvider(t)
+	ctx := context.Background()
+
+	// Someone signs up with the provider user's address, in other case,
+	// and sets up an account to watch what its real owner does.
+	squatter := api.signupUnverified(t, strings.ToUpper(oidcUserEmail))
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/api_keys", squatter.Token, map[string]any{"name": "ci", "scopes": []string{"videos:read"}}, nil)
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/webhooks", squatter.Token, map[string]any{"url": "https://93.184.215.14/hook", "events": webhookEventTypes}, nil)
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/playlists", squatter.Token, map[string]any{"title": "watching"}, nil)
+
+	login := api.loginWithOIDC(t, idp)
+	if login.ID == squatter.ID || !login.EmailVerified() {
+		t.Fatalf("OIDC login = %+v, want a new verified user, not %v", login.User, squatter.ID)
+	}
+
+	// The squatter's account is gone, with everything in it.
+	if _, err := api.db.GetUser(ctx, squatter.ID); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("GetUser for the squatter: %v, want %v", err, database.ErrNotFound)
+	}
+	for name, get := range map[string]func() (int, error){
+		"webhooks":  func() (int, error) { w, err := api.db.GetWebhooks(ctx, squatter.ID); return len(w), err },
+		"API keys":  func() (int, error) { k, err := api.db.GetAPIKeys(ctx, squatter.ID); return len(k), err },
+		"playlists": func() (int, error) { p, err := api.db.GetPlaylists(ctx, squatter.ID); return len(p), err },
+	} {
+		if n, err := get(); err != nil || n != 0 {
+			t.Fatalf("squatter has %d %s left, %v", n, name, err)
+		}
+	}
+	api.expectStatus(t, http.StatusUnauthorized, "POST", "/api/login", "", map[string]string{"email": oidcUserEmail, "password": testPassword}, nil)
+	api.expectStatus(t, http.StatusUnauthorized, "POST", "/api/refresh", squatter.RefreshToken, nil, nil)
+
+	// The real owner's videos send events to nobody.
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", login.Token, map[string]any{"title": "mine"}, nil)
+	due, err := api.db.ClaimDueWebhookDeliveries(ctx, 100, time.Minute)
+	if err != nil || len(due) != 0 {
+		t.Fatalf("ClaimDueWebhookDeliveries = %d deliveries, %v, want none", len(due), err)
+	}
+	api.expectStatus(t, http.StatusOK, "POST", "/api/refresh", login.RefreshToken, nil, nil)
+}
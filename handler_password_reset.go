@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mail"
+	"github.com/google/uuid"
+)
+
+// handlerPasswordResetRequest mails a reset link to an account's address:
+//
+//	{ "email": "user@example.com" }
+//
+// It responds 202 whether or not the account exists, and does the work in
+// the background so the response time doesn't tell either.
+func (cfg *apiConfig) handlerPasswordResetRequest(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Email == "" {
+		respondWithError(w, http.StatusBadRequest, "Email is required", nil)
+		return
+	}
+
+	go cfg.sendPasswordReset(context.WithoutCancel(r.Context()), params.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) sendPasswordReset(ctx context.Context, email string) {
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if errors.Is(err, database.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		log.Printf("Couldn't look up user for password reset: %v", err)
+		return
+	}
+
+	token, err := cfg.issueAccountToken(ctx, user.ID, database.AccountTokenPasswordReset, passwordResetTTL)
+	if err != nil {
+		log.Printf("Couldn't issue password reset for user %s: %v", user.ID, err)
+		return
+	}
+	cfg.sendMail(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Tubely password",
+		Body: "Someone asked to reset the password of your Tubely account. To choose a new one, open:\n\n" +
+			cfg.appLink("reset_password", token) + "\n\n" +
+			"The link works once and expires in an hour. If you didn't ask, you can ignore this email; your password hasn't changed.\n",
+	})
+}
+
+// handlerPasswordResetConfirm sets a new password with the token from a
+// reset link, and signs the account out everywhere:
+//
+//	{ "token": "...", "password": "..." }
+func (cfg *apiConfig) handlerPasswordResetConfirm(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Password is required", nil)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+		return
+	}
+
+	err = cfg.db.WithTx(r.Context(), func(tx database.Store) error {
+		token, err := tx.UseAccountToken(r.Context(), database.AccountTokenPasswordReset, auth.HashToken(params.Token))
+		if err != nil {
+			return err
+		}
+		if err := tx.UpdateUserPassword(r.Context(), token.UserID, hashedPassword); err != nil {
+			return err
+		}
+		// The reset link was mailed to the user, so following it proves the
+		// address is theirs.
+		if err := tx.MarkEmailVerified(r.Context(), token.UserID); err != nil {
+			return err
+		}
+		return tx.RevokeOtherSessions(r.Context(), token.UserID, uuid.Nil)
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusBadRequest, "Reset link is invalid or has expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
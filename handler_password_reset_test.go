@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestPasswordReset(t *testing.T) {
+	api := newTestAPI(t)
+	first := api.signup(t, "a@example.com")
+	second := api.login(t, "a@example.com", testPassword)
+	before := api.mailCount("a@example.com")
+
+	api.expectStatus(t, http.StatusAccepted, "POST", "/api/password_reset", "", map[string]string{"email": "a@example.com"}, nil)
+	token := api.mailLink(t, "a@example.com", before+1, "reset_password")
+
+	api.expectStatus(t, http.StatusBadRequest, "POST", "/api/password_reset/confirm", "", map[string]string{"token": token}, nil)
+	api.expectStatus(t, http.StatusBadRequest, "POST", "/api/password_reset/confirm", "", map[string]string{"token": "not-a-token", "password": "new-password"}, nil)
+	api.expectStatus(t, http.StatusNoContent, "POST", "/api/password_reset/confirm", "", map[string]string{"token": token, "password": "new-password"}, nil)
+
+	// Every session ends, and only the new password logs in.
+	api.expectStatus(t, http.StatusUnauthorized, "POST", "/api/refresh", first.RefreshToken, nil, nil)
+	api.expectStatus(t, http.StatusUnauthorized, "POST", "/api/refresh", second.RefreshToken, nil, nil)
+	api.expectStatus(t, http.StatusUnauthorized, "POST", "/api/login", "", map[string]string{"email": "a@example.com", "password": testPassword}, nil)
+	api.login(t, "a@example.com", "new-password")
+
+	// Links work once.
+	api.expectStatus(t, http.StatusBadRequest, "POST", "/api/password_reset/confirm", "", map[string]string{"token": token, "password": "another-password"}, nil)
+	api.login(t, "a@example.com", "new-password")
+}
+
+func TestPasswordResetRejectsExpiredLinks(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.signup(t, "a@example.com")
+
+	token := api.expiredAccountToken(t, login.ID, database.AccountTokenPasswordReset)
+	api.expectStatus(t, http.StatusBadRequest, "POST", "/api/password_reset/confirm", "", map[string]string{"token": token, "password": "new-password"}, nil)
+	api.login(t, "a@example.com", testPassword)
+	api.expectStatus(t, http.StatusOK, "POST", "/api/refresh", login.RefreshToken, nil, nil)
+}
+
+func TestPasswordResetIsRateLimited(t *testing.T) {
+	api := newTestAPI(t)
+	api.signup(t, "a@example.com")
+	before := api.mailCount("a@example.com")
+
+	for i := 1; i <= maxAccountTokensPerHour; i++ {
+		api.expectStatus(t, http.StatusAccepted, "POST", "/api/password_reset", "", map[string]string{"email": "a@example.com"}, nil)
+		api.mailLink(t, "a@example.com", before+i, "reset_password")
+	}
+
+	// The endpoint answers the same either way and sends in the
+	// background, so send the next one directly to see it dropped.
+	api.expectStatus(t, http.StatusAccepted, "POST", "/api/password_reset", "", map[string]string{"email": "a@example.com"}, nil)
+	api.cfg.sendPasswordReset(context.Background(), "a@example.com")
+	if n := api.mailCount("a@example.com") - before; n != maxAccountTokensPerHour {
+		t.Fatalf("sent %d reset mails, want %d", n, maxAccountTokensPerHour)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// playlistResponse is a playlist with the videos in it that the caller can
+// see, in playlist order.
+type playlistResponse struct {
+	database.Playlist
+	Videos []database.Video `json:"videos"`
+}
+
+func (cfg *apiConfig) handlerPlaylistsCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Visibility  string `json:"visibility"`
+	}
+
+	userID := auth.UserIDFromContext(r.Context())
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if err := validateVideoTitle(params.Title); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if err := validateVideoDescription(params.Description); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if params.Visibility != "" && !database.ValidVideoVisibility(params.Visibility) {
+		respondWithError(w, http.StatusBadRequest, "visibility must be one of private, unlisted, public", nil)
+		return
+	}
+
+	playlist, err := cfg.db.CreatePlaylist(r.Context(), database.CreatePlaylistParams{
+		UserID:      userID,
+		Title:       params.Title,
+		Description: params.Description,
+		Visibility:  params.Visibility,
+	})
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't create playlist", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, playlistResponse{Playlist: playlist, Videos: []database.Video{}})
+}
+
+func (cfg *apiConfig) handlerPlaylistsList(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserIDFromContext(r.Context())
+
+	playlists, err := cfg.db.GetPlaylists(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlists", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, playlists)
+}
+
+// handlerPlaylistGet returns a playlist and its videos. Like a video, a
+// private playlist looks missing to everyone but its owner, and unlisted and
+// public playlists need no token. Videos the caller can't see are left out.
+func (cfg *apiConfig) handlerPlaylistGet(w http.ResponseWriter, r *http.Request) {
+	playlistID, err := uuid.Parse(r.PathValue("playlistID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist ID", err)
+		return
+	}
+
+	userID := auth.UserIDFromContext(r.Context())
+
+	playlist, err := cfg.db.GetPlaylist(r.Context(), playlistID)
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't get playlist", err)
+		return
+	}
+	if playlist.Visibility == database.VideoVisibilityPrivate && playlist.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Couldn't get playlist", nil)
+		return
+	}
+
+	cfg.respondWithPlaylist(w, r, http.StatusOK, playlist, userID)
+}
+
+// handlerPlaylistUpdate edits a playlist's title, description, visibility
+// and cover_video_id with a JSON merge patch. The cover must be one of the
+// playlist's videos; null goes back to the first video's thumbnail.
+func (cfg *apiConfig) handlerPlaylistUpdate(w http.ResponseWriter, r *http.Request) {
+	playlist, userID, ok := cfg.ownedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/merge-patch+json", err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxVideoPatchBytes)
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		respondWithError(w, http.StatusBadRequest, "Patch must be a JSON object", err)
+		return
+	}
+	if err := applyPlaylistPatch(&playlist, patch); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	if _, ok := patch["cover_video_id"]; ok && playlist.CoverVideoID != nil {
+		videos, err := cfg.db.GetPlaylistVideos(r.Context(), playlist.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist videos", err)
+			return
+		}
+		if !slices.ContainsFunc(videos, func(v database.Video) bool { return v.ID == *playlist.CoverVideoID }) {
+			respondWithError(w, http.StatusBadRequest, "cover_video_id must be a video in the playlist", nil)
+			return
+		}
+	}
+
+	playlist, err = cfg.db.UpdatePlaylist(r.Context(), playlist)
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't update playlist", err)
+		return
+	}
+
+	cfg.respondWithPlaylist(w, r, http.StatusOK, playlist, userID)
+}
+
+// applyPlaylistPatch merges patch into the editable fields of playlist.
+func applyPlaylistPatch(playlist *database.Playlist, patch map[string]json.RawMessage) error {
+	for _, field := range slices.Sorted(maps.Keys(patch)) {
+		value := patch[field]
+		isNull := bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+		switch field {
+		case "title":
+			var title string
+			if isNull || json.Unmarshal(value, &title) != nil {
+				return errors.New("title must be a string")
+			}
+			if err := validateVideoTitle(title); err != nil {
+				return err
+			}
+			playlist.Title = title
+		case "description":
+			var description string
+			if !isNull {
+				if err := json.Unmarshal(value, &description); err != nil {
+					return errors.New("description must be a string or null")
+				}
+			}
+			if err := validateVideoDescription(description); err != nil {
+				return err
+			}
+			playlist.Description = description
+		case "visibility":
+			var visibility string
+			if isNull || json.Unmarshal(value, &visibility) != nil || !database.ValidVideoVisibility(visibility) {
+				return errors.New("visibility must be one of private, unlisted, public")
+			}
+			playlist.Visibility = visibility
+		case "cover_video_id":
+			if isNull {
+				playlist.CoverVideoID = nil
+				continue
+			}
+			var coverVideoID uuid.UUID
+			if err := json.Unmarshal(value, &coverVideoID); err != nil {
+				return errors.New("cover_video_id must be a video ID or null")
+			}
+			playlist.CoverVideoID = &coverVideoID
+		default:
+			return fmt.Errorf("%s can't be edited", field)
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handlerPlaylistDelete(w http.ResponseWriter, r *http.Request) {
+	playlist, _, ok := cfg.ownedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.db.DeletePlaylist(r.Context(), playlist.ID); err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't delete playlist", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerPlaylistVideosAdd appends a video to a playlist. Any video the
+// caller can see can be added, not just their own.
+func (cfg *apiConfig) handlerPlaylistVideosAdd(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoID uuid.UUID `json:"video_id"`
+	}
+
+	playlist, userID, ok := cfg.ownedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	video, _, err := cfg.authorizeVideo(r.Context(), params.VideoID, userID, database.VideoRoleViewer)
+	if err != nil {
+		respondWithError(w, authorizeErrorStatus(err), "Couldn't get video", err)
+		return
+	}
+
+	err = cfg.db.AddPlaylistVideo(r.Context(), playlist.ID, video.ID)
+	if errors.Is(err, database.ErrConflict) {
+		respondWithError(w, http.StatusConflict, "Video is already in the playlist", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't add video", err)
+		return
+	}
+
+	cfg.respondWithPlaylistByID(w, r, http.StatusOK, playlist.ID, userID)
+}
+
+func (cfg *apiConfig) handlerPlaylistVideosRemove(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	playlist, _, ok := cfg.ownedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.db.RemovePlaylistVideo(r.Context(), playlist.ID, videoID); err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't remove video", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerPlaylistVideosReorder takes the playlist's video IDs in their new
+// order. Every video must be listed exactly once.
+func (cfg *apiConfig) handlerPlaylistVideosReorder(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoIDs []uuid.UUID `json:"video_ids"`
+	}
+
+	playlist, userID, ok := cfg.ownedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	err := cfg.db.ReorderPlaylistVideos(r.Context(), playlist.ID, params.VideoIDs)
+	if errors.Is(err, database.ErrInvalidPlaylistOrder) {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't reorder playlist", err)
+		return
+	}
+
+	cfg.respondWithPlaylistByID(w, r, http.StatusOK, playlist.ID, userID)
+}
+
+// ownedPlaylist loads the playlist named by the playlistID path value for
+// the authenticated caller, writing an error response and returning false
+// unless the caller owns it. Private playlists look missing to everyone
+// else.
+func (cfg *apiConfig) ownedPlaylist(w http.ResponseWriter, r *http.Request) (database.Playlist, uuid.UUID, bool) {
+	playlistID, err := uuid.Parse(r.PathValue("playlistID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist ID", err)
+		return database.Playlist{}, uuid.Nil, false
+	}
+
+	userID := auth.UserIDFromContext(r.Context())
+
+	playlist, err := cfg.db.GetPlaylist(r.Context(), playlistID)
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't get playlist", err)
+		return database.Playlist{}, uuid.Nil, false
+	}
+	if playlist.UserID != userID {
+		if playlist.Visibility == database.VideoVisibilityPrivate {
+			respondWithError(w, http.StatusNotFound, "Couldn't get playlist", nil)
+		} else {
+			respondWithError(w, http.StatusForbidden, "You don't own this playlist", nil)
+		}
+		return database.Playlist{}, uuid.Nil, false
+	}
+	return playlist, userID, true
+}
+
+// respondWithPlaylistByID reloads a playlist after its videos changed and
+// writes it.
+func (cfg *apiConfig) respondWithPlaylistByID(w http.ResponseWriter, r *http.Request, status int, playlistID, userID uuid.UUID) {
+	playlist, err := cfg.db.GetPlaylist(r.Context(), playlistID)
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't get playlist", err)
+		return
+	}
+	cfg.respondWithPlaylist(w, r, status, playlist, userID)
+}
+
+// respondWithPlaylist writes a playlist with the signed videos in it that
+// userID can see.
+func (cfg *apiConfig) respondWithPlaylist(w http.ResponseWriter, r *http.Request, status int, playlist database.Playlist, userID uuid.UUID) {
+	videos, err := cfg.db.GetPlaylistVideos(r.Context(), playlist.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist videos", err)
+		return
+	}
+
+	visible := []database.Video{}
+	for _, video := range videos {
+		if video.Visibility == database.VideoVisibilityPrivate {
+			role, err := cfg.videoRole(r.Context(), video, userID)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't check video access", err)
+				return
+			}
+			if role == "" {
+				continue
+			}
+		}
+		videoWithSignedURL, err := cfg.DbVideoToSignedVideo(video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get signed video URL", err)
+			return
+		}
+		visible = append(visible, videoWithSignedURL)
+	}
+
+	respondWithJSON(w, status, playlistResponse{Playlist: playlist, Videos: visible})
+}
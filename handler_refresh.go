@@ -1,15 +1,21 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
+// handlerRefresh exchanges a refresh token for a new access token and a new
+// refresh token. The presented token is revoked; presenting it again revokes
+// every token rotated from the same login.
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	refreshToken, err := auth.GetBearerToken(r.Header)
@@ -18,24 +24,40 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.GetUserByRefreshToken(refreshToken)
+	nextToken, err := auth.MakeRefreshToken()
 	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token", err)
+		return
+	}
+
+	rt, err := cfg.db.RotateRefreshToken(r.Context(), auth.HashToken(refreshToken), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(nextToken),
+		ExpiresAt: time.Now().UTC().Add(time.Hour * 24 * 60),
+		UserAgent: clientUserAgent(r),
+		IPAddress: clientIP(r),
+	})
+	if errors.Is(err, database.ErrRefreshTokenReused) {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token was already used; session revoked", err)
+		return
+	}
+	if errors.Is(err, database.ErrNotFound) {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
 		return
 	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't rotate refresh token", err)
+		return
+	}
 
-	accessToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.jwtSecret,
-		time.Hour,
-	)
+	accessToken, err := cfg.jwtKeys.MakeJWT(rt.UserID, rt.FamilyID, auth.ScopesFromStrings(rt.Scopes))
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate token", err)
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, response{
-		Token: accessToken,
+		Token:        accessToken,
+		RefreshToken: nextToken,
 	})
 }
 
@@ -46,9 +68,9 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = cfg.db.RevokeRefreshToken(refreshToken)
+	err = cfg.db.RevokeRefreshToken(r.Context(), auth.HashToken(refreshToken))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+		respondWithError(w, storeErrorStatus(err), "Couldn't revoke session", err)
 		return
 	}
 
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxUserAgentLength caps what a client can make us store for each session.
+const maxUserAgentLength = 512
+
+type sessionResponse struct {
+	database.Session
+	// Current marks the session the request's access token came from.
+	Current bool `json:"current"`
+}
+
+// handlerSessionsList returns the caller's active sessions, one per login,
+// most recently used first.
+func (cfg *apiConfig) handlerSessionsList(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserIDFromContext(r.Context())
+	current := auth.SessionIDFromContext(r.Context())
+
+	sessions, err := cfg.db.GetSessions(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get sessions", err)
+		return
+	}
+
+	res := make([]sessionResponse, len(sessions))
+	for i, session := range sessions {
+		res[i] = sessionResponse{
+			Session: session,
+			Current: current != uuid.Nil && session.ID == current,
+		}
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// handlerSessionRevoke logs one of the caller's sessions out. Its refresh
+// token stops working at once; access tokens already issued from it last
+// until they expire.
+func (cfg *apiConfig) handlerSessionRevoke(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserIDFromContext(r.Context())
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID", err)
+		return
+	}
+
+	if err := cfg.db.RevokeSession(r.Context(), userID, sessionID); err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't revoke session", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerSessionsRevokeOthers logs the caller out everywhere except the
+// session the request came from. An access token from before sessions were
+// tracked can't name its session, so that logs out everywhere.
+func (cfg *apiConfig) handlerSessionsRevokeOthers(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserIDFromContext(r.Context())
+	current := auth.SessionIDFromContext(r.Context())
+
+	if err := cfg.db.RevokeOtherSessions(r.Context(), userID, current); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clientIP returns the address the request came from. Forwarding headers
+// aren't trusted, so behind a proxy this is the proxy's address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func clientUserAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+	return ua
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// handlerTagsList autocompletes the caller's tags. It returns the tags on
+// their videos that start with the prefix query parameter, most used first.
+func (cfg *apiConfig) handlerTagsList(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserIDFromContext(r.Context())
+
+	query := r.URL.Query()
+	params := database.ListTagsParams{
+		UserID: userID,
+		Prefix: query.Get("prefix"),
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > database.MaxTagPageSize {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", database.MaxTagPageSize), err)
+			return
+		}
+		params.Limit = limit
+	}
+
+	tags, err := cfg.db.ListTags(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list tags", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, tags)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestTags(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signup(t, "owner@example.com")
+	other := api.signup(t, "other@example.com")
+
+	var hike, drive database.Video
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", owner.Token, map[string]any{"title": "Hike", "tags": []string{"Road Trip", "outdoors", "50%_off"}}, &hike)
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", owner.Token, map[string]any{"title": "Drive", "tags": []string{"road  trip"}}, &drive)
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", other.Token, map[string]any{"title": "Theirs", "tags": []string{"road trip"}}, nil)
+	if !slices.Equal(hike.Tags, []string{"50%_off", "outdoors", "road trip"}) {
+		t.Fatalf("created tags = %q", hike.Tags)
+	}
+
+	tags := func(query string) []database.Tag {
+		t.Helper()
+		var tags []database.Tag
+		api.expectStatus(t, http.StatusOK, "GET", "/api/tags?"+query, owner.Token, nil, &tags)
+		return tags
+	}
+	if got := tags(""); len(got) != 3 || got[0] != (database.Tag{Name: "road trip", VideoCount: 2}) {
+		t.Fatalf("GET /api/tags = %+v", got)
+	}
+	if got := tags("prefix=" + url.QueryEscape("50%_")); len(got) != 1 || got[0].Name != "50%_off" {
+		t.Fatalf("GET /api/tags with wildcards in the prefix = %+v", got)
+	}
+	if got := tags("prefix=" + url.QueryEscape("%")); len(got) != 0 {
+		t.Fatalf("GET /api/tags with prefix %% = %+v", got)
+	}
+	if got := tags("limit=1"); len(got) != 1 {
+		t.Fatalf("GET /api/tags?limit=1 = %+v", got)
+	}
+	for _, query := range []string{"limit=0", "limit=51", "limit=ten"} {
+		api.expectStatus(t, http.StatusBadRequest, "GET", "/api/tags?"+query, owner.Token, nil, nil)
+	}
+
+	var page database.VideoPage
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos?tag=road+trip&tag=outdoors", owner.Token, nil, &page)
+	if got := titles(page.Videos); !slices.Equal(got, []string{"Hike"}) {
+		t.Fatalf("GET /api/videos tagged road trip and outdoors = %q", got)
+	}
+
+	// Replacing tags drops the ones no video uses any more, and search
+	// follows.
+	api.expectStatus(t, http.StatusOK, "PATCH", "/api/videos/"+hike.ID.String(), owner.Token, map[string]any{"tags": []string{"mountains"}}, nil)
+	if got := tags("prefix=out"); len(got) != 0 {
+		t.Fatalf("GET /api/tags after removing outdoors = %+v", got)
+	}
+	var res struct {
+		Results []database.VideoSearchResult `json:"results"`
+	}
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos/search?q=mountains", owner.Token, nil, &res)
+	if len(res.Results) != 1 || res.Results[0].ID != hike.ID {
+		t.Fatalf("search by a new tag = %+v", res.Results)
+	}
+
+	// Tags are checked like the rest of the video.
+	api.expectStatus(t, http.StatusBadRequest, "PATCH", "/api/videos/"+drive.ID.String(), owner.Token, map[string]any{"tags": []string{strings.Repeat("x", maxTagLength+1)}}, nil)
+	many := make([]string, maxVideoTags+1)
+	for i := range many {
+		many[i] = strings.Repeat("t", i+1)
+	}
+	api.expectStatus(t, http.StatusBadRequest, "POST", "/api/videos", owner.Token, map[string]any{"title": "Tagged", "tags": many}, nil)
+}
+
+// titles returns the titles of videos, in order.
+func titles(videos []database.Video) []string {
+	out := []string{}
+	for _, v := range videos {
+		out = append(out, v.Title)
+	}
+	return out
+}
@@ -12,6 +12,7 @@ import (
 	"strings"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/google/uuid"
 )
@@ -26,26 +27,14 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
+	userID := auth.UserIDFromContext(r.Context())
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	videoMetadata, _, err := cfg.authorizeVideo(r.Context(), videoID, userID, database.VideoRoleEditor)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithError(w, authorizeErrorStatus(err), "Couldn't get video", err)
 		return
 	}
-
-	videoMetadata, err := cfg.db.GetVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Video not found", err)
-		return
-	}
-
-	if videoMetadata.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "User does not have access to this video", nil)
+	if !cfg.requireVerifiedEmail(w, r, userID) {
 		return
 	}
 
@@ -116,10 +105,23 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 
 	thumbnailURL := fmt.Sprintf("http://localhost:%s/assets/%s", cfg.port, thumbnailName)
 
+	previousThumbnailURL := videoMetadata.ThumbnailURL
 	videoMetadata.ThumbnailURL = &thumbnailURL
 
-	if err = cfg.db.UpdateVideo(videoMetadata); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't update video metadata", err)
+	err = cfg.db.WithTx(r.Context(), func(tx database.Store) error {
+		updated, err := tx.UpdateVideo(r.Context(), videoMetadata)
+		if err != nil {
+			return err
+		}
+		videoMetadata = updated
+		if err := enqueueThumbnailCleanup(r.Context(), tx, previousThumbnailURL); err != nil {
+			return err
+		}
+		return enqueueVideoEvent(r.Context(), tx, webhookEventThumbnailUpdated, videoMetadata)
+	})
+	if err != nil {
+		os.Remove(thumbnailPath)
+		respondWithError(w, storeErrorStatus(err), "Couldn't update video metadata", err)
 		return
 	}
 
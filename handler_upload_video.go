@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,6 +13,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
@@ -30,26 +32,14 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
-		return
-	}
+	userID := auth.UserIDFromContext(r.Context())
 
-	videoMetadata, err := cfg.db.GetVideo(videoID)
+	videoMetadata, _, err := cfg.authorizeVideo(r.Context(), videoID, userID, database.VideoRoleEditor)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		respondWithError(w, authorizeErrorStatus(err), "Couldn't get video", err)
 		return
 	}
-
-	if videoMetadata.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "User does not have access to this video", nil)
+	if !cfg.requireVerifiedEmail(w, r, userID) {
 		return
 	}
 
@@ -117,14 +107,108 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	aspectRatio, err := GetVideoAspectRatio(tempFile.Name())
-	log.Printf("Aspect ratio: %s", aspectRatio)
+	_, err = cfg.markVideoUploaded(r.Context(), videoMetadata.ID)
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't update video status", err)
+		return
+	}
 
+	videoMetadata, err = cfg.storeVideoFile(r.Context(), videoMetadata.ID, tempFile.Name())
+	if err != nil {
+		var fileErr *videoFileError
+		if errors.As(err, &fileErr) {
+			respondWithError(w, fileErr.status, fileErr.msg, fileErr.err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store video", err)
+		return
+	}
+
+	videoWithSignedURL, err := cfg.DbVideoToSignedVideo(videoMetadata)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't get video aspect ratio", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get signed video URL", err)
 		return
 	}
 
+	respondWithJSON(w, http.StatusOK, videoWithSignedURL)
+}
+
+// videoFileError is a step of storing a video file that failed, with the
+// status and message to report to whoever sent the file.
+type videoFileError struct {
+	status int
+	msg    string
+	err    error
+}
+
+func (e *videoFileError) Error() string {
+	if e.err == nil {
+		return e.msg
+	}
+	return e.msg + ": " + e.err.Error()
+}
+
+func (e *videoFileError) Unwrap() error {
+	return e.err
+}
+
+// setVideoStatus changes a video's status and queues the webhook event for
+// the change. The video is reloaded first, so edits made while its file was
+// being handled aren't overwritten.
+func setVideoStatus(ctx context.Context, tx database.Store, videoID uuid.UUID, status, eventType string, update func(*database.Video)) (database.Video, error) {
+	video, err := tx.GetVideo(ctx, videoID)
+	if err != nil {
+		return database.Video{}, err
+	}
+	video.Status = status
+	if update != nil {
+		update(&video)
+	}
+	video, err = tx.UpdateVideo(ctx, video)
+	if err != nil {
+		return database.Video{}, err
+	}
+	return video, enqueueVideoEvent(ctx, tx, eventType, video)
+}
+
+// markVideoUploaded marks a video as processing once a new file for it has
+// arrived, notifying webhooks that it was uploaded.
+func (cfg *apiConfig) markVideoUploaded(ctx context.Context, videoID uuid.UUID) (database.Video, error) {
+	var video database.Video
+	err := cfg.db.WithTx(ctx, func(tx database.Store) error {
+		var err error
+		video, err = setVideoStatus(ctx, tx, videoID, database.VideoStatusProcessing, webhookEventVideoUploaded, nil)
+		return err
+	})
+	return video, err
+}
+
+// storeVideoFile puts the video file at path through the same pipeline
+// whichever way it arrived: probe it, make it fast-start, upload it to S3 and
+// point the video at it. The video should already be marked processing. If a
+// step fails, the video is marked failed, keeping any file it had before, and
+// the error is a *videoFileError.
+func (cfg *apiConfig) storeVideoFile(ctx context.Context, videoID uuid.UUID, path string) (database.Video, error) {
+	video, err := cfg.processVideoFile(ctx, videoID, path)
+	if err != nil {
+		cfg.markVideoFailed(ctx, videoID)
+		return database.Video{}, err
+	}
+	return video, nil
+}
+
+func (cfg *apiConfig) processVideoFile(ctx context.Context, videoID uuid.UUID, path string) (database.Video, error) {
+	aspectRatio, err := GetVideoAspectRatio(path)
+	if err != nil {
+		return database.Video{}, &videoFileError{http.StatusInternalServerError, "Couldn't get video aspect ratio", err}
+	}
+	log.Printf("Aspect ratio: %s", aspectRatio)
+
+	duration, err := GetVideoDuration(path)
+	if err != nil {
+		return database.Video{}, &videoFileError{http.StatusInternalServerError, "Couldn't get video duration", err}
+	}
+
 	filePrefixMap := map[string]string{
 		"16:9":  "landscape",
 		"9:16":  "portrait",
@@ -133,49 +217,30 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 
 	filePrefix := filePrefixMap[aspectRatio]
 	if filePrefix == "" {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't get video aspect ratio", err)
-		return
+		return database.Video{}, &videoFileError{http.StatusInternalServerError, "Couldn't get video aspect ratio", nil}
 	}
 
 	// Verify file was copied correctly
-	fileInfo, err := tempFile.Stat()
+	fileInfo, err := os.Stat(path)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't get file info", err)
-		return
+		return database.Video{}, &videoFileError{http.StatusInternalServerError, "Couldn't get file info", err}
 	}
 	if fileInfo.Size() == 0 {
-		respondWithError(w, http.StatusInternalServerError, "File is empty after copy", nil)
-		return
-	}
-	log.Printf("Temp file size after copy: %d bytes", fileInfo.Size())
-
-	_, err = tempFile.Seek(0, io.SeekStart)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't reset file pointer", err)
-		return
-	}
-
-	// Get file info to verify content
-	fileInfo, err = tempFile.Stat()
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't get file info", err)
-		return
+		return database.Video{}, &videoFileError{http.StatusInternalServerError, "File is empty after copy", nil}
 	}
 	log.Printf("Temp file size: %d bytes", fileInfo.Size())
 
 	key := fmt.Sprintf("/%s/%s.mp4", filePrefix, uuid.New().String())
 
-	processedFilePath, err := ProcessVideoForFastStart(tempFile.Name())
+	processedFilePath, err := ProcessVideoForFastStart(path)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't process video for fast start", err)
-		return
+		return database.Video{}, &videoFileError{http.StatusInternalServerError, "Couldn't process video for fast start", err}
 	}
 	defer os.Remove(processedFilePath)
 
 	processedFile, err := os.Open(processedFilePath)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't open processed file", err)
-		return
+		return database.Video{}, &videoFileError{http.StatusInternalServerError, "Couldn't open processed file", err}
 	}
 	defer processedFile.Close()
 
@@ -185,39 +250,57 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		Bucket:       aws.String(cfg.s3Bucket),
 		Key:          aws.String(key),
 		Body:         processedFile,
-		ContentType:  aws.String(mediaType),
+		ContentType:  aws.String("video/mp4"),
 		CacheControl: aws.String("public, max-age=31536000"), // 1 year
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	s3Ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	if _, err = cfg.s3Client.PutObject(ctx, s3PutObjectInput); err != nil {
+	if _, err = cfg.s3Client.PutObject(s3Ctx, s3PutObjectInput); err != nil {
 		log.Printf("S3 upload error: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Couldn't upload video", err)
-		return
+		return database.Video{}, &videoFileError{http.StatusInternalServerError, "Couldn't upload video", err}
 	}
 
 	// Store the bucket and key for later use when generating the presigned URL
 	videoURL := fmt.Sprintf("%s,%s", cfg.s3Bucket, key)
-	videoMetadata.VideoURL = &videoURL
-
-	if err = cfg.db.UpdateVideo(videoMetadata); err != nil {
+	var video database.Video
+	err = cfg.db.WithTx(ctx, func(tx database.Store) error {
+		var previousVideoURL *string
+		var err error
+		video, err = setVideoStatus(ctx, tx, videoID, database.VideoStatusReady, webhookEventVideoProcessed, func(v *database.Video) {
+			previousVideoURL = v.VideoURL
+			v.VideoURL = &videoURL
+			v.DurationSeconds = duration
+			v.AspectRatio = &aspectRatio
+		})
+		if err != nil {
+			return err
+		}
+		return enqueueVideoFileCleanup(ctx, tx, previousVideoURL)
+	})
+	if err != nil {
 		deleteObjectInput := &s3.DeleteObjectInput{
 			Bucket: aws.String(cfg.s3Bucket),
 			Key:    aws.String(key),
 		}
 
-		_, _ = cfg.s3Client.DeleteObject(ctx, deleteObjectInput)
-		respondWithError(w, http.StatusInternalServerError, "Couldn't update video metadata", err)
-		return
+		_, _ = cfg.s3Client.DeleteObject(s3Ctx, deleteObjectInput)
+		return database.Video{}, &videoFileError{storeErrorStatus(err), "Couldn't update video metadata", err}
 	}
+	return video, nil
+}
 
-	videoWithSignedURL, err := cfg.DbVideoToSignedVideo(videoMetadata)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't get signed video URL", err)
-		return
+// markVideoFailed marks a video whose new file couldn't be stored as failed,
+// notifying webhooks. It still runs if ctx has been canceled, since the
+// video would otherwise be left processing.
+func (cfg *apiConfig) markVideoFailed(ctx context.Context, videoID uuid.UUID) {
+	ctx = context.WithoutCancel(ctx)
+	err := cfg.db.WithTx(ctx, func(tx database.Store) error {
+		_, err := setVideoStatus(ctx, tx, videoID, database.VideoStatusFailed, webhookEventVideoFailed, nil)
+		return err
+	})
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		log.Printf("Couldn't mark video %s failed: %v", videoID, err)
 	}
-
-	respondWithJSON(w, http.StatusOK, videoWithSignedURL)
 }
@@ -2,6 +2,8 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
@@ -33,14 +35,24 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, err := cfg.db.CreateUser(database.CreateUserParams{
+	user, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{
 		Email:    params.Email,
 		Password: hashedPassword,
 	})
+	if errors.Is(err, database.ErrConflict) {
+		respondWithError(w, http.StatusConflict, "Email is already registered", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create user", err)
 		return
 	}
 
+	// Signing up works even if the mail can't go out; the user can ask for
+	// another from POST /api/verify_email/resend.
+	if err := cfg.sendEmailVerification(r.Context(), *user); err != nil {
+		log.Printf("Couldn't send verification email to user %s: %v", user.ID, err)
+	}
+
 	respondWithJSON(w, http.StatusCreated, user)
 }
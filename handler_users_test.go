@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestSignupAndLogin(t *testing.T) {
+	api := newTestAPI(t)
+	res := api.signup(t, "a@example.com")
+	if res.Token == "" || res.RefreshToken == "" || res.Email != "a@example.com" {
+		t.Fatalf("login response = %+v", res)
+	}
+
+	api.expectStatus(t, http.StatusConflict, "POST", "/api/users", "", map[string]string{"email": "a@example.com", "password": "other"}, nil)
+	api.expectStatus(t, http.StatusBadRequest, "POST", "/api/users", "", map[string]string{"email": "b@example.com"}, nil)
+	api.expectStatus(t, http.StatusUnauthorized, "POST", "/api/login", "", map[string]string{"email": "a@example.com", "password": "wrong"}, nil)
+	api.expectStatus(t, http.StatusUnauthorized, "POST", "/api/login", "", map[string]string{"email": "nobody@example.com", "password": testPassword}, nil)
+	api.expectStatus(t, http.StatusBadRequest, "POST", "/api/login", "", map[string]any{"email": "a@example.com", "password": testPassword, "scopes": []string{"root"}}, nil)
+}
+
+func TestRefreshRotatesAndDetectsReuse(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.signup(t, "a@example.com")
+
+	var refreshed struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	api.expectStatus(t, http.StatusOK, "POST", "/api/refresh", login.RefreshToken, nil, &refreshed)
+	if refreshed.RefreshToken == login.RefreshToken {
+		t.Fatal("refresh returned the same refresh token")
+	}
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos", refreshed.Token, nil, nil)
+
+	// The old token was rotated out; presenting it again ends the session.
+	api.expectStatus(t, http.StatusUnauthorized, "POST", "/api/refresh", login.RefreshToken, nil, nil)
+	api.expectStatus(t, http.StatusUnauthorized, "POST", "/api/refresh", refreshed.RefreshToken, nil, nil)
+}
+
+func TestRevokeEndsSession(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.signup(t, "a@example.com")
+
+	api.expectStatus(t, http.StatusNoContent, "POST", "/api/revoke", login.RefreshToken, nil, nil)
+	api.expectStatus(t, http.StatusUnauthorized, "POST", "/api/refresh", login.RefreshToken, nil, nil)
+}
+
+func TestSessionsListAndRevoke(t *testing.T) {
+	api := newTestAPI(t)
+	first := api.signup(t, "a@example.com")
+	second := api.login(t, "a@example.com", testPassword)
+
+	var sessions []database.Session
+	api.expectStatus(t, http.StatusOK, "GET", "/api/sessions", first.Token, nil, &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("GET /api/sessions listed %d sessions, want 2", len(sessions))
+	}
+
+	api.expectStatus(t, http.StatusNoContent, "DELETE", "/api/sessions", first.Token, nil, nil)
+	api.expectStatus(t, http.StatusUnauthorized, "POST", "/api/refresh", second.RefreshToken, nil, nil)
+	api.expectStatus(t, http.StatusOK, "POST", "/api/refresh", first.RefreshToken, nil, nil)
+}
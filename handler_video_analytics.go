@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxPlaybackEventBytes = 1 << 10
+	maxSessionIDLength    = 64
+	defaultAnalyticsDays  = 30
+	maxAnalyticsDays      = 366
+	analyticsDateLayout   = "2006-01-02"
+	// playbackEventsPerMinute is how many beacons one address can send a
+	// minute, across all videos. A playback sends at most five.
+	playbackEventsPerMinute = 60
+)
+
+// handlerVideoEvents is the beacon the player calls as a video plays:
+//
+//	{ "session_id": "...", "event": "play" }
+//	{ "session_id": "...", "event": "progress", "percent": 25 }
+//	{ "session_id": "...", "event": "complete" }
+//
+// Anyone who can view the video can send events, with or without a token.
+// The session ID is chosen by the player and should be new for every
+// playback; events are deduplicated per session. Since anyone can make up
+// session IDs, each address is limited to playbackEventsPerMinute events,
+// and each viewer to database.MaxDailySessionsPerViewer sessions of a video
+// a day.
+func (cfg *apiConfig) handlerVideoEvents(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		SessionID string `json:"session_id"`
+		Event     string `json:"event"`
+		Percent   int    `json:"percent"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	if !cfg.playbackLimiter.allow(clientIP(r), time.Now()) {
+		w.Header().Set("Retry-After", "60")
+		respondWithError(w, http.StatusTooManyRequests, "Too many playback events, try again later", nil)
+		return
+	}
+
+	userID := auth.UserIDFromContext(r.Context())
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPlaybackEventBytes)
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.SessionID == "" || len(params.SessionID) > maxSessionIDLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("session_id must be 1-%d bytes", maxSessionIDLength), nil)
+		return
+	}
+
+	var percent int
+	switch params.Event {
+	case "play":
+		percent = 0
+	case "progress":
+		if params.Percent != 25 && params.Percent != 50 && params.Percent != 75 {
+			respondWithError(w, http.StatusBadRequest, "percent must be 25, 50 or 75", nil)
+			return
+		}
+		percent = params.Percent
+	case "complete":
+		percent = 100
+	default:
+		respondWithError(w, http.StatusBadRequest, "event must be one of play, progress, complete", nil)
+		return
+	}
+
+	video, _, err := cfg.authorizeVideo(r.Context(), videoID, userID, database.VideoRoleViewer)
+	if err != nil {
+		respondWithError(w, authorizeErrorStatus(err), "Couldn't get video", err)
+		return
+	}
+
+	err = cfg.db.RecordPlaybackEvent(r.Context(), database.PlaybackEvent{
+		VideoID:    video.ID,
+		SessionID:  params.SessionID,
+		ViewerHash: viewerHash(r, userID),
+		Percent:    percent,
+		At:         time.Now(),
+	})
+	if errors.Is(err, database.ErrTooManyPlaybackSessions) {
+		respondWithError(w, http.StatusTooManyRequests, "Too many playback sessions of this video today", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't record event", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// viewerHash identifies the viewer for unique-viewer counts: by account if
+// they're logged in, otherwise by address and user agent. Only the hash is
+// stored.
+func viewerHash(r *http.Request, userID uuid.UUID) string {
+	if userID != uuid.Nil {
+		return auth.HashToken("user:" + userID.String())
+	}
+	return auth.HashToken("anon:" + clientIP(r) + "|" + r.UserAgent())
+}
+
+type dailyStatsResponse struct {
+	Date                string  `json:"date"`
+	Views               int     `json:"views"`
+	UniqueViewers       int     `json:"unique_viewers"`
+	Completions         int     `json:"completions"`
+	AverageWatchPercent float64 `json:"average_watch_percent"`
+}
+
+type videoAnalyticsResponse struct {
+	VideoID             uuid.UUID            `json:"video_id"`
+	From                string               `json:"from"`
+	To                  string               `json:"to"`
+	Views               int                  `json:"views"`
+	UniqueViewers       int                  `json:"unique_viewers"`
+	Completions         int                  `json:"completions"`
+	AverageWatchPercent float64              `json:"average_watch_percent"`
+	Daily               []dailyStatsResponse `json:"daily"`
+}
+
+// handlerVideoAnalytics reports a video's playback stats to its owners. The
+// from and to query parameters are inclusive UTC dates and default to the
+// last 30 days. The daily series has an entry for every day in the range.
+func (cfg *apiConfig) handlerVideoAnalytics(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	to := database.AnalyticsDay(time.Now())
+	from := to.AddDate(0, 0, 1-defaultAnalyticsDays)
+	query := r.URL.Query()
+	for name, dest := range map[string]*time.Time{"from": &from, "to": &to} {
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(analyticsDateLayout, v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("%s must be a date like 2006-01-02", name), err)
+			return
+		}
+		*dest = t
+	}
+	if to.Before(from) {
+		respondWithError(w, http.StatusBadRequest, "from must not be after to", nil)
+		return
+	}
+	if to.Sub(from) >= maxAnalyticsDays*24*time.Hour {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("range can't be longer than %d days", maxAnalyticsDays), nil)
+		return
+	}
+
+	analytics, err := cfg.db.GetVideoAnalytics(r.Context(), video.ID, from, to)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get analytics", err)
+		return
+	}
+
+	byDay := make(map[time.Time]database.VideoDailyStats, len(analytics.Daily))
+	for _, stats := range analytics.Daily {
+		byDay[stats.Day] = stats
+	}
+	daily := []dailyStatsResponse{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		stats := byDay[day]
+		daily = append(daily, dailyStatsResponse{
+			Date:                day.Format(analyticsDateLayout),
+			Views:               stats.Views,
+			UniqueViewers:       stats.UniqueViewers,
+			Completions:         stats.Completions,
+			AverageWatchPercent: averageWatchPercent(stats.WatchPercentTotal, stats.Views),
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, videoAnalyticsResponse{
+		VideoID:             video.ID,
+		From:                from.Format(analyticsDateLayout),
+		To:                  to.Format(analyticsDateLayout),
+		Views:               analytics.Views,
+		UniqueViewers:       analytics.UniqueViewers,
+		Completions:         analytics.Completions,
+		AverageWatchPercent: averageWatchPercent(analytics.WatchPercentTotal, analytics.Views),
+		Daily:               daily,
+	})
+}
+
+func averageWatchPercent(total, views int) float64 {
+	if views == 0 {
+		return 0
+	}
+	return float64(total) / float64(views)
+}
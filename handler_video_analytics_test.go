@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// playbackEvent sends a beacon for video and fails unless it gets status.
+func (api *testAPI) playbackEvent(t *testing.T, status int, videoID, token, session, event string, percent int) *http.Response {
+	t.Helper()
+	body := map[string]any{"session_id": session, "event": event, "percent": percent}
+	return api.expectStatus(t, status, "POST", "/api/videos/"+videoID+"/events", token, body, nil)
+}
+
+func TestPlaybackAnalytics(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signup(t, "owner@example.com")
+	viewer := api.signup(t, "viewer@example.com")
+
+	var video, private database.Video
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", owner.Token, map[string]any{"title": "Watched", "visibility": "public"}, &video)
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", owner.Token, map[string]any{"title": "Private"}, &private)
+	id := video.ID.String()
+
+	// An anonymous session that finishes, with repeated and out-of-order
+	// beacons that add nothing.
+	api.playbackEvent(t, http.StatusNoContent, id, "", "anon-1", "play", 0)
+	api.playbackEvent(t, http.StatusNoContent, id, "", "anon-1", "progress", 50)
+	api.playbackEvent(t, http.StatusNoContent, id, "", "anon-1", "progress", 25)
+	api.playbackEvent(t, http.StatusNoContent, id, "", "anon-1", "complete", 0)
+	api.playbackEvent(t, http.StatusNoContent, id, "", "anon-1", "complete", 0)
+	// The same logged-in viewer twice, getting half way once.
+	api.playbackEvent(t, http.StatusNoContent, id, viewer.Token, "viewer-1", "play", 0)
+	api.playbackEvent(t, http.StatusNoContent, id, viewer.Token, "viewer-1", "progress", 50)
+	api.playbackEvent(t, http.StatusNoContent, id, viewer.Token, "viewer-2", "play", 0)
+
+	for _, bad := range []map[string]any{
+		{"session_id": "s", "event": "pause"},
+		{"session_id": "s", "event": "progress", "percent": 30},
+		{"session_id": "", "event": "play"},
+		{"session_id": strings.Repeat("s", maxSessionIDLength+1), "event": "play"},
+	} {
+		api.expectStatus(t, http.StatusBadRequest, "POST", "/api/videos/"+id+"/events", "", bad, nil)
+	}
+	// Nobody else can count views of a private video.
+	api.playbackEvent(t, http.StatusNotFound, private.ID.String(), "", "anon-2", "play", 0)
+	api.playbackEvent(t, http.StatusNotFound, private.ID.String(), viewer.Token, "viewer-3", "play", 0)
+
+	today := time.Now().UTC().Format(analyticsDateLayout)
+	var got videoAnalyticsResponse
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos/"+id+"/analytics?from="+today+"&to="+today, owner.Token, nil, &got)
+	want := dailyStatsResponse{Date: today, Views: 3, UniqueViewers: 2, Completions: 1, AverageWatchPercent: 50}
+	if got.Views != want.Views || got.UniqueViewers != want.UniqueViewers || got.Completions != want.Completions || got.AverageWatchPercent != want.AverageWatchPercent {
+		t.Fatalf("analytics = %+v, want totals like %+v", got, want)
+	}
+	if len(got.Daily) != 1 || got.Daily[0] != want {
+		t.Fatalf("daily = %+v, want [%+v]", got.Daily, want)
+	}
+
+	// The default range is the last 30 days, with every day in it.
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos/"+id+"/analytics", owner.Token, nil, &got)
+	if len(got.Daily) != defaultAnalyticsDays || got.Daily[defaultAnalyticsDays-1].Date != today || got.Views != 3 {
+		t.Fatalf("default range = %s to %s with %d days and %d views", got.From, got.To, len(got.Daily), got.Views)
+	}
+
+	api.expectStatus(t, http.StatusForbidden, "GET", "/api/videos/"+id+"/analytics", viewer.Token, nil, nil)
+	for _, query := range []string{"from=yesterday", "from=2025-02-01&to=2025-01-01", "from=2024-01-01&to=2025-01-02"} {
+		api.expectStatus(t, http.StatusBadRequest, "GET", "/api/videos/"+id+"/analytics?"+query, owner.Token, nil, nil)
+	}
+}
+
+func TestPlaybackEventsAreLimited(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signup(t, "owner@example.com")
+	viewer := api.signup(t, "viewer@example.com")
+	var video database.Video
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", owner.Token, map[string]any{"title": "Popular", "visibility": "public"}, &video)
+	id := video.ID.String()
+
+	// A viewer can only start so many sessions of a video a day, whatever
+	// session IDs they make up.
+	for i := range database.MaxDailySessionsPerViewer {
+		api.playbackEvent(t, http.StatusNoContent, id, viewer.Token, fmt.Sprintf("s%d", i), "play", 0)
+	}
+	api.playbackEvent(t, http.StatusTooManyRequests, id, viewer.Token, "one-more", "play", 0)
+	api.playbackEvent(t, http.StatusNoContent, id, viewer.Token, "s0", "complete", 0)
+
+	var got videoAnalyticsResponse
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos/"+id+"/analytics", owner.Token, nil, &got)
+	if got.Views != database.MaxDailySessionsPerViewer || got.UniqueViewers != 1 || got.Completions != 1 {
+		t.Fatalf("analytics = %+v", got)
+	}
+
+	// Each address can only send so many events a minute. Every request in
+	// these tests comes from the same address.
+	sent := database.MaxDailySessionsPerViewer + 2
+	for i := sent; i < playbackEventsPerMinute; i++ {
+		api.playbackEvent(t, http.StatusNoContent, id, "", "anon", "play", 0)
+	}
+	res := api.playbackEvent(t, http.StatusTooManyRequests, id, "", "anon", "play", 0)
+	if res.Header.Get("Retry-After") == "" {
+		t.Fatal("429 without Retry-After")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2, time.Minute)
+	now := time.Now()
+	if !limiter.allow("a", now) || !limiter.allow("a", now) || limiter.allow("a", now.Add(59*time.Second)) {
+		t.Fatal("limiter didn't allow exactly 2 requests in the window")
+	}
+	if !limiter.allow("b", now) {
+		t.Fatal("limiter limited another key")
+	}
+	if !limiter.allow("a", now.Add(time.Minute)) {
+		t.Fatal("limiter didn't start a new window")
+	}
+}
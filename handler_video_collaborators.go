@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerVideoCollaboratorsSet grants a user, named by email, a role on a
+// video. Granting a role to someone who already has one replaces it.
+func (cfg *apiConfig) handlerVideoCollaboratorsSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string             `json:"email"`
+		Role  database.VideoRole `json:"role"`
+	}
+
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !params.Role.Valid() {
+		respondWithError(w, http.StatusBadRequest, "role must be viewer, editor or owner", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't find user", err)
+		return
+	}
+	if user.ID == video.UserID {
+		respondWithError(w, http.StatusConflict, "The video's creator is always an owner", nil)
+		return
+	}
+
+	collaborator, err := cfg.db.SetVideoCollaborator(r.Context(), video.ID, user.ID, params.Role)
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't grant role", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, collaborator)
+}
+
+func (cfg *apiConfig) handlerVideoCollaboratorsList(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	collaborators, err := cfg.db.GetVideoCollaborators(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get collaborators", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, collaborators)
+}
+
+func (cfg *apiConfig) handlerVideoCollaboratorsDelete(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.db.DeleteVideoCollaborator(r.Context(), video.ID, userID); err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't remove collaborator", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
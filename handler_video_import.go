@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerVideoImport sets a video's file from a URL instead of an upload:
+//
+//	{ "url": "https://example.com/video.mp4" }
+//
+// The download runs in the background, so this responds 202 with the video
+// marked processing. It then becomes ready or failed as it would after an
+// upload, and webhooks hear about it the same way.
+func (cfg *apiConfig) handlerVideoImport(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		URL string `json:"url"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	userID := auth.UserIDFromContext(r.Context())
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	importURL, err := url.Parse(params.URL)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "url must be an http or https URL", err)
+		return
+	}
+	if err := validateImportURL(importURL); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	video, _, err := cfg.authorizeVideo(r.Context(), videoID, userID, database.VideoRoleEditor)
+	if err != nil {
+		respondWithError(w, authorizeErrorStatus(err), "Couldn't get video", err)
+		return
+	}
+	if !cfg.requireVerifiedEmail(w, r, userID) {
+		return
+	}
+	// A video left processing for longer than an import can take was
+	// interrupted, most likely by a restart, so it can be imported again.
+	if video.Status == database.VideoStatusProcessing && time.Since(video.UpdatedAt) < videoImportTimeout {
+		respondWithError(w, http.StatusConflict, "Video is already processing", nil)
+		return
+	}
+
+	// Claim the video with a conditional write, so two imports started at
+	// once can't both run.
+	video.Status = database.VideoStatusProcessing
+	video, err = cfg.db.UpdateVideoIfUnmodified(r.Context(), video, video.UpdatedAt)
+	if errors.Is(err, database.ErrStale) {
+		respondWithError(w, http.StatusConflict, "Video changed while starting the import, try again", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't update video status", err)
+		return
+	}
+
+	go cfg.importVideo(video.ID, importURL.String())
+
+	videoWithSignedURL, err := cfg.DbVideoToSignedVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get signed video URL", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, videoWithSignedURL)
+}
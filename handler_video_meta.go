@@ -1,49 +1,90 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"mime"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
+const (
+	maxVideoTitleLength      = 200  // characters
+	maxVideoDescriptionBytes = 5000 // bytes
+	maxVideoPatchBytes       = 1 << 16
+	maxVideoTags             = 20
+	maxTagLength             = 50 // characters
+)
+
 func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		database.CreateVideoParams
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
-		return
-	}
+	userID := auth.UserIDFromContext(r.Context())
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	err := decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
 		return
 	}
 	params.UserID = userID
 
-	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
+	if err := validateVideoTitle(params.Title); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if err := validateVideoDescription(params.Description); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if params.Visibility != "" && !database.ValidVideoVisibility(params.Visibility) {
+		respondWithError(w, http.StatusBadRequest, "visibility must be one of private, unlisted, public", nil)
+		return
+	}
+	params.Tags, err = normalizeVideoTags(params.Tags)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
 
+	var video database.Video
+	err = cfg.db.WithTx(r.Context(), func(tx database.Store) error {
+		created, err := tx.CreateVideo(r.Context(), params.CreateVideoParams)
+		if err != nil {
+			return err
+		}
+		video = created
+		return enqueueVideoEvent(r.Context(), tx, webhookEventVideoCreated, video)
+	})
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't create video", err)
+		return
+	}
+
+	w.Header().Set("ETag", videoETag(video))
 	respondWithJSON(w, http.StatusCreated, video)
 }
 
-func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
+// handlerVideoMetaUpdate edits a video's title, description, visibility and
+// tags with a JSON merge patch (RFC 7396). Clients that send If-Match with the
+// video's ETag get 412 Precondition Failed instead of overwriting someone
+// else's edit.
+func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Request) {
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
 	if err != nil {
@@ -51,30 +92,212 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	userID := auth.UserIDFromContext(r.Context())
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/merge-patch+json", err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxVideoPatchBytes)
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		respondWithError(w, http.StatusBadRequest, "Patch must be a JSON object", err)
+		return
+	}
+
+	video, role, err := cfg.authorizeVideo(r.Context(), videoID, userID, database.VideoRoleEditor)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, authorizeErrorStatus(err), "Couldn't get video", err)
+		return
+	}
+	if _, ok := patch["visibility"]; ok && !role.Includes(database.VideoRoleOwner) {
+		respondWithError(w, http.StatusForbidden, "Only owners can change a video's visibility", nil)
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && !matchesETag(ifMatch, videoETag(video)) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video has been modified", nil)
+		return
+	}
+
+	if err := applyVideoPatch(&video, patch); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	err = cfg.db.WithTx(r.Context(), func(tx database.Store) error {
+		var updated database.Video
+		var err error
+		if ifMatch != "" {
+			// Guard the write too, in case another edit lands between the
+			// read above and this update.
+			updated, err = tx.UpdateVideoIfUnmodified(r.Context(), video, video.UpdatedAt)
+		} else {
+			updated, err = tx.UpdateVideo(r.Context(), video)
+		}
+		if err != nil {
+			return err
+		}
+		video = updated
+		return enqueueVideoEvent(r.Context(), tx, webhookEventVideoUpdated, video)
+	})
+	if errors.Is(err, database.ErrStale) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video has been modified", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithError(w, storeErrorStatus(err), "Couldn't update video", err)
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	videoWithSignedURL, err := cfg.DbVideoToSignedVideo(video)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get signed video URL", err)
 		return
 	}
-	if video.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "You can't delete this video", err)
+
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, videoWithSignedURL)
+}
+
+// applyVideoPatch merges patch into the editable fields of video. A null
+// description or tags clears them; the title can be changed but not removed.
+// Tags are replaced as a whole.
+func applyVideoPatch(video *database.Video, patch map[string]json.RawMessage) error {
+	for _, field := range slices.Sorted(maps.Keys(patch)) {
+		value := patch[field]
+		isNull := bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+		switch field {
+		case "title":
+			var title string
+			if isNull || json.Unmarshal(value, &title) != nil {
+				return errors.New("title must be a string")
+			}
+			if err := validateVideoTitle(title); err != nil {
+				return err
+			}
+			video.Title = title
+		case "description":
+			var description string
+			if !isNull {
+				if err := json.Unmarshal(value, &description); err != nil {
+					return errors.New("description must be a string or null")
+				}
+			}
+			if err := validateVideoDescription(description); err != nil {
+				return err
+			}
+			video.Description = description
+		case "visibility":
+			var visibility string
+			if isNull || json.Unmarshal(value, &visibility) != nil || !database.ValidVideoVisibility(visibility) {
+				return errors.New("visibility must be one of private, unlisted, public")
+			}
+			video.Visibility = visibility
+		case "tags":
+			var tags []string
+			if !isNull {
+				if err := json.Unmarshal(value, &tags); err != nil {
+					return errors.New("tags must be an array of strings or null")
+				}
+			}
+			tags, err := normalizeVideoTags(tags)
+			if err != nil {
+				return err
+			}
+			video.Tags = tags
+		default:
+			return fmt.Errorf("%s can't be edited", field)
+		}
+	}
+	return nil
+}
+
+func validateVideoTitle(title string) error {
+	if strings.TrimSpace(title) == "" {
+		return errors.New("title can't be empty")
+	}
+	if utf8.RuneCountInString(title) > maxVideoTitleLength {
+		return fmt.Errorf("title can't be longer than %d characters", maxVideoTitleLength)
+	}
+	return nil
+}
+
+func validateVideoDescription(description string) error {
+	if len(description) > maxVideoDescriptionBytes {
+		return fmt.Errorf("description can't be larger than %d bytes", maxVideoDescriptionBytes)
+	}
+	return nil
+}
+
+// normalizeVideoTags normalizes tags and checks there aren't too many or any
+// that are too long. The result is never nil, so it replaces a video's tags
+// even when empty.
+func normalizeVideoTags(tags []string) ([]string, error) {
+	tags = database.NormalizeTags(tags)
+	if len(tags) > maxVideoTags {
+		return nil, fmt.Errorf("a video can't have more than %d tags", maxVideoTags)
+	}
+	for _, tag := range tags {
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, fmt.Errorf("tags can't be longer than %d characters", maxTagLength)
+		}
+	}
+	return tags, nil
+}
+
+// videoETag identifies one version of a video's metadata. Every write stamps
+// updated_at, so the tag changes whenever the video does.
+func videoETag(video database.Video) string {
+	return `"` + strconv.FormatInt(video.UpdatedAt.UnixMicro(), 36) + `"`
+}
+
+// matchesETag reports whether an If-Match header lists etag or is "*".
+func matchesETag(ifMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	userID := auth.UserIDFromContext(r.Context())
+
+	video, _, err := cfg.authorizeVideo(r.Context(), videoID, userID, database.VideoRoleOwner)
+	if err != nil {
+		respondWithError(w, authorizeErrorStatus(err), "Couldn't get video", err)
+		return
+	}
+
+	// Delete the row and queue its files for removal atomically, so a failed
+	// delete never loses track of what is stored.
+	err = cfg.db.WithTx(r.Context(), func(tx database.Store) error {
+		if err := tx.DeleteVideo(r.Context(), videoID); err != nil {
+			return err
+		}
+		if err := enqueueVideoFileCleanup(r.Context(), tx, video.VideoURL); err != nil {
+			return err
+		}
+		if err := enqueueThumbnailCleanup(r.Context(), tx, video.ThumbnailURL); err != nil {
+			return err
+		}
+		return enqueueVideoEvent(r.Context(), tx, webhookEventVideoDeleted, video)
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
+		respondWithError(w, storeErrorStatus(err), "Couldn't delete video", err)
 		return
 	}
 
@@ -89,9 +312,13 @@ func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	// Authentication is optional: unlisted and public videos need none, and
+	// private videos look missing to anyone without a role on them.
+	userID := auth.UserIDFromContext(r.Context())
+
+	video, _, err := cfg.authorizeVideo(r.Context(), videoID, userID, database.VideoRoleViewer)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithError(w, authorizeErrorStatus(err), "Couldn't get video", err)
 		return
 	}
 
@@ -101,35 +328,190 @@ func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", videoETag(video))
 	respondWithJSON(w, http.StatusOK, videoWithSignedURL)
 }
 
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+	userID := auth.UserIDFromContext(r.Context())
+
+	params, err := parseListVideosParams(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	params.UserID = userID
+
+	page, err := cfg.db.ListVideos(r.Context(), params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	// Only the videos on this page are signed.
+	cfg.respondWithVideoPage(w, page)
+}
+
+// handlerVideosShared lists the videos other users have granted the caller a
+// role on. It takes the same query parameters as GET /api/videos.
+func (cfg *apiConfig) handlerVideosShared(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserIDFromContext(r.Context())
+
+	params, err := parseListVideosParams(r.URL.Query())
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	params.SharedWith = userID
+
+	page, err := cfg.db.ListVideos(r.Context(), params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	cfg.respondWithVideoPage(w, page)
+}
+
+// handlerPublicVideosRetrieve lists public videos without authentication. It
+// takes the same query parameters as GET /api/videos, plus user_id to list a
+// single user's public videos.
+func (cfg *apiConfig) handlerPublicVideosRetrieve(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	params, err := parseListVideosParams(query)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
+	if v := query.Get("user_id"); v != "" {
+		params.UserID, err = uuid.Parse(v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "user_id must be a UUID", err)
+			return
+		}
+	}
+	params.Visibility = database.VideoVisibilityPublic
 
-	videos, err := cfg.db.GetVideos(userID)
+	page, err := cfg.db.ListVideos(r.Context(), params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
-	for i, video := range videos {
+	cfg.respondWithVideoPage(w, page)
+}
+
+// respondWithVideoPage signs the videos on one page of a listing and writes it.
+func (cfg *apiConfig) respondWithVideoPage(w http.ResponseWriter, page database.VideoPage) {
+	for i, video := range page.Videos {
 		videoWithSignedURL, err := cfg.DbVideoToSignedVideo(video)
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, "Couldn't get signed video URL", err)
 			return
 		}
-		videos[i] = videoWithSignedURL
+		page.Videos[i] = videoWithSignedURL
+	}
+
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+// parseListVideosParams reads the pagination, sort and filter query parameters
+// of GET /api/videos:
+//
+//	limit          page size, 1-100 (default 25)
+//	after          next_cursor from the previous page
+//	sort           created, updated, title or duration (default created)
+//	order          asc or desc (default desc)
+//	status         draft, processing, ready or failed
+//	has_video      true or false
+//	created_after  RFC 3339 timestamp, inclusive
+//	created_before RFC 3339 timestamp, exclusive
+//	aspect_ratio   16:9, 9:16 or other
+//	visibility     private, unlisted or public
+//	tag            repeatable; videos must carry every tag
+func parseListVideosParams(query url.Values) (database.ListVideosParams, error) {
+	params := database.ListVideosParams{
+		After:       query.Get("after"),
+		Sort:        database.VideoSortCreated,
+		Status:      query.Get("status"),
+		Visibility:  query.Get("visibility"),
+		AspectRatio: query.Get("aspect_ratio"),
+		Tags:        query["tag"],
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > database.MaxVideoPageSize {
+			return params, fmt.Errorf("limit must be between 1 and %d", database.MaxVideoPageSize)
+		}
+		params.Limit = limit
+	}
+
+	if v := query.Get("sort"); v != "" {
+		params.Sort = database.VideoSort(v)
+		if !params.Sort.Valid() {
+			return params, fmt.Errorf("sort must be one of created, updated, title, duration")
+		}
+	}
+
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		params.Ascending = true
+	default:
+		return params, fmt.Errorf("order must be asc or desc")
+	}
+
+	switch params.Status {
+	case "", database.VideoStatusDraft, database.VideoStatusProcessing, database.VideoStatusReady, database.VideoStatusFailed:
+	default:
+		return params, fmt.Errorf("status must be one of draft, processing, ready, failed")
+	}
+
+	if v := query.Get("has_video"); v != "" {
+		hasVideo, err := strconv.ParseBool(v)
+		if err != nil {
+			return params, fmt.Errorf("has_video must be true or false")
+		}
+		params.HasVideo = &hasVideo
+	}
+
+	for name, dest := range map[string]**time.Time{
+		"created_after":  &params.CreatedAfter,
+		"created_before": &params.CreatedBefore,
+	} {
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return params, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+		}
+		*dest = &t
+	}
+
+	switch params.AspectRatio {
+	case "", "16:9", "9:16", "other":
+	default:
+		return params, fmt.Errorf("aspect_ratio must be one of 16:9, 9:16, other")
+	}
+
+	if params.Visibility != "" && !database.ValidVideoVisibility(params.Visibility) {
+		return params, fmt.Errorf("visibility must be one of private, unlisted, public")
 	}
 
-	respondWithJSON(w, http.StatusOK, videos)
+	return params, nil
 }
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestVideoCRUD(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signup(t, "owner@example.com")
+
+	var video database.Video
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", owner.Token, map[string]any{"title": "First", "description": "desc", "tags": []string{"go"}}, &video)
+	if video.Title != "First" || video.UserID != owner.ID || video.Visibility != database.VideoVisibilityPrivate {
+		t.Fatalf("created video = %+v", video)
+	}
+	api.expectStatus(t, http.StatusBadRequest, "POST", "/api/videos", owner.Token, map[string]any{"title": "x", "visibility": "secret"}, nil)
+
+	var got database.Video
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos/"+video.ID.String(), owner.Token, nil, &got)
+	if got.ID != video.ID {
+		t.Fatalf("GET returned video %v, want %v", got.ID, video.ID)
+	}
+
+	var page database.VideoPage
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos", owner.Token, nil, &page)
+	if len(page.Videos) != 1 || page.Videos[0].ID != video.ID {
+		t.Fatalf("GET /api/videos = %+v", page.Videos)
+	}
+
+	api.expectStatus(t, http.StatusNoContent, "DELETE", "/api/videos/"+video.ID.String(), owner.Token, nil, nil)
+	api.expectStatus(t, http.StatusNotFound, "GET", "/api/videos/"+video.ID.String(), owner.Token, nil, nil)
+}
+
+func TestVideoAccess(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signup(t, "owner@example.com")
+	other := api.signup(t, "other@example.com")
+
+	var private, unlisted database.Video
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", owner.Token, map[string]any{"title": "private"}, &private)
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", owner.Token, map[string]any{"title": "unlisted", "visibility": "unlisted"}, &unlisted)
+
+	// Private videos don't exist for anyone else.
+	api.expectStatus(t, http.StatusNotFound, "GET", "/api/videos/"+private.ID.String(), other.Token, nil, nil)
+	api.expectStatus(t, http.StatusNotFound, "GET", "/api/videos/"+private.ID.String(), "", nil, nil)
+	api.expectStatus(t, http.StatusNotFound, "DELETE", "/api/videos/"+private.ID.String(), other.Token, nil, nil)
+
+	// Unlisted videos can be watched but not changed.
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos/"+unlisted.ID.String(), "", nil, nil)
+	api.expectStatus(t, http.StatusForbidden, "DELETE", "/api/videos/"+unlisted.ID.String(), other.Token, nil, nil)
+
+	// Listing needs a token, and only shows the caller's own videos.
+	api.expectStatus(t, http.StatusUnauthorized, "GET", "/api/videos", "", nil, nil)
+	var page database.VideoPage
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos", other.Token, nil, &page)
+	if len(page.Videos) != 0 {
+		t.Fatalf("another user's listing has %d videos", len(page.Videos))
+	}
+
+	// An editor can change a video but not delete it.
+	api.expectStatus(t, http.StatusOK, "PUT", "/api/videos/"+private.ID.String()+"/collaborators", owner.Token, map[string]any{"email": "other@example.com", "role": "editor"}, nil)
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos/"+private.ID.String(), other.Token, nil, nil)
+	api.expectStatus(t, http.StatusForbidden, "DELETE", "/api/videos/"+private.ID.String(), other.Token, nil, nil)
+}
+
+// patchVideo sends a merge patch for video id, with an If-Match header if
+// ifMatch isn't empty.
+func (api *testAPI) patchVideo(t *testing.T, token, id, ifMatch, patch string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest("PATCH", api.server.URL+"/api/videos/"+id, strings.NewReader(patch))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PATCH: %v", err)
+	}
+	res.Body.Close()
+	return res
+}
+
+func TestVideoMergePatch(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signup(t, "owner@example.com")
+	editor := api.signup(t, "editor@example.com")
+
+	var video database.Video
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", owner.Token, map[string]any{"title": "Draft", "description": "desc", "tags": []string{"go"}}, &video)
+	id := video.ID.String()
+	get := func() database.Video {
+		t.Helper()
+		var got database.Video
+		api.expectStatus(t, http.StatusOK, "GET", "/api/videos/"+id, owner.Token, nil, &got)
+		return got
+	}
+
+	// Fields left out are unchanged, and null clears what can be cleared.
+	if res := api.patchVideo(t, owner.Token, id, "", `{"title": "Final", "description": null}`); res.StatusCode != http.StatusOK {
+		t.Fatalf("PATCH title and description: status %d", res.StatusCode)
+	}
+	got := get()
+	if got.Title != "Final" || got.Description != "" || !slices.Equal(got.Tags, []string{"go"}) || got.Visibility != database.VideoVisibilityPrivate {
+		t.Fatalf("video after patch = %+v", got)
+	}
+	if res := api.patchVideo(t, owner.Token, id, "", `{"tags": null, "visibility": "unlisted"}`); res.StatusCode != http.StatusOK {
+		t.Fatalf("PATCH tags and visibility: status %d", res.StatusCode)
+	}
+	if got := get(); len(got.Tags) != 0 || got.Visibility != database.VideoVisibilityUnlisted || got.Title != "Final" {
+		t.Fatalf("video after clearing tags = %+v", got)
+	}
+	// Plain JSON is accepted too.
+	api.expectStatus(t, http.StatusOK, "PATCH", "/api/videos/"+id, owner.Token, map[string]any{"description": "again"}, nil)
+
+	for _, patch := range []string{
+		`{"title": null}`,
+		`{"title": ""}`,
+		`{"title": 5}`,
+		`{"visibility": "secret"}`,
+		`{"visibility": null}`,
+		`{"tags": "go"}`,
+		`{"color": "red"}`,
+		`{"id": "` + uuid.NewString() + `"}`,
+		`{"user_id": "` + editor.ID.String() + `"}`,
+		`{"video_url": "https://example.com/v.mp4"}`,
+		`{"status": "ready"}`,
+		`{"created_at": "2020-01-01T00:00:00Z"}`,
+		`{"title": "Fine", "views": 100}`,
+		`["title"]`,
+		`null`,
+		`{"title": "Unterminated`,
+	} {
+		if res := api.patchVideo(t, owner.Token, id, "", patch); res.StatusCode != http.StatusBadRequest {
+			t.Fatalf("PATCH %s: status %d, want 400", patch, res.StatusCode)
+		}
+	}
+	if got := get(); got.Title != "Final" || got.Description != "again" || got.UserID != owner.ID || got.VideoURL != nil {
+		t.Fatalf("rejected patches changed the video: %+v", got)
+	}
+
+	api.expectStatus(t, http.StatusUnsupportedMediaType, "PATCH", "/api/videos/"+id, owner.Token, nil, nil)
+
+	// Editors can edit, but only owners can change who sees the video.
+	api.expectStatus(t, http.StatusOK, "PUT", "/api/videos/"+id+"/collaborators", owner.Token, map[string]any{"email": "editor@example.com", "role": "editor"}, nil)
+	if res := api.patchVideo(t, editor.Token, id, "", `{"title": "Edited"}`); res.StatusCode != http.StatusOK {
+		t.Fatalf("editor PATCH title: status %d", res.StatusCode)
+	}
+	if res := api.patchVideo(t, editor.Token, id, "", `{"visibility": "public"}`); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("editor PATCH visibility: status %d, want 403", res.StatusCode)
+	}
+}
+
+func TestVideoETags(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signup(t, "owner@example.com")
+
+	var video database.Video
+	res := api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", owner.Token, map[string]any{"title": "v1"}, &video)
+	id := video.ID.String()
+	created := res.Header.Get("ETag")
+	if created == "" || !strings.HasPrefix(created, `"`) || !strings.HasSuffix(created, `"`) {
+		t.Fatalf("POST ETag = %q, want a quoted strong tag", created)
+	}
+	etag := func() string {
+		t.Helper()
+		return api.expectStatus(t, http.StatusOK, "GET", "/api/videos/"+id, owner.Token, nil, nil).Header.Get("ETag")
+	}
+	if got := etag(); got != created {
+		t.Fatalf("GET ETag = %s, want %s from POST", got, created)
+	}
+
+	// A matching tag lets the edit through, and the response has the new
+	// tag, which GET agrees with.
+	res = api.patchVideo(t, owner.Token, id, created, `{"title": "v2"}`)
+	v2 := res.Header.Get("ETag")
+	if res.StatusCode != http.StatusOK || v2 == "" || v2 == created {
+		t.Fatalf("PATCH with the current ETag: status %d, ETag %s (was %s)", res.StatusCode, v2, created)
+	}
+	if got := etag(); got != v2 {
+		t.Fatalf("GET ETag after PATCH = %s, want %s", got, v2)
+	}
+
+	// The old tag is stale now, and a stale edit writes nothing.
+	if res := api.patchVideo(t, owner.Token, id, created, `{"title": "lost update"}`); res.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("PATCH with a stale ETag: status %d, want 412", res.StatusCode)
+	}
+	var got database.Video
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos/"+id, owner.Token, nil, &got)
+	if got.Title != "v2" || etag() != v2 {
+		t.Fatalf("stale PATCH changed the video to %q", got.Title)
+	}
+
+	// Any tag in a list can match, and * matches any version.
+	if res := api.patchVideo(t, owner.Token, id, created+", "+v2, `{"title": "v3"}`); res.StatusCode != http.StatusOK {
+		t.Fatalf("PATCH with a list of ETags: status %d", res.StatusCode)
+	}
+	if res := api.patchVideo(t, owner.Token, id, "*", `{"title": "v4"}`); res.StatusCode != http.StatusOK {
+		t.Fatalf("PATCH with If-Match *: status %d", res.StatusCode)
+	}
+	if res := api.patchVideo(t, owner.Token, id, `W/`+etag(), `{"title": "weak"}`); res.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("PATCH with a weak ETag: status %d, want 412", res.StatusCode)
+	}
+
+	// Without If-Match the edit applies to whatever version is current.
+	if res := api.patchVideo(t, owner.Token, id, "", `{"title": "v5"}`); res.StatusCode != http.StatusOK {
+		t.Fatalf("PATCH without If-Match: status %d", res.StatusCode)
+	}
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos/"+id, owner.Token, nil, &got)
+	if got.Title != "v5" {
+		t.Fatalf("title after unconditional PATCH = %q", got.Title)
+	}
+}
+
+// listAll pages through path, limit videos at a time, and returns every
+// video in the order the pages gave them.
+func (api *testAPI) listAll(t *testing.T, token, path string, limit int) []database.Video {
+	t.Helper()
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	if base, q, ok := strings.Cut(path, "?"); ok {
+		path = base
+		extra, err := url.ParseQuery(q)
+		if err != nil {
+			t.Fatalf("ParseQuery: %v", err)
+		}
+		for k, v := range extra {
+			query[k] = v
+		}
+	}
+	var videos []database.Video
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatalf("%s never ran out of pages", path)
+		}
+		var page database.VideoPage
+		api.expectStatus(t, http.StatusOK, "GET", path+"?"+query.Encode(), token, nil, &page)
+		if len(page.Videos) > limit {
+			t.Fatalf("page of %d videos, want at most %d", len(page.Videos), limit)
+		}
+		videos = append(videos, page.Videos...)
+		if page.NextCursor == nil {
+			return videos
+		}
+		query.Set("after", *page.NextCursor)
+	}
+}
+
+func TestVideoListingPages(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signup(t, "owner@example.com")
+
+	// Most of the videos share a created_at, so only the ID orders them.
+	same := time.Date(2026, 1, 2, 3, 4, 5, 678901000, time.UTC)
+	var created []database.Video
+	for i := range 7 {
+		var video database.Video
+		api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", owner.Token, map[string]any{"title": fmt.Sprintf("video %d", i)}, &video)
+		createdAt := same
+		if i == 0 {
+			createdAt = same.Add(-time.Hour)
+		}
+		if i == 6 {
+			createdAt = same.Add(time.Hour)
+		}
+		if err := api.db.SetVideoCreatedAt(video.ID, createdAt); err != nil {
+			t.Fatalf("SetVideoCreatedAt: %v", err)
+		}
+		video.CreatedAt = createdAt
+		created = append(created, video)
+	}
+
+	for _, order := range []string{"desc", "asc"} {
+		want := slices.Clone(created)
+		slices.SortFunc(want, func(a, b database.Video) int {
+			c := database.CompareVideos(a, b, database.VideoSortCreated)
+			if order == "desc" {
+				c = -c
+			}
+			return c
+		})
+		for _, limit := range []int{1, 2, 3, 100} {
+			got := api.listAll(t, owner.Token, "/api/videos?order="+order, limit)
+			if len(got) != len(want) {
+				t.Fatalf("order %s, limit %d: %d videos, want %d", order, limit, len(got), len(want))
+			}
+			for i := range want {
+				if got[i].ID != want[i].ID {
+					t.Fatalf("order %s, limit %d: video %d is %q, want %q", order, limit, i, got[i].Title, want[i].Title)
+				}
+			}
+		}
+	}
+}
+
+func TestVideoListingLimit(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signup(t, "owner@example.com")
+	for i := range database.DefaultVideoPageSize + 1 {
+		api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", owner.Token, map[string]any{"title": fmt.Sprintf("video %d", i)}, nil)
+	}
+
+	var page database.VideoPage
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos", owner.Token, nil, &page)
+	if len(page.Videos) != database.DefaultVideoPageSize || page.NextCursor == nil {
+		t.Fatalf("default page has %d videos, next cursor %v; want %d and a cursor", len(page.Videos), page.NextCursor, database.DefaultVideoPageSize)
+	}
+	for limit, want := range map[int]int{1: 1, database.MaxVideoPageSize: database.DefaultVideoPageSize + 1} {
+		var page database.VideoPage
+		api.expectStatus(t, http.StatusOK, "GET", fmt.Sprintf("/api/videos?limit=%d", limit), owner.Token, nil, &page)
+		if len(page.Videos) != want {
+			t.Fatalf("limit=%d: %d videos, want %d", limit, len(page.Videos), want)
+		}
+	}
+
+	for _, path := range []string{"/api/videos", "/api/videos/shared", "/api/public/videos"} {
+		for _, limit := range []string{"0", "-1", strconv.Itoa(database.MaxVideoPageSize + 1), "ten", "1.5"} {
+			api.expectStatus(t, http.StatusBadRequest, "GET", path+"?limit="+limit, owner.Token, nil, nil)
+		}
+	}
+}
+
+func TestVideoListingBadCursors(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signup(t, "owner@example.com")
+	for i := range 3 {
+		api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", owner.Token, map[string]any{"title": fmt.Sprintf("video %d", i), "visibility": "public"}, nil)
+	}
+	var page database.VideoPage
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos?limit=1", owner.Token, nil, &page)
+	if page.NextCursor == nil {
+		t.Fatal("first page has no next cursor")
+	}
+	cursor := *page.NextCursor
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		t.Fatalf("next cursor isn't base64: %v", err)
+	}
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	id := uuid.NewString()
+
+	for name, query := range map[string]string{
+		"not base64":           "after=" + url.QueryEscape("not a cursor!"),
+		"standard base64":      "after=" + url.QueryEscape(base64.StdEncoding.EncodeToString([]byte(`{"s":"created"}`))+"=="),
+		"not JSON":             "after=" + encode("not json"),
+		"truncated":            "after=" + encode(string(raw[:len(raw)-2])),
+		"a JSON array":         "after=" + encode(`[1, 2]`),
+		"no ID":                "after=" + encode(`{"s":"created","t":"2026-01-02T03:04:05Z"}`),
+		"bad ID":               "after=" + encode(`{"s":"created","t":"2026-01-02T03:04:05Z","id":"nope"}`),
+		"no sort key":          "after=" + encode(`{"s":"created","id":"`+id+`"}`),
+		"wrong type of key":    "after=" + encode(`{"s":"created","n":"video 1","id":"`+id+`"}`),
+		"bad time":             "after=" + encode(`{"s":"created","t":"yesterday","id":"`+id+`"}`),
+		"unknown sort":         "after=" + encode(`{"s":"views","t":"2026-01-02T03:04:05Z","id":"`+id+`"}`),
+		"another sort's":       "sort=title&after=" + cursor,
+		"another order's":      "order=asc&after=" + cursor,
+		"tampered sort":        "after=" + encode(strings.Replace(string(raw), `"s":"created"`, `"s":"title"`, 1)),
+		"tampered order":       "after=" + encode(strings.Replace(string(raw), `{`, `{"a":true,`, 1)),
+		"huge duration cursor": "sort=duration&after=" + encode(`{"s":"duration","d":1e999,"id":"`+id+`"}`),
+	} {
+		for _, path := range []string{"/api/videos", "/api/videos/shared", "/api/public/videos"} {
+			res := api.do(t, "GET", path+"?"+query, owner.Token, nil, nil)
+			if res.StatusCode != http.StatusBadRequest {
+				t.Errorf("%s cursor on %s: status %d, want 400", name, path, res.StatusCode)
+			}
+		}
+	}
+
+	// The untampered cursor still works.
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos?after="+cursor, owner.Token, nil, nil)
+}
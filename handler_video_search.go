@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func (cfg *apiConfig) handlerVideosSearch(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Results []database.VideoSearchResult `json:"results"`
+	}
+
+	userID := auth.UserIDFromContext(r.Context())
+
+	query := r.URL.Query()
+	params := database.SearchVideosParams{
+		UserID: userID,
+		Query:  query.Get("q"),
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > database.MaxSearchPageSize {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", database.MaxSearchPageSize), err)
+			return
+		}
+		params.Limit = limit
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			respondWithError(w, http.StatusBadRequest, "offset must be a non-negative integer", err)
+			return
+		}
+		params.Offset = offset
+	}
+
+	results, err := cfg.db.SearchVideos(r.Context(), params)
+	if errors.Is(err, database.ErrEmptyQuery) {
+		respondWithError(w, http.StatusBadRequest, "Search query must contain at least one word", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search videos", err)
+		return
+	}
+
+	for i, result := range results {
+		result.Video, err = cfg.DbVideoToSignedVideo(result.Video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get signed video URL", err)
+			return
+		}
+		results[i] = result
+	}
+
+	respondWithJSON(w, http.StatusOK, response{Results: results})
+}
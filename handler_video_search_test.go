@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestVideoSearch(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signup(t, "owner@example.com")
+	other := api.signup(t, "other@example.com")
+
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", owner.Token, map[string]any{"title": "<b>Gophers</b> & friends"}, nil)
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", owner.Token, map[string]any{"title": "Cooking", "description": "Gophers cook too"}, nil)
+
+	var res struct {
+		Results []database.VideoSearchResult `json:"results"`
+	}
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos/search?q=gopher", owner.Token, nil, &res)
+	if len(res.Results) != 2 || res.Results[0].Title != "<b>Gophers</b> & friends" {
+		t.Fatalf("search results = %+v", res.Results)
+	}
+	if want := "&lt;b&gt;<mark>Gophers</mark>&lt;/b&gt; &amp; friends"; res.Results[0].TitleHighlight != want {
+		t.Fatalf("TitleHighlight = %s, want %s", res.Results[0].TitleHighlight, want)
+	}
+
+	// Only the caller's own videos are searched.
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos/search?q=gopher", other.Token, nil, &res)
+	if len(res.Results) != 0 {
+		t.Fatalf("another user's search found %d videos", len(res.Results))
+	}
+
+	for _, query := range []string{"", "q=", "q=*%26*", "q=gopher&limit=0", "q=gopher&limit=51", "q=gopher&limit=many", "q=gopher&offset=-1"} {
+		api.expectStatus(t, http.StatusBadRequest, "GET", "/api/videos/search?"+query, owner.Token, nil, nil)
+	}
+}
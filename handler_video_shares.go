@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// shareResponse is a share as its owner sees it. Token is only set in the
+// response that creates the share; it can't be recovered later.
+type shareResponse struct {
+	database.VideoShare
+	HasPassword bool   `json:"has_password"`
+	Token       string `json:"token,omitempty"`
+	URL         string `json:"url,omitempty"`
+}
+
+func newShareResponse(share database.VideoShare) shareResponse {
+	return shareResponse{
+		VideoShare:  share,
+		HasPassword: share.PasswordHash != nil,
+	}
+}
+
+func (cfg *apiConfig) handlerVideoSharesCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ExpiresAt *time.Time `json:"expires_at"`
+		MaxViews  *int       `json:"max_views"`
+		Password  string     `json:"password"`
+	}
+
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.ExpiresAt != nil && !params.ExpiresAt.After(time.Now()) {
+		respondWithError(w, http.StatusBadRequest, "expires_at must be in the future", nil)
+		return
+	}
+	if params.MaxViews != nil && *params.MaxViews < 1 {
+		respondWithError(w, http.StatusBadRequest, "max_views must be at least 1", nil)
+		return
+	}
+
+	var passwordHash *string
+	if params.Password != "" {
+		hash, err := auth.HashPassword(params.Password)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+			return
+		}
+		passwordHash = &hash
+	}
+
+	token, err := auth.MakeToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create share token", err)
+		return
+	}
+
+	share, err := cfg.db.CreateVideoShare(r.Context(), database.CreateVideoShareParams{
+		VideoID:      video.ID,
+		TokenHash:    auth.HashToken(token),
+		ExpiresAt:    params.ExpiresAt,
+		MaxViews:     params.MaxViews,
+		PasswordHash: passwordHash,
+	})
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't create share", err)
+		return
+	}
+
+	res := newShareResponse(share)
+	res.Token = token
+	res.URL = "/api/shares/" + token
+	respondWithJSON(w, http.StatusCreated, res)
+}
+
+func (cfg *apiConfig) handlerVideoSharesList(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	shares, err := cfg.db.GetVideoShares(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get shares", err)
+		return
+	}
+
+	res := make([]shareResponse, len(shares))
+	for i, share := range shares {
+		res[i] = newShareResponse(share)
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func (cfg *apiConfig) handlerVideoSharesRevoke(w http.ResponseWriter, r *http.Request) {
+	shareID, err := uuid.Parse(r.PathValue("shareID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid share ID", err)
+		return
+	}
+
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.db.RevokeVideoShare(r.Context(), video.ID, shareID); err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't revoke share", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerShareResolve is the public side of a share link. It needs no
+// account: the token in the URL, and the password in the X-Share-Password
+// header if the share has one, are enough to get the video with a signed
+// media URL. Every successful call counts as one view.
+func (cfg *apiConfig) handlerShareResolve(w http.ResponseWriter, r *http.Request) {
+	share, err := cfg.db.GetVideoShareByTokenHash(r.Context(), auth.HashToken(r.PathValue("token")))
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't find share", err)
+		return
+	}
+
+	now := time.Now()
+	if !share.Active(now) {
+		respondWithError(w, http.StatusGone, "Share link is no longer valid", nil)
+		return
+	}
+
+	if share.PasswordHash != nil {
+		password := r.Header.Get("X-Share-Password")
+		if password == "" || auth.CheckPasswordHash(password, *share.PasswordHash) != nil {
+			respondWithError(w, http.StatusUnauthorized, "Incorrect share password", nil)
+			return
+		}
+	}
+
+	// The view is counted with its own validity check, so a share that ran
+	// out between the read above and now is still refused.
+	err = cfg.db.RecordVideoShareView(r.Context(), share.ID, now)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusGone, "Share link is no longer valid", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record view", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), share.VideoID)
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't get video", err)
+		return
+	}
+
+	// The media URL must not outlive the share.
+	ttl := presignedURLTTL
+	if share.ExpiresAt != nil {
+		ttl = min(ttl, max(share.ExpiresAt.Sub(now), time.Second))
+	}
+	videoWithSignedURL, err := cfg.signVideo(video, ttl)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get signed video URL", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, videoWithSignedURL)
+}
+
+// ownedVideo loads the video named by the videoID path value for the
+// authenticated caller, writing an error response and returning false unless
+// they are one of its owners.
+func (cfg *apiConfig) ownedVideo(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+
+	userID := auth.UserIDFromContext(r.Context())
+
+	video, _, err := cfg.authorizeVideo(r.Context(), videoID, userID, database.VideoRoleOwner)
+	if err != nil {
+		respondWithError(w, authorizeErrorStatus(err), "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	return video, true
+}
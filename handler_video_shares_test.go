@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// resolveShare gets a share link as someone without an account, sending
+// password as X-Share-Password if it isn't empty.
+func (api *testAPI) resolveShare(t *testing.T, token, password string) (*http.Response, database.Video) {
+	t.Helper()
+	req, err := http.NewRequest("GET", api.server.URL+"/api/shares/"+token, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	if password != "" {
+		req.Header.Set("X-Share-Password", password)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET share: %v", err)
+	}
+	defer res.Body.Close()
+	var video database.Video
+	if res.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(res.Body).Decode(&video); err != nil {
+			t.Fatalf("decoding share response: %v", err)
+		}
+	}
+	return res, video
+}
+
+// uploadedVideo creates a video for token whose file is in the test bucket,
+// and lets the API sign URLs for it.
+func (api *testAPI) uploadedVideo(t *testing.T, token string) database.Video {
+	t.Helper()
+	api.cfg.s3Client = s3.New(s3.Options{
+		Region: api.cfg.s3Region,
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKIDTEST", SecretAccessKey: "secret"}, nil
+		}),
+	})
+	var video database.Video
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", token, map[string]any{"title": "Shared"}, &video)
+	videoURL := api.cfg.s3Bucket + ",landscape/shared.mp4"
+	video.VideoURL = &videoURL
+	video, err := api.db.UpdateVideo(context.Background(), video)
+	if err != nil {
+		t.Fatalf("UpdateVideo: %v", err)
+	}
+	return video
+}
+
+// urlTTL is how long a presigned URL says it is valid for.
+func urlTTL(t *testing.T, video database.Video) time.Duration {
+	t.Helper()
+	if video.VideoURL == nil {
+		t.Fatal("video has no URL")
+	}
+	u, err := url.Parse(*video.VideoURL)
+	if err != nil {
+		t.Fatalf("parsing video URL: %v", err)
+	}
+	seconds, err := strconv.Atoi(u.Query().Get("X-Amz-Expires"))
+	if err != nil {
+		t.Fatalf("video URL %s isn't presigned: %v", *video.VideoURL, err)
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func TestShareResolve(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signup(t, "owner@example.com")
+	video := api.uploadedVideo(t, owner.Token)
+	sharesPath := "/api/videos/" + video.ID.String() + "/shares"
+
+	var open shareResponse
+	api.expectStatus(t, http.StatusCreated, "POST", sharesPath, owner.Token, map[string]any{}, &open)
+	res, got := api.resolveShare(t, open.Token, "")
+	if res.StatusCode != http.StatusOK || got.ID != video.ID {
+		t.Fatalf("open share: status %d, video %s", res.StatusCode, got.ID)
+	}
+	if ttl := urlTTL(t, got); ttl != presignedURLTTL {
+		t.Fatalf("URL of a share without expiry lasts %s, want %s", ttl, presignedURLTTL)
+	}
+
+	if res, _ := api.resolveShare(t, "not-a-share", ""); res.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown token: status %d, want 404", res.StatusCode)
+	}
+
+	// The media URL doesn't outlive the share.
+	var expiring shareResponse
+	api.expectStatus(t, http.StatusCreated, "POST", sharesPath, owner.Token, map[string]any{"expires_at": time.Now().Add(10 * time.Minute)}, &expiring)
+	res, got = api.resolveShare(t, expiring.Token, "")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expiring share: status %d", res.StatusCode)
+	}
+	if ttl := urlTTL(t, got); ttl > 10*time.Minute || ttl < 9*time.Minute {
+		t.Fatalf("URL of a share expiring in 10m lasts %s", ttl)
+	}
+
+	// Shares can't be created already expired, so expire one in the store.
+	expiredToken, err := auth.MakeToken()
+	if err != nil {
+		t.Fatalf("MakeToken: %v", err)
+	}
+	past := time.Now().Add(-time.Minute)
+	if _, err := api.db.CreateVideoShare(context.Background(), database.CreateVideoShareParams{VideoID: video.ID, TokenHash: auth.HashToken(expiredToken), ExpiresAt: &past}); err != nil {
+		t.Fatalf("CreateVideoShare: %v", err)
+	}
+	if res, _ := api.resolveShare(t, expiredToken, ""); res.StatusCode != http.StatusGone {
+		t.Fatalf("expired share: status %d, want 410", res.StatusCode)
+	}
+	api.expectStatus(t, http.StatusBadRequest, "POST", sharesPath, owner.Token, map[string]any{"expires_at": past}, nil)
+
+	// Revoking works at once.
+	api.expectStatus(t, http.StatusNoContent, "DELETE", sharesPath+"/"+open.ID.String(), owner.Token, nil, nil)
+	if res, _ := api.resolveShare(t, open.Token, ""); res.StatusCode != http.StatusGone {
+		t.Fatalf("revoked share: status %d, want 410", res.StatusCode)
+	}
+}
+
+func TestShareResolvePassword(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signup(t, "owner@example.com")
+	video := api.uploadedVideo(t, owner.Token)
+	sharesPath := "/api/videos/" + video.ID.String() + "/shares"
+
+	var share shareResponse
+	api.expectStatus(t, http.StatusCreated, "POST", sharesPath, owner.Token, map[string]any{"password": "open sesame", "max_views": 2}, &share)
+	if !share.HasPassword {
+		t.Fatal("share with a password has has_password false")
+	}
+	for _, password := range []string{"", "open", "Open sesame"} {
+		if res, _ := api.resolveShare(t, share.Token, password); res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("password %q: status %d, want 401", password, res.StatusCode)
+		}
+	}
+	if res, _ := api.resolveShare(t, share.Token, "open sesame"); res.StatusCode != http.StatusOK {
+		t.Fatalf("right password: status %d", res.StatusCode)
+	}
+
+	// Wrong passwords don't use up views.
+	var shares []shareResponse
+	api.expectStatus(t, http.StatusOK, "GET", sharesPath, owner.Token, nil, &shares)
+	if len(shares) != 1 || shares[0].ViewCount != 1 {
+		t.Fatalf("shares = %+v, want one with 1 view", shares)
+	}
+}
+
+func TestShareResolveMaxViews(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signup(t, "owner@example.com")
+	video := api.uploadedVideo(t, owner.Token)
+	sharesPath := "/api/videos/" + video.ID.String() + "/shares"
+
+	api.expectStatus(t, http.StatusBadRequest, "POST", sharesPath, owner.Token, map[string]any{"max_views": 0}, nil)
+
+	// However many people open the link at once, only max_views of them get
+	// the video.
+	const maxViews, viewers = 3, 20
+	var share shareResponse
+	api.expectStatus(t, http.StatusCreated, "POST", sharesPath, owner.Token, map[string]any{"max_views": maxViews}, &share)
+	statuses := make(chan int, viewers)
+	var wg sync.WaitGroup
+	for range viewers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := http.Get(api.server.URL + "/api/shares/" + share.Token)
+			if err != nil {
+				statuses <- 0
+				return
+			}
+			res.Body.Close()
+			statuses <- res.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusOK] != maxViews || counts[http.StatusGone] != viewers-maxViews {
+		t.Fatalf("statuses = %v, want %d OK and the rest 410", counts, maxViews)
+	}
+
+	if res, _ := api.resolveShare(t, share.Token, ""); res.StatusCode != http.StatusGone {
+		t.Fatalf("used up share: status %d, want 410", res.StatusCode)
+	}
+	var shares []shareResponse
+	api.expectStatus(t, http.StatusOK, "GET", sharesPath, owner.Token, nil, &shares)
+	if len(shares) != 1 || shares[0].ViewCount != maxViews {
+		t.Fatalf("shares = %+v, want one with %d views", shares, maxViews)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxWebhookURLLength         = 2048
+	maxWebhooksPerUser          = 10
+	defaultWebhookDeliveryLimit = 50
+	maxWebhookDeliveryLimit     = 200
+)
+
+// createWebhookResponse is the only response that includes the signing
+// secret; it can't be fetched again later.
+type createWebhookResponse struct {
+	database.Webhook
+	Secret string `json:"secret"`
+}
+
+// handlerWebhooksCreate registers an endpoint for events about the caller's
+// videos:
+//
+//	{ "url": "https://example.com/hooks/tubely", "events": ["video.processed"] }
+func (cfg *apiConfig) handlerWebhooksCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+
+	userID := auth.UserIDFromContext(r.Context())
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if err := validateWebhookURL(r.Context(), params.URL, cfg.allowPrivateWebhooks); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if len(params.Events) == 0 {
+		respondWithError(w, http.StatusBadRequest, "events must list at least one event", nil)
+		return
+	}
+	for _, event := range params.Events {
+		if !slices.Contains(webhookEventTypes, event) {
+			msg := fmt.Sprintf("unknown event %q; events must be from %s", event, strings.Join(webhookEventTypes, ", "))
+			respondWithError(w, http.StatusBadRequest, msg, nil)
+			return
+		}
+	}
+	slices.Sort(params.Events)
+	params.Events = slices.Compact(params.Events)
+
+	existing, err := cfg.db.GetWebhooks(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get webhooks", err)
+		return
+	}
+	if len(existing) >= maxWebhooksPerUser {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("You can't have more than %d webhooks", maxWebhooksPerUser), nil)
+		return
+	}
+
+	secret, err := auth.MakeToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create webhook secret", err)
+		return
+	}
+
+	webhook, err := cfg.db.CreateWebhook(r.Context(), database.CreateWebhookParams{
+		UserID: userID,
+		URL:    params.URL,
+		Events: params.Events,
+		Secret: secret,
+	})
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't create webhook", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, createWebhookResponse{Webhook: webhook, Secret: secret})
+}
+
+func (cfg *apiConfig) handlerWebhooksList(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserIDFromContext(r.Context())
+
+	webhooks, err := cfg.db.GetWebhooks(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get webhooks", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, webhooks)
+}
+
+func (cfg *apiConfig) handlerWebhookDelete(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := cfg.ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.db.DeleteWebhook(r.Context(), webhook.ID); err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't delete webhook", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerWebhookDeliveries returns a webhook's delivery log, newest first.
+// The limit query parameter defaults to 50 and can be at most 200.
+func (cfg *apiConfig) handlerWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := cfg.ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	limit := defaultWebhookDeliveryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxWebhookDeliveryLimit {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxWebhookDeliveryLimit), err)
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := cfg.db.GetWebhookDeliveries(r.Context(), webhook.ID, limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get webhook deliveries", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, deliveries)
+}
+
+// handlerWebhookDeliveryReplay queues a past delivery to be sent again, with
+// the same event ID so receivers can recognize it. The original stays in the
+// log unchanged.
+func (cfg *apiConfig) handlerWebhookDeliveryReplay(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := cfg.ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := uuid.Parse(r.PathValue("deliveryID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid delivery ID", err)
+		return
+	}
+	delivery, err := cfg.db.GetWebhookDelivery(r.Context(), deliveryID)
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't get webhook delivery", err)
+		return
+	}
+	if delivery.WebhookID != webhook.ID {
+		respondWithError(w, http.StatusNotFound, "Couldn't get webhook delivery", nil)
+		return
+	}
+
+	replay, err := cfg.db.ReplayWebhookDelivery(r.Context(), delivery.ID)
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't replay webhook delivery", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, replay)
+}
+
+// ownedWebhook loads the webhook in the path for its owner. Other users'
+// webhooks look missing.
+func (cfg *apiConfig) ownedWebhook(w http.ResponseWriter, r *http.Request) (database.Webhook, bool) {
+	webhookID, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid webhook ID", err)
+		return database.Webhook{}, false
+	}
+
+	userID := auth.UserIDFromContext(r.Context())
+
+	webhook, err := cfg.db.GetWebhook(r.Context(), webhookID)
+	if err != nil {
+		respondWithError(w, storeErrorStatus(err), "Couldn't get webhook", err)
+		return database.Webhook{}, false
+	}
+	if webhook.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Couldn't get webhook", nil)
+		return database.Webhook{}, false
+	}
+	return webhook, true
+}
+
+// validateWebhookURL checks a URL being registered as a webhook. Unless
+// allowPrivate is set, its host must only resolve to public addresses. That
+// is checked again on every delivery, since DNS can change.
+func validateWebhookURL(ctx context.Context, rawURL string, allowPrivate bool) error {
+	if rawURL == "" {
+		return fmt.Errorf("url is required")
+	}
+	if len(rawURL) > maxWebhookURLLength {
+		return fmt.Errorf("url can't be longer than %d characters", maxWebhookURLLength)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return errors.New("url can't include credentials")
+	}
+	if allowPrivate {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return errors.New("url's host couldn't be resolved")
+	}
+	for _, addr := range addrs {
+		if !isPublicAddr(addr) {
+			return errors.New("url must point to a public address")
+		}
+	}
+	return nil
+}
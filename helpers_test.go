@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database/dbtest"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mail"
+	"github.com/google/uuid"
+)
+
+// testAPI is the API with every route, served on a local server and backed
+// by an in-memory store. Mail is kept, not sent.
+type testAPI struct {
+	cfg    *apiConfig
+	db     *dbtest.Store
+	mailer *mail.LogMailer
+	server *httptest.Server
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	jwtKeys, err := auth.NewHMACKeyring("test-secret", auth.DefaultTokenConfig)
+	if err != nil {
+		t.Fatalf("NewHMACKeyring: %v", err)
+	}
+	api := &testAPI{
+		db:     dbtest.NewStore(),
+		mailer: mail.NewLogMailer(io.Discard),
+	}
+	api.cfg = &apiConfig{
+		db:           api.db,
+		jwtKeys:      jwtKeys,
+		platform:     "dev",
+		assetsRoot:   t.TempDir(),
+		s3Bucket:     "tubely-test",
+		s3Region:     "us-east-1",
+		importClient: newImportClient(true),
+		// Receivers in tests are local servers.
+		webhookClient:        newWebhookClient(true),
+		allowPrivateWebhooks: true,
+		mailer:               api.mailer,
+		playbackLimiter:      newRateLimiter(playbackEventsPerMinute, time.Minute),
+	}
+
+	mux := http.NewServeMux()
+	api.cfg.registerRoutes(mux)
+	api.server = httptest.NewServer(mux)
+	t.Cleanup(api.server.Close)
+	api.cfg.appBaseURL = api.server.URL
+	return api
+}
+
+// do sends a request with body, if not nil, as JSON and token, if not
+// empty, as a bearer token, or with the ApiKey scheme if it is an API key.
+// The response body is decoded into out, if not nil.
+func (api *testAPI) do(t *testing.T, method, path, token string, body, out any) *http.Response {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("encoding request body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, api.server.URL+path, reader)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case strings.HasPrefix(token, apiKeyPrefix):
+		req.Header.Set("Authorization", "ApiKey "+token)
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer res.Body.Close()
+	if out != nil && res.StatusCode < 300 {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return res
+}
+
+// expectStatus sends a request like do and fails unless it gets status.
+func (api *testAPI) expectStatus(t *testing.T, status int, method, path, token string, body, out any) *http.Response {
+	t.Helper()
+	res := api.do(t, method, path, token, body, out)
+	if res.StatusCode != status {
+		t.Fatalf("%s %s: status %d, want %d", method, path, res.StatusCode, status)
+	}
+	return res
+}
+
+// testPassword is the password signup gives every user.
+const testPassword = "hunter22"
+
+// signup registers a user with a verified email address and logs them in.
+func (api *testAPI) signup(t *testing.T, email string) loginResponse {
+	t.Helper()
+	res := api.signupUnverified(t, email)
+	if err := api.db.MarkEmailVerified(context.Background(), res.ID); err != nil {
+		t.Fatalf("MarkEmailVerified: %v", err)
+	}
+	res.User, _ = api.getUser(t, res.ID)
+	return res
+}
+
+// signupUnverified registers a user, as the signup form does, and logs
+// them in.
+func (api *testAPI) signupUnverified(t *testing.T, email string) loginResponse {
+	t.Helper()
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/users", "", map[string]string{"email": email, "password": testPassword}, nil)
+	return api.login(t, email, testPassword)
+}
+
+func (api *testAPI) getUser(t *testing.T, id uuid.UUID) (database.User, error) {
+	t.Helper()
+	user, err := api.db.GetUser(context.Background(), id)
+	if err != nil {
+		return database.User{}, err
+	}
+	return *user, nil
+}
+
+func (api *testAPI) login(t *testing.T, email, password string) loginResponse {
+	t.Helper()
+	var res loginResponse
+	api.expectStatus(t, http.StatusOK, "POST", "/api/login", "", map[string]string{"email": email, "password": password}, &res)
+	return res
+}
+
+// mailLink waits for the nth mail (counting from 1) sent to email, which
+// may be sent in the background, and returns the param query parameter of
+// the app link in it.
+func (api *testAPI) mailLink(t *testing.T, email string, n int, param string) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var sent []mail.Message
+		for _, msg := range api.mailer.Sent() {
+			if msg.To == email {
+				sent = append(sent, msg)
+			}
+		}
+		if len(sent) >= n {
+			for _, line := range strings.Split(sent[n-1].Body, "\n") {
+				if !strings.HasPrefix(line, api.cfg.appBaseURL+"/app/?") {
+					continue
+				}
+				link, err := url.Parse(line)
+				if err != nil {
+					t.Fatalf("parsing link %q: %v", line, err)
+				}
+				if token := link.Query().Get(param); token != "" {
+					return token
+				}
+			}
+			t.Fatalf("mail %q to %s has no %s link:\n%s", sent[n-1].Subject, email, param, sent[n-1].Body)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s got %d mails, want at least %d", email, len(sent), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// mailCount returns how many mails have been sent to email.
+func (api *testAPI) mailCount(email string) int {
+	n := 0
+	for _, msg := range api.mailer.Sent() {
+		if msg.To == email {
+			n++
+		}
+	}
+	return n
+}
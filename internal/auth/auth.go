@@ -2,10 +2,12 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -22,6 +24,34 @@ const (
 
 var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
 
+// ValidateJWT wraps the reason a token was rejected in one of these.
+var (
+	ErrTokenMalformed        = errors.New("access token is malformed")
+	ErrTokenExpired          = errors.New("access token expired")
+	ErrTokenNotYetValid      = errors.New("access token isn't valid yet")
+	ErrTokenSignatureInvalid = errors.New("access token signature is invalid")
+	ErrTokenWrongIssuer      = errors.New("access token has the wrong issuer")
+	ErrTokenWrongAudience    = errors.New("access token has the wrong audience")
+)
+
+// TokenConfig is what access tokens are issued with and checked against.
+type TokenConfig struct {
+	Issuer   string
+	Audience string
+	Lifetime time.Duration
+	// Leeway is how far clocks may disagree when checking exp, nbf and iat.
+	Leeway time.Duration
+}
+
+// DefaultTokenConfig issues tokens for this API that are short-lived, since
+// clients can refresh them.
+var DefaultTokenConfig = TokenConfig{
+	Issuer:   string(TokenTypeAccess),
+	Audience: "tubely-api",
+	Lifetime: 15 * time.Minute,
+	Leeway:   30 * time.Second,
+}
+
 func HashPassword(password string) (string, error) {
 	dat, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -34,50 +64,57 @@ func CheckPasswordHash(password, hash string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
-func MakeJWT(
-	userID uuid.UUID,
-	tokenSecret string,
-	expiresIn time.Duration,
-) (string, error) {
-	signingKey := []byte(tokenSecret)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    string(TokenTypeAccess),
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
-	})
-	return token.SignedString(signingKey)
+// AccessClaims is what valid credentials say about their caller.
+type AccessClaims struct {
+	UserID uuid.UUID
+	// SessionID is the refresh token family the token was issued from, or
+	// uuid.Nil for tokens issued before sessions were tracked.
+	SessionID uuid.UUID
+	// APIKeyID is set when the caller used an API key rather than an access
+	// token.
+	APIKeyID uuid.UUID
+	// Scopes limits what the caller can do.
+	Scopes []Scope
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claimsStruct := jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		&claimsStruct,
-		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
-	)
-	if err != nil {
-		return uuid.Nil, err
-	}
+type accessTokenClaims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid,omitempty"`
+	// Scope is the space-separated list of scopes, as in OAuth 2.0.
+	Scope string `json:"scope,omitempty"`
+}
 
-	userIDString, err := token.Claims.GetSubject()
-	if err != nil {
-		return uuid.Nil, err
+// accessClaims checks the claims of a token whose signature and times are
+// valid.
+func (c accessTokenClaims) accessClaims(config TokenConfig) (AccessClaims, error) {
+	if c.ExpiresAt == nil {
+		return AccessClaims{}, fmt.Errorf("%w: no expiration time", ErrTokenMalformed)
 	}
-
-	issuer, err := token.Claims.GetIssuer()
-	if err != nil {
-		return uuid.Nil, err
+	if c.Issuer != config.Issuer {
+		return AccessClaims{}, fmt.Errorf("%w: %q", ErrTokenWrongIssuer, c.Issuer)
 	}
-	if issuer != string(TokenTypeAccess) {
-		return uuid.Nil, errors.New("invalid issuer")
+	if !slices.Contains(c.Audience, config.Audience) {
+		return AccessClaims{}, fmt.Errorf("%w: %q", ErrTokenWrongAudience, c.Audience)
 	}
 
-	id, err := uuid.Parse(userIDString)
+	var claims AccessClaims
+	var err error
+	claims.UserID, err = uuid.Parse(c.Subject)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+		return AccessClaims{}, fmt.Errorf("%w: invalid user ID: %w", ErrTokenMalformed, err)
+	}
+	if c.SessionID != "" {
+		claims.SessionID, err = uuid.Parse(c.SessionID)
+		if err != nil {
+			return AccessClaims{}, fmt.Errorf("%w: invalid session ID: %w", ErrTokenMalformed, err)
+		}
+	}
+	// Tokens from before scopes existed had full access.
+	claims.Scopes = AllScopes
+	if c.Scope != "" {
+		claims.Scopes = ScopesFromStrings(strings.Fields(c.Scope))
 	}
-	return id, nil
+	return claims, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -94,6 +131,12 @@ func GetBearerToken(headers http.Header) (string, error) {
 }
 
 func MakeRefreshToken() (string, error) {
+	return MakeToken()
+}
+
+// MakeToken returns 32 random bytes, hex-encoded, for use as an opaque
+// bearer token.
+func MakeToken() (string, error) {
 	token := make([]byte, 32)
 	_, err := rand.Read(token)
 	if err != nil {
@@ -102,6 +145,14 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(token), nil
 }
 
+// HashToken returns the hex-encoded SHA-256 of an opaque token. Tokens are
+// random, so a fast hash is enough to make a leaked table useless while
+// still allowing lookups by hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
@@ -0,0 +1,120 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestValidateJWT(t *testing.T) {
+	key := newKey(t)
+	dir := writeKeys(t, map[string]ed25519.PrivateKey{"current": key}, nil)
+	keys, err := auth.LoadKeyring(dir, "", "", auth.DefaultTokenConfig)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	// Times are this far inside or outside the leeway, so the test doesn't
+	// depend on how long it takes to run.
+	const margin = 5 * time.Second
+	leeway := auth.DefaultTokenConfig.Leeway
+	at := func(d time.Duration) int64 { return time.Now().Add(d).Unix() }
+
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("signing with alg none: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		claims func(jwt.MapClaims)
+		want   error
+	}{
+		{name: "valid"},
+		{name: "alg none", token: none, want: auth.ErrTokenSignatureInvalid},
+		{name: "HS256 without a legacy secret", token: signHS256(t, []byte("secret"), validClaims()), want: auth.ErrTokenSignatureInvalid},
+		{name: "unknown kid", token: signEdDSA(t, newKey(t), "unknown", validClaims()), want: auth.ErrTokenSignatureInvalid},
+		{name: "not a JWT", token: "not-a-jwt", want: auth.ErrTokenMalformed},
+
+		{name: "wrong issuer", claims: func(c jwt.MapClaims) { c["iss"] = "someone-else" }, want: auth.ErrTokenWrongIssuer},
+		{name: "no issuer", claims: func(c jwt.MapClaims) { delete(c, "iss") }, want: auth.ErrTokenWrongIssuer},
+		{name: "wrong audience", claims: func(c jwt.MapClaims) { c["aud"] = []string{"another-api"} }, want: auth.ErrTokenWrongAudience},
+		{name: "no audience", claims: func(c jwt.MapClaims) { delete(c, "aud") }, want: auth.ErrTokenWrongAudience},
+		{name: "one of several audiences", claims: func(c jwt.MapClaims) { c["aud"] = []string{"another-api", auth.DefaultTokenConfig.Audience} }},
+
+		{name: "expired within leeway", claims: func(c jwt.MapClaims) { c["exp"] = at(-leeway + margin) }},
+		{name: "expired beyond leeway", claims: func(c jwt.MapClaims) { c["exp"] = at(-leeway - margin) }, want: auth.ErrTokenExpired},
+		{name: "no expiry", claims: func(c jwt.MapClaims) { delete(c, "exp") }, want: auth.ErrTokenMalformed},
+		{name: "nbf within leeway", claims: func(c jwt.MapClaims) { c["nbf"] = at(leeway - margin) }},
+		{name: "nbf beyond leeway", claims: func(c jwt.MapClaims) { c["nbf"] = at(leeway + margin) }, want: auth.ErrTokenNotYetValid},
+		{name: "iat within leeway", claims: func(c jwt.MapClaims) { c["iat"] = at(leeway - margin) }},
+		{name: "iat beyond leeway", claims: func(c jwt.MapClaims) { c["iat"] = at(leeway + margin) }, want: auth.ErrTokenNotYetValid},
+
+		{name: "subject isn't a user ID", claims: func(c jwt.MapClaims) { c["sub"] = "alice" }, want: auth.ErrTokenMalformed},
+		{name: "sid isn't a session ID", claims: func(c jwt.MapClaims) { c["sid"] = "session" }, want: auth.ErrTokenMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token
+			if token == "" {
+				claims := validClaims()
+				if tt.claims != nil {
+					tt.claims(claims)
+				}
+				token = signEdDSA(t, key, "current", claims)
+			}
+			_, err := keys.ValidateJWT(token)
+			if tt.want == nil && err != nil {
+				t.Fatalf("ValidateJWT: %v", err)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ValidateJWT error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateJWTClaims(t *testing.T) {
+	key := newKey(t)
+	dir := writeKeys(t, map[string]ed25519.PrivateKey{"current": key}, nil)
+	keys, err := auth.LoadKeyring(dir, "", "", auth.DefaultTokenConfig)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+
+	userID, sessionID := uuid.New(), uuid.New()
+	token, err := keys.MakeJWT(userID, sessionID, []auth.Scope{auth.ScopeVideosRead, auth.ScopeVideosWrite})
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+	claims, err := keys.ValidateJWT(token)
+	if err != nil {
+		t.Fatalf("ValidateJWT: %v", err)
+	}
+	if claims.UserID != userID || claims.SessionID != sessionID {
+		t.Fatalf("ValidateJWT = %+v, want user %s in session %s", claims, userID, sessionID)
+	}
+	if want := []auth.Scope{auth.ScopeVideosRead, auth.ScopeVideosWrite}; !slices.Equal(claims.Scopes, want) {
+		t.Fatalf("Scopes = %v, want %v", claims.Scopes, want)
+	}
+
+	// Tokens from before sessions and scopes were added keep full access.
+	legacy := validClaims()
+	legacy["sub"] = userID.String()
+	claims, err = keys.ValidateJWT(signEdDSA(t, key, "current", legacy))
+	if err != nil {
+		t.Fatalf("ValidateJWT of a token without sid or scope: %v", err)
+	}
+	if claims.SessionID != uuid.Nil {
+		t.Fatalf("SessionID = %s, want none", claims.SessionID)
+	}
+	if !slices.Equal(claims.Scopes, auth.AllScopes) {
+		t.Fatalf("Scopes of a token without a scope claim = %v, want %v", claims.Scopes, auth.AllScopes)
+	}
+}
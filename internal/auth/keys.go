@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// keyIDPattern keeps key IDs safe to use as file names.
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Keyring signs access tokens with one Ed25519 key and verifies them with
+// any key it holds, so the signing key can be rotated without logging
+// everyone out. Tokens name their key in the kid header. A Keyring can also
+// hold a legacy HS256 secret: tokens signed with it are still accepted, and
+// it signs new tokens when there is no Ed25519 key at all.
+type Keyring struct {
+	config       TokenConfig
+	signingKeyID string
+	signingKey   ed25519.PrivateKey
+	publicKeys   map[string]ed25519.PublicKey
+	hmacSecret   []byte
+}
+
+// NewHMACKeyring returns a Keyring that only signs and verifies with an
+// HS256 secret, as every token was signed before Ed25519 keys.
+func NewHMACKeyring(secret string, config TokenConfig) (*Keyring, error) {
+	if secret == "" {
+		return nil, errors.New("no HS256 secret given")
+	}
+	return &Keyring{config: config, publicKeys: map[string]ed25519.PublicKey{}, hmacSecret: []byte(secret)}, nil
+}
+
+// LoadKeyring reads every <kid>.pem file in dir. A file holds either an
+// Ed25519 private key, which can sign, or the public key of a retired one,
+// which can only verify. New tokens are signed with signingKeyID, which may
+// be empty if dir holds exactly one private key. hmacSecret, if not empty,
+// keeps HS256 tokens valid while they are phased out.
+func LoadKeyring(dir, signingKeyID, hmacSecret string, config TokenConfig) (*Keyring, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &Keyring{config: config, publicKeys: map[string]ed25519.PublicKey{}}
+	if hmacSecret != "" {
+		k.hmacSecret = []byte(hmacSecret)
+	}
+	privateKeys := map[string]ed25519.PrivateKey{}
+	for _, entry := range entries {
+		kid, ok := strings.CutSuffix(entry.Name(), ".pem")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if !keyIDPattern.MatchString(kid) {
+			return nil, fmt.Errorf("key file %s: ID must only use letters, digits, '.', '_' and '-'", path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		private, public, err := ParseKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("key file %s: %w", path, err)
+		}
+		if private != nil {
+			privateKeys[kid] = private
+		}
+		k.publicKeys[kid] = public
+	}
+
+	switch {
+	case signingKeyID != "":
+		private, ok := privateKeys[signingKeyID]
+		if !ok {
+			return nil, fmt.Errorf("signing key %q has no private key in %s", signingKeyID, dir)
+		}
+		k.signingKeyID, k.signingKey = signingKeyID, private
+	case len(privateKeys) == 1:
+		for kid, private := range privateKeys {
+			k.signingKeyID, k.signingKey = kid, private
+		}
+	case len(privateKeys) > 1:
+		return nil, fmt.Errorf("%s has %d private keys; choose the signing key by ID", dir, len(privateKeys))
+	case k.hmacSecret == nil:
+		return nil, fmt.Errorf("%s has no private key to sign with", dir)
+	}
+	return k, nil
+}
+
+// SigningKeyID returns the ID of the key new tokens are signed with, or ""
+// if they are signed with the HS256 secret.
+func (k *Keyring) SigningKeyID() string {
+	return k.signingKeyID
+}
+
+func (k *Keyring) MakeJWT(userID uuid.UUID, sessionID uuid.UUID, scopes []Scope) (string, error) {
+	now := time.Now().UTC()
+	claims := accessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    k.config.Issuer,
+			Audience:  jwt.ClaimStrings{k.config.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(k.config.Lifetime)),
+			Subject:   userID.String(),
+		},
+		SessionID: sessionID.String(),
+		Scope:     JoinScopes(scopes, " "),
+	}
+	if k.signingKey == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.hmacSecret)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = k.signingKeyID
+	return token.SignedString(k.signingKey)
+}
+
+// ValidateJWT checks a token's signature, times, issuer and audience. The
+// error wraps one of the ErrToken errors. Only EdDSA tokens are accepted,
+// and HS256 ones while the Keyring has a secret, so a token can't choose
+// how it is checked.
+func (k *Keyring) ValidateJWT(tokenString string) (AccessClaims, error) {
+	methods := []string{jwt.SigningMethodEdDSA.Alg()}
+	if k.hmacSecret != nil {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	claimsStruct := accessTokenClaims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		&claimsStruct,
+		k.verificationKey,
+		jwt.WithValidMethods(methods),
+		jwt.WithLeeway(k.config.Leeway),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return AccessClaims{}, tokenError(err)
+	}
+	return claimsStruct.accessClaims(k.config)
+}
+
+// tokenError sorts a parse error into the ErrToken errors.
+func tokenError(err error) error {
+	var kind error
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		kind = ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		kind = ErrTokenNotYetValid
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		kind = ErrTokenSignatureInvalid
+	default:
+		kind = ErrTokenMalformed
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
+
+func (k *Keyring) verificationKey(token *jwt.Token) (interface{}, error) {
+	if token.Method == jwt.SigningMethodHS256 {
+		return k.hmacSecret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	public, ok := k.publicKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return public, nil
+}
+
+// JWK is a public key in JSON Web Key form (RFC 8037).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns every key tokens can be verified with, so other services
+// can check our tokens without a shared secret. The HS256 secret is never
+// published.
+func (k *Keyring) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for kid, public := range k.publicKeys {
+		set.Keys = append(set.Keys, JWK{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(public),
+			KeyID:     kid,
+			Algorithm: jwt.SigningMethodEdDSA.Alg(),
+			Use:       "sig",
+		})
+	}
+	slices.SortFunc(set.Keys, func(a, b JWK) int { return strings.Compare(a.KeyID, b.KeyID) })
+	return set
+}
+
+// ParseKeyPEM reads a PKCS #8 Ed25519 private key or a PKIX Ed25519 public
+// key. private is nil for a public key.
+func ParseKeyPEM(data []byte) (private ed25519.PrivateKey, public ed25519.PublicKey, err error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		private, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("%T is not an Ed25519 key", key)
+		}
+		return private, private.Public().(ed25519.PublicKey), nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		public, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("%T is not an Ed25519 key", key)
+		}
+		return nil, public, nil
+	default:
+		return nil, nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+}
+
+// EncodePrivateKeyPEM encodes a private key as LoadKeyring reads it.
+func EncodePrivateKeyPEM(private ed25519.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// EncodePublicKeyPEM encodes a public key as LoadKeyring reads it.
+func EncodePublicKeyPEM(public ed25519.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
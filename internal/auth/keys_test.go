@@ -0,0 +1,241 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return private
+}
+
+// writeKeys writes private keys, which can sign, and public keys, which
+// are retired, to a new key directory.
+func writeKeys(t *testing.T, private, public map[string]ed25519.PrivateKey) string {
+	t.Helper()
+	dir := t.TempDir()
+	write := func(kid string, data []byte, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("encoding key %s: %v", kid, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600); err != nil {
+			t.Fatalf("writing key %s: %v", kid, err)
+		}
+	}
+	for kid, key := range private {
+		data, err := auth.EncodePrivateKeyPEM(key)
+		write(kid, data, err)
+	}
+	for kid, key := range public {
+		data, err := auth.EncodePublicKeyPEM(key.Public().(ed25519.PublicKey))
+		write(kid, data, err)
+	}
+	return dir
+}
+
+// validClaims are the claims of a token DefaultTokenConfig accepts.
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss": auth.DefaultTokenConfig.Issuer,
+		"aud": []string{auth.DefaultTokenConfig.Audience},
+		"sub": uuid.NewString(),
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(time.Minute).Unix(),
+	}
+}
+
+// signEdDSA signs claims with key, naming kid in the header unless it is
+// empty.
+func signEdDSA(t *testing.T, key ed25519.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+func signHS256(t *testing.T, secret []byte, claims jwt.MapClaims) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+func TestKeyringRotation(t *testing.T) {
+	current, retired, stranger := newKey(t), newKey(t), newKey(t)
+	dir := writeKeys(t, map[string]ed25519.PrivateKey{"current": current}, map[string]ed25519.PrivateKey{"retired": retired})
+	keys, err := auth.LoadKeyring(dir, "", "", auth.DefaultTokenConfig)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	if keys.SigningKeyID() != "current" {
+		t.Fatalf("SigningKeyID = %q, want the only private key", keys.SigningKeyID())
+	}
+
+	userID := uuid.New()
+	token, err := keys.MakeJWT(userID, uuid.New(), auth.AllScopes)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil || parsed.Header["kid"] != "current" || parsed.Method != jwt.SigningMethodEdDSA {
+		t.Fatalf("MakeJWT header = %v, %v; want EdDSA signed by current", parsed.Header, err)
+	}
+	if claims, err := keys.ValidateJWT(token); err != nil || claims.UserID != userID {
+		t.Fatalf("ValidateJWT of our own token = %+v, %v", claims, err)
+	}
+
+	// Tokens signed before the key was retired stay valid until they
+	// expire.
+	if _, err := keys.ValidateJWT(signEdDSA(t, retired, "retired", validClaims())); err != nil {
+		t.Fatalf("ValidateJWT of a token signed with the retired key: %v", err)
+	}
+
+	for name, token := range map[string]string{
+		"unknown kid":           signEdDSA(t, stranger, "stranger", validClaims()),
+		"no kid":                signEdDSA(t, current, "", validClaims()),
+		"kid of another key":    signEdDSA(t, retired, "current", validClaims()),
+		"signed by a stranger":  signEdDSA(t, stranger, "current", validClaims()),
+		"HS256 without secret":  signHS256(t, []byte("secret"), validClaims()),
+		"HS256 with public key": signHS256(t, current.Public().(ed25519.PublicKey), validClaims()),
+	} {
+		if _, err := keys.ValidateJWT(token); !errors.Is(err, auth.ErrTokenSignatureInvalid) {
+			t.Errorf("%s: ValidateJWT error = %v, want %v", name, err, auth.ErrTokenSignatureInvalid)
+		}
+	}
+
+	// A retired key has no private half to sign with.
+	if _, err := auth.LoadKeyring(dir, "retired", "", auth.DefaultTokenConfig); err == nil {
+		t.Fatal("LoadKeyring signing with a retired key succeeded")
+	}
+}
+
+func TestKeyringLegacySecret(t *testing.T) {
+	secret := []byte("legacy-secret")
+	dir := writeKeys(t, map[string]ed25519.PrivateKey{"current": newKey(t)}, nil)
+	keys, err := auth.LoadKeyring(dir, "current", string(secret), auth.DefaultTokenConfig)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+
+	// HS256 tokens are accepted while the secret is configured, but new
+	// tokens are signed with the Ed25519 key.
+	if _, err := keys.ValidateJWT(signHS256(t, secret, validClaims())); err != nil {
+		t.Fatalf("ValidateJWT of a legacy token: %v", err)
+	}
+	if _, err := keys.ValidateJWT(signHS256(t, []byte("wrong-secret"), validClaims())); !errors.Is(err, auth.ErrTokenSignatureInvalid) {
+		t.Fatalf("ValidateJWT with the wrong secret: %v, want %v", err, auth.ErrTokenSignatureInvalid)
+	}
+	token, err := keys.MakeJWT(uuid.New(), uuid.New(), auth.AllScopes)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+	if parsed, _, _ := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{}); parsed.Method != jwt.SigningMethodEdDSA {
+		t.Fatalf("MakeJWT signed with %v, want EdDSA", parsed.Method.Alg())
+	}
+
+	// With only public keys, the secret is what signs.
+	retiredOnly := writeKeys(t, nil, map[string]ed25519.PrivateKey{"retired": newKey(t)})
+	keys, err = auth.LoadKeyring(retiredOnly, "", string(secret), auth.DefaultTokenConfig)
+	if err != nil || keys.SigningKeyID() != "" {
+		t.Fatalf("LoadKeyring with only public keys and a secret = %v, %v", keys, err)
+	}
+}
+
+func TestLoadKeyringErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		private      map[string]ed25519.PrivateKey
+		public       map[string]ed25519.PrivateKey
+		signingKeyID string
+	}{
+		{name: "nothing to sign with", public: map[string]ed25519.PrivateKey{"retired": newKey(t)}},
+		{name: "several private keys", private: map[string]ed25519.PrivateKey{"a": newKey(t), "b": newKey(t)}},
+		{name: "unknown signing key", private: map[string]ed25519.PrivateKey{"a": newKey(t)}, signingKeyID: "b"},
+		{name: "unsafe key ID", private: map[string]ed25519.PrivateKey{"a key": newKey(t)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeKeys(t, tt.private, tt.public)
+			if _, err := auth.LoadKeyring(dir, tt.signingKeyID, "", auth.DefaultTokenConfig); err == nil {
+				t.Fatal("LoadKeyring succeeded")
+			}
+		})
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "garbage.pem"), []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.LoadKeyring(dir, "", "", auth.DefaultTokenConfig); err == nil {
+		t.Fatal("LoadKeyring with an unreadable key file succeeded")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	current, retired := newKey(t), newKey(t)
+	dir := writeKeys(t, map[string]ed25519.PrivateKey{"b-current": current}, map[string]ed25519.PrivateKey{"a-retired": retired})
+	keys, err := auth.LoadKeyring(dir, "", "legacy-secret", auth.DefaultTokenConfig)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+
+	data, err := json.Marshal(keys.JWKS())
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	jwk := func(kid string, key ed25519.PrivateKey) map[string]any {
+		return map[string]any{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+			"kid": kid,
+			"alg": "EdDSA",
+			"use": "sig",
+		}
+	}
+	// Sorted by kid, and never the HS256 secret.
+	want := map[string]any{"keys": []any{jwk("a-retired", retired), jwk("b-current", current)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("JWKS = %s\nwant %v", data, want)
+	}
+
+	hmacOnly, err := auth.NewHMACKeyring("legacy-secret", auth.DefaultTokenConfig)
+	if err != nil {
+		t.Fatalf("NewHMACKeyring: %v", err)
+	}
+	if data, _ := json.Marshal(hmacOnly.JWKS()); string(data) != `{"keys":[]}` {
+		t.Fatalf("JWKS of an HS256 keyring = %s, want no keys", data)
+	}
+}
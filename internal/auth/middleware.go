@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type contextKey int
+
+const (
+	userIDKey contextKey = iota
+	sessionIDKey
+)
+
+// ErrInvalidAPIKey wraps the reason an API key was rejected.
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// ErrorHandler writes the response for a request that failed
+// authentication. err wraps ErrNoAuthHeaderIncluded if the request had no
+// credentials at all, one of the ErrToken errors if its access token was
+// rejected, ErrInvalidAPIKey if its API key was rejected and a *ScopeError
+// if its credentials lack the route's scope.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+// APIKeyResolver returns the caller an API key belongs to, or an error if
+// the key is unknown or no longer usable.
+type APIKeyResolver func(ctx context.Context, key string) (AccessClaims, error)
+
+// Authenticator validates credentials once per request, so handlers only
+// read the result with UserIDFromContext and SessionIDFromContext. It takes
+// access tokens as "Authorization: Bearer <token>" and API keys as
+// "Authorization: ApiKey <key>".
+type Authenticator struct {
+	keys    *Keyring
+	apiKeys APIKeyResolver
+	onError ErrorHandler
+}
+
+// NewAuthenticator returns an Authenticator that checks tokens against
+// keys, looks API keys up with apiKeys and reports failures with onError.
+func NewAuthenticator(keys *Keyring, apiKeys APIKeyResolver, onError ErrorHandler) *Authenticator {
+	return &Authenticator{keys: keys, apiKeys: apiKeys, onError: onError}
+}
+
+// Required only calls next for requests with valid credentials that have
+// scope.
+func (a *Authenticator) Required(scope Scope, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := a.authenticate(r, scope)
+		if err != nil {
+			a.onError(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+	})
+}
+
+// Optional calls next for anonymous requests too, with no user in the
+// context. A request that sends credentials must still send valid ones
+// that have scope.
+func (a *Authenticator) Optional(scope Scope, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := a.authenticate(r, scope)
+		if errors.Is(err, ErrNoAuthHeaderIncluded) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			a.onError(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+	})
+}
+
+func (a *Authenticator) authenticate(r *http.Request, scope Scope) (AccessClaims, error) {
+	claims, err := a.credentials(r)
+	if err != nil {
+		return AccessClaims{}, err
+	}
+	if !claims.Allows(scope) {
+		return AccessClaims{}, &ScopeError{Scope: scope}
+	}
+	return claims, nil
+}
+
+func (a *Authenticator) credentials(r *http.Request) (AccessClaims, error) {
+	if key, err := GetAPIKey(r.Header); err == nil {
+		if a.apiKeys == nil {
+			return AccessClaims{}, fmt.Errorf("%w: API keys aren't accepted", ErrInvalidAPIKey)
+		}
+		claims, err := a.apiKeys(r.Context(), key)
+		if err != nil {
+			return AccessClaims{}, fmt.Errorf("%w: %w", ErrInvalidAPIKey, err)
+		}
+		return claims, nil
+	}
+
+	token, err := GetBearerToken(r.Header)
+	if err != nil {
+		return AccessClaims{}, err
+	}
+	return a.keys.ValidateJWT(token)
+}
+
+func withClaims(ctx context.Context, claims AccessClaims) context.Context {
+	ctx = WithUserID(ctx, claims.UserID)
+	return context.WithValue(ctx, sessionIDKey, claims.SessionID)
+}
+
+// WithUserID returns a copy of ctx carrying the authenticated user's ID.
+func WithUserID(ctx context.Context, userID uuid.UUID) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserIDFromContext returns the user the request was authenticated as, or
+// uuid.Nil if it is anonymous.
+func UserIDFromContext(ctx context.Context) uuid.UUID {
+	userID, _ := ctx.Value(userIDKey).(uuid.UUID)
+	return userID
+}
+
+// SessionIDFromContext returns the session the request's access token was
+// issued from, or uuid.Nil if it is anonymous or the token predates
+// sessions.
+func SessionIDFromContext(ctx context.Context) uuid.UUID {
+	sessionID, _ := ctx.Value(sessionIDKey).(uuid.UUID)
+	return sessionID
+}
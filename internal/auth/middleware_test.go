@@ -0,0 +1,170 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+// middlewareResult is what a request through the middleware got.
+type middlewareResult struct {
+	// called is whether the next handler ran, and with which caller.
+	called    bool
+	userID    uuid.UUID
+	sessionID uuid.UUID
+	// err is what the ErrorHandler was given, if it ran.
+	err error
+}
+
+// serve sends a request with the Authorization header, if not empty,
+// through the middleware wrap returns.
+func serve(t *testing.T, authenticator func(auth.ErrorHandler) *auth.Authenticator, wrap func(*auth.Authenticator, http.Handler) http.Handler, authorization string) middlewareResult {
+	t.Helper()
+	var result middlewareResult
+	onError := func(w http.ResponseWriter, r *http.Request, err error) {
+		result.err = err
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result.called = true
+		result.userID = auth.UserIDFromContext(r.Context())
+		result.sessionID = auth.SessionIDFromContext(r.Context())
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	wrap(authenticator(onError), next).ServeHTTP(httptest.NewRecorder(), req)
+	if result.called && result.err != nil {
+		t.Fatalf("both the handler and the ErrorHandler ran, with %v", result.err)
+	}
+	return result
+}
+
+func required(a *auth.Authenticator, next http.Handler) http.Handler {
+	return a.Required(auth.ScopeVideosRead, next)
+}
+
+func optional(a *auth.Authenticator, next http.Handler) http.Handler {
+	return a.Optional(auth.ScopeVideosRead, next)
+}
+
+func TestMiddlewareAccessTokens(t *testing.T) {
+	keys, err := auth.NewHMACKeyring("secret", auth.DefaultTokenConfig)
+	if err != nil {
+		t.Fatalf("NewHMACKeyring: %v", err)
+	}
+	newAuthenticator := func(onError auth.ErrorHandler) *auth.Authenticator {
+		return auth.NewAuthenticator(keys, nil, onError)
+	}
+	userID, sessionID := uuid.New(), uuid.New()
+	token, err := keys.MakeJWT(userID, sessionID, auth.AllScopes)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+
+	for name, wrap := range map[string]func(*auth.Authenticator, http.Handler) http.Handler{"Required": required, "Optional": optional} {
+		t.Run(name, func(t *testing.T) {
+			got := serve(t, newAuthenticator, wrap, "Bearer "+token)
+			if !got.called || got.userID != userID || got.sessionID != sessionID {
+				t.Fatalf("valid token: %+v, want the handler called as user %s in session %s", got, userID, sessionID)
+			}
+
+			for _, authorization := range []string{"Bearer not-a-jwt", "Bearer " + token + "x"} {
+				if got := serve(t, newAuthenticator, wrap, authorization); got.called || got.err == nil {
+					t.Fatalf("%q: %+v, want an error", authorization, got)
+				}
+			}
+			if got := serve(t, newAuthenticator, wrap, "Basic dXNlcjpwYXNz"); got.called || got.err == nil || errors.Is(got.err, auth.ErrNoAuthHeaderIncluded) {
+				t.Fatalf("another scheme: %+v, want an error other than no credentials", got)
+			}
+		})
+	}
+
+	// Only Optional lets anonymous requests through, with no one in the
+	// context.
+	if got := serve(t, newAuthenticator, required, ""); got.called || !errors.Is(got.err, auth.ErrNoAuthHeaderIncluded) {
+		t.Fatalf("Required without credentials: %+v, want %v", got, auth.ErrNoAuthHeaderIncluded)
+	}
+	if got := serve(t, newAuthenticator, optional, ""); !got.called || got.userID != uuid.Nil || got.sessionID != uuid.Nil {
+		t.Fatalf("Optional without credentials: %+v, want the handler called anonymously", got)
+	}
+}
+
+func TestContextWithoutCaller(t *testing.T) {
+	if id := auth.UserIDFromContext(context.Background()); id != uuid.Nil {
+		t.Fatalf("UserIDFromContext = %s, want uuid.Nil", id)
+	}
+	if id := auth.SessionIDFromContext(context.Background()); id != uuid.Nil {
+		t.Fatalf("SessionIDFromContext = %s, want uuid.Nil", id)
+	}
+}
+
+func TestMiddlewareAPIKeys(t *testing.T) {
+	keys, err := auth.NewHMACKeyring("secret", auth.DefaultTokenConfig)
+	if err != nil {
+		t.Fatalf("NewHMACKeyring: %v", err)
+	}
+	userID, keyID := uuid.New(), uuid.New()
+	errRevoked := errors.New("revoked")
+	resolve := func(ctx context.Context, key string) (auth.AccessClaims, error) {
+		switch key {
+		case "tubely_good":
+			return auth.AccessClaims{UserID: userID, APIKeyID: keyID, Scopes: []auth.Scope{auth.ScopeVideosRead}}, nil
+		case "tubely_writer":
+			return auth.AccessClaims{UserID: userID, APIKeyID: keyID, Scopes: []auth.Scope{auth.ScopeVideosWrite}}, nil
+		default:
+			return auth.AccessClaims{}, errRevoked
+		}
+	}
+	newAuthenticator := func(onError auth.ErrorHandler) *auth.Authenticator {
+		return auth.NewAuthenticator(keys, resolve, onError)
+	}
+	token, err := keys.MakeJWT(uuid.New(), uuid.New(), auth.AllScopes)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+
+	for name, wrap := range map[string]func(*auth.Authenticator, http.Handler) http.Handler{"Required": required, "Optional": optional} {
+		t.Run(name, func(t *testing.T) {
+			got := serve(t, newAuthenticator, wrap, "ApiKey tubely_good")
+			if !got.called || got.userID != userID || got.sessionID != uuid.Nil {
+				t.Fatalf("valid key: %+v, want the handler called as user %s with no session", got, userID)
+			}
+
+			got = serve(t, newAuthenticator, wrap, "ApiKey tubely_revoked")
+			if got.called || !errors.Is(got.err, auth.ErrInvalidAPIKey) || !errors.Is(got.err, errRevoked) {
+				t.Fatalf("revoked key: %+v, want %v wrapping the resolver's error", got, auth.ErrInvalidAPIKey)
+			}
+
+			// Without a key, the header is neither an API key nor a bearer
+			// token, so it isn't anonymous either.
+			got = serve(t, newAuthenticator, wrap, "ApiKey")
+			if got.called || got.err == nil || errors.Is(got.err, auth.ErrNoAuthHeaderIncluded) {
+				t.Fatalf("ApiKey without a key: %+v, want an error other than no credentials", got)
+			}
+
+			got = serve(t, newAuthenticator, wrap, "ApiKey tubely_writer")
+			if got.called || !errors.Is(got.err, auth.ErrInsufficientScope) {
+				t.Fatalf("key without the scope: %+v, want %v", got, auth.ErrInsufficientScope)
+			}
+
+			// Access tokens still work alongside keys.
+			if got := serve(t, newAuthenticator, wrap, "Bearer "+token); !got.called {
+				t.Fatalf("bearer token: %+v, want the handler called", got)
+			}
+		})
+	}
+
+	noKeys := func(onError auth.ErrorHandler) *auth.Authenticator {
+		return auth.NewAuthenticator(keys, nil, onError)
+	}
+	if got := serve(t, noKeys, required, "ApiKey tubely_good"); got.called || !errors.Is(got.err, auth.ErrInvalidAPIKey) {
+		t.Fatalf("key without a resolver: %+v, want %v", got, auth.ErrInvalidAPIKey)
+	}
+}
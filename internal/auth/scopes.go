@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scope is a kind of access a route needs. Access tokens have the scopes
+// their login asked for, and API keys the ones they were granted.
+type Scope string
+
+const (
+	ScopeVideosRead   Scope = "videos:read"
+	ScopeVideosWrite  Scope = "videos:write"
+	ScopeVideosDelete Scope = "videos:delete"
+	// ScopeAdmin covers administering the account itself: webhooks,
+	// sessions and API keys. It can't be granted to an API key.
+	ScopeAdmin Scope = "admin"
+)
+
+// AllScopes are every scope there is, and what a login gets unless it asks
+// for fewer.
+var AllScopes = []Scope{ScopeVideosRead, ScopeVideosWrite, ScopeVideosDelete, ScopeAdmin}
+
+// APIKeyScopes are the scopes an API key can be granted.
+var APIKeyScopes = []Scope{ScopeVideosRead, ScopeVideosWrite, ScopeVideosDelete}
+
+// ErrInsufficientScope is reported for valid credentials that don't have
+// the scope a route needs.
+var ErrInsufficientScope = errors.New("insufficient scope")
+
+// ScopeError is the ErrInsufficientScope for a route that needs Scope.
+type ScopeError struct {
+	Scope Scope
+}
+
+func (e *ScopeError) Error() string {
+	return fmt.Sprintf("%v: needs the %s scope", ErrInsufficientScope, e.Scope)
+}
+
+func (e *ScopeError) Is(target error) bool {
+	return target == ErrInsufficientScope
+}
+
+// Allows reports whether the caller has scope.
+func (c AccessClaims) Allows(scope Scope) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// ParseScopes checks requested scopes against allowed, dropping duplicates.
+func ParseScopes(requested []string, allowed []Scope) ([]Scope, error) {
+	if len(requested) == 0 {
+		return nil, errors.New("scopes must list at least one scope")
+	}
+	scopes := []Scope{}
+	for _, name := range requested {
+		scope := Scope(name)
+		if !slices.Contains(allowed, scope) {
+			return nil, fmt.Errorf("scope %q isn't allowed; scopes must be from %s", name, JoinScopes(allowed, ", "))
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// ScopeStrings converts scopes to their names, for storage.
+func ScopeStrings(scopes []Scope) []string {
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+	return names
+}
+
+// ScopesFromStrings converts stored scope names back to scopes.
+func ScopesFromStrings(names []string) []Scope {
+	scopes := make([]Scope, len(names))
+	for i, name := range names {
+		scopes[i] = Scope(name)
+	}
+	return scopes
+}
+
+// JoinScopes joins scope names with sep.
+func JoinScopes(scopes []Scope, sep string) string {
+	return strings.Join(ScopeStrings(scopes), sep)
+}
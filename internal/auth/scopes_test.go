@@ -0,0 +1,57 @@
+package auth_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested []string
+		allowed   []auth.Scope
+		want      []auth.Scope
+	}{
+		{name: "one", requested: []string{"videos:read"}, allowed: auth.APIKeyScopes, want: []auth.Scope{auth.ScopeVideosRead}},
+		{name: "duplicates", requested: []string{"videos:write", "videos:read", "videos:write"}, allowed: auth.APIKeyScopes, want: []auth.Scope{auth.ScopeVideosWrite, auth.ScopeVideosRead}},
+		{name: "admin for a login", requested: []string{"admin"}, allowed: auth.AllScopes, want: []auth.Scope{auth.ScopeAdmin}},
+		{name: "admin for an API key", requested: []string{"videos:read", "admin"}, allowed: auth.APIKeyScopes},
+		{name: "unknown", requested: []string{"videos:everything"}, allowed: auth.AllScopes},
+		{name: "case matters", requested: []string{"Videos:Read"}, allowed: auth.AllScopes},
+		{name: "none", requested: []string{}, allowed: auth.AllScopes},
+		{name: "missing", allowed: auth.AllScopes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := auth.ParseScopes(tt.requested, tt.allowed)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("ParseScopes = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Fatalf("ParseScopes = %v, %v; want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopeError(t *testing.T) {
+	var err error = &auth.ScopeError{Scope: auth.ScopeVideosWrite}
+	if !errors.Is(err, auth.ErrInsufficientScope) {
+		t.Fatalf("%v isn't %v", err, auth.ErrInsufficientScope)
+	}
+	var scopeErr *auth.ScopeError
+	if !errors.As(err, &scopeErr) || scopeErr.Scope != auth.ScopeVideosWrite {
+		t.Fatalf("errors.As(%v) = %v", err, scopeErr)
+	}
+
+	claims := auth.AccessClaims{Scopes: []auth.Scope{auth.ScopeVideosRead}}
+	if !claims.Allows(auth.ScopeVideosRead) || claims.Allows(auth.ScopeVideosWrite) {
+		t.Fatalf("Allows is wrong for %v", claims.Scopes)
+	}
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AccountTokenPurpose is what an account token can be used for. A token
+// only works for the purpose it was issued for.
+type AccountTokenPurpose string
+
+const (
+	AccountTokenPasswordReset     AccountTokenPurpose = "password_reset"
+	AccountTokenEmailVerification AccountTokenPurpose = "email_verification"
+	// AccountTokenOIDCLogin is the one-time code that hands an OpenID
+	// Connect login from the callback to the app.
+	AccountTokenOIDCLogin AccountTokenPurpose = "oidc_login"
+)
+
+// AccountToken is a single-use token mailed to a user to prove they can
+// read their email. Only a hash of the token is stored.
+type AccountToken struct {
+	ID        uuid.UUID           `json:"id"`
+	CreatedAt time.Time           `json:"created_at"`
+	UserID    uuid.UUID           `json:"user_id"`
+	Purpose   AccountTokenPurpose `json:"purpose"`
+	TokenHash string              `json:"-"`
+	ExpiresAt time.Time           `json:"expires_at"`
+	UsedAt    *time.Time          `json:"used_at"`
+}
+
+type CreateAccountTokenParams struct {
+	UserID    uuid.UUID
+	Purpose   AccountTokenPurpose
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+const accountTokenColumns = `id, created_at, user_id, purpose, token_hash, expires_at, used_at`
+
+func scanAccountToken(row rowScanner) (AccountToken, error) {
+	var token AccountToken
+	err := row.Scan(
+		&token.ID,
+		&token.CreatedAt,
+		&token.UserID,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.UsedAt,
+	)
+	return token, err
+}
+
+func (c Client) CreateAccountToken(ctx context.Context, params CreateAccountTokenParams) (AccountToken, error) {
+	query := `
+	INSERT INTO account_tokens (id, created_at, user_id, purpose, token_hash, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+	token := AccountToken{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UserID:    params.UserID,
+		Purpose:   params.Purpose,
+		TokenHash: params.TokenHash,
+		ExpiresAt: params.ExpiresAt.UTC().Truncate(time.Microsecond),
+	}
+	_, err := c.db.ExecContext(
+		ctx,
+		query,
+		token.ID,
+		token.CreatedAt,
+		token.UserID,
+		token.Purpose,
+		token.TokenHash,
+		token.ExpiresAt,
+	)
+	if err != nil {
+		return AccountToken{}, translateError(err)
+	}
+	return token, nil
+}
+
+// CountAccountTokens counts the tokens issued to a user for purpose since a
+// time, used or not, so how often they are mailed can be limited.
+func (c Client) CountAccountTokens(ctx context.Context, userID uuid.UUID, purpose AccountTokenPurpose, since time.Time) (int, error) {
+	query := `
+	SELECT COUNT(*)
+	FROM account_tokens
+	WHERE user_id = ? AND purpose = ? AND created_at >= ?
+	`
+	var count int
+	err := c.db.QueryRowContext(ctx, query, userID, purpose, since.UTC()).Scan(&count)
+	return count, err
+}
+
+// UseAccountToken spends a token. Every other unused token the user has for
+// the same purpose is spent with it, so only one link in a batch of mails
+// works. It returns ErrNotFound if the token is unknown, was issued for
+// another purpose, has been used or has expired.
+func (c Client) UseAccountToken(ctx context.Context, purpose AccountTokenPurpose, tokenHash string) (AccountToken, error) {
+	var token AccountToken
+	err := c.inTx(ctx, func(tx Client) error {
+		query := `
+		SELECT ` + accountTokenColumns + `
+		FROM account_tokens
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+		`
+		var err error
+		token, err = scanAccountToken(tx.db.QueryRowContext(ctx, query, tokenHash, purpose, time.Now().UTC()))
+		if err != nil {
+			return translateError(err)
+		}
+
+		usedAt := now()
+		query = `
+		UPDATE account_tokens
+		SET used_at = ?
+		WHERE user_id = ? AND purpose = ? AND used_at IS NULL
+		`
+		res, err := tx.db.ExecContext(ctx, query, usedAt, token.UserID, purpose)
+		if err != nil {
+			return err
+		}
+		// A concurrent use of the same token got there first.
+		if err := requireAffected(res); err != nil {
+			return err
+		}
+		token.UsedAt = &usedAt
+		return nil
+	})
+	if err != nil {
+		return AccountToken{}, err
+	}
+	return token, nil
+}
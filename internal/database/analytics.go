@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PlaybackEvent is one beacon from a player. Percent is how far into the
+// video the session has got: 0 on play, 25, 50 and 75 at each quartile, and
+// 100 on completion.
+type PlaybackEvent struct {
+	VideoID   uuid.UUID
+	SessionID string
+	// ViewerHash identifies the viewer across sessions without storing who
+	// they are.
+	ViewerHash string
+	Percent    int
+	At         time.Time
+}
+
+// VideoDailyStats is one day of a video's playback counts. Views counts
+// sessions, not events, and every session is counted on the day it started.
+type VideoDailyStats struct {
+	Day           time.Time
+	Views         int
+	UniqueViewers int
+	Completions   int
+	// WatchPercentTotal is the sum of how far each session got, so divided
+	// by Views it is the average watch percent.
+	WatchPercentTotal int
+}
+
+// VideoAnalytics is a video's playback counts over a range of days. Daily
+// only has entries for days with views.
+type VideoAnalytics struct {
+	Views             int
+	UniqueViewers     int
+	Completions       int
+	WatchPercentTotal int
+	Daily             []VideoDailyStats
+}
+
+// AnalyticsDay truncates t to the UTC day its stats are counted under.
+func AnalyticsDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// MaxDailySessionsPerViewer is how many sessions of a video one viewer can
+// start in a day. RecordPlaybackEvent refuses more with
+// ErrTooManyPlaybackSessions, so one viewer can't inflate the view count.
+const MaxDailySessionsPerViewer = 20
+
+// ErrTooManyPlaybackSessions is returned for a new session from a viewer
+// who has already started MaxDailySessionsPerViewer of them today.
+var ErrTooManyPlaybackSessions = errors.New("too many playback sessions")
+
+// RecordPlaybackEvent folds one event into its session and the video's daily
+// stats. Events are deduplicated per session: a session's first event counts
+// a view, and later ones only count the progress beyond what the session
+// already reported, so replays and repeated beacons change nothing.
+func (c Client) RecordPlaybackEvent(ctx context.Context, event PlaybackEvent) error {
+	day := AnalyticsDay(event.At)
+	return c.inTx(ctx, func(tx Client) error {
+		res, err := tx.db.ExecContext(ctx, `
+		INSERT INTO playback_sessions (video_id, session_id, viewer_hash, day, max_percent, started_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (video_id, session_id) DO NOTHING
+		`, event.VideoID, event.SessionID, event.ViewerHash, day, event.Percent, event.At.UTC())
+		if err != nil {
+			return translateError(err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 1 {
+			// The upsert counts the viewer's sessions atomically, so the
+			// first of the day is counted as unique exactly once.
+			var sessions int
+			err := tx.db.QueryRowContext(ctx, `
+			INSERT INTO playback_daily_viewers (video_id, viewer_hash, day, sessions)
+			VALUES (?, ?, ?, 1)
+			ON CONFLICT (video_id, viewer_hash, day) DO UPDATE SET sessions = playback_daily_viewers.sessions + 1
+			RETURNING sessions
+			`, event.VideoID, event.ViewerHash, day).Scan(&sessions)
+			if err != nil {
+				return translateError(err)
+			}
+			if sessions > MaxDailySessionsPerViewer {
+				return ErrTooManyPlaybackSessions
+			}
+			stats := VideoDailyStats{Day: day, Views: 1, WatchPercentTotal: event.Percent}
+			if sessions == 1 {
+				stats.UniqueViewers = 1
+			}
+			if event.Percent >= 100 {
+				stats.Completions = 1
+			}
+			return tx.addDailyStats(ctx, event.VideoID, stats)
+		}
+
+		// A known session only counts progress past its furthest point.
+		var sessionDay time.Time
+		var maxPercent int
+		err = tx.db.QueryRowContext(ctx, `
+		SELECT day, max_percent FROM playback_sessions
+		WHERE video_id = ? AND session_id = ?
+		`, event.VideoID, event.SessionID).Scan(&sessionDay, &maxPercent)
+		if err != nil {
+			return translateError(err)
+		}
+		if event.Percent <= maxPercent {
+			return nil
+		}
+		_, err = tx.db.ExecContext(ctx, `
+		UPDATE playback_sessions SET max_percent = ?
+		WHERE video_id = ? AND session_id = ?
+		`, event.Percent, event.VideoID, event.SessionID)
+		if err != nil {
+			return err
+		}
+		stats := VideoDailyStats{Day: AnalyticsDay(sessionDay), WatchPercentTotal: event.Percent - maxPercent}
+		if event.Percent >= 100 {
+			stats.Completions = 1
+		}
+		return tx.addDailyStats(ctx, event.VideoID, stats)
+	})
+}
+
+func (c Client) addDailyStats(ctx context.Context, videoID uuid.UUID, stats VideoDailyStats) error {
+	_, err := c.db.ExecContext(ctx, `
+	INSERT INTO video_daily_stats (video_id, day, views, unique_viewers, completions, watch_percent_total)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT (video_id, day) DO UPDATE SET
+		views = video_daily_stats.views + excluded.views,
+		unique_viewers = video_daily_stats.unique_viewers + excluded.unique_viewers,
+		completions = video_daily_stats.completions + excluded.completions,
+		watch_percent_total = video_daily_stats.watch_percent_total + excluded.watch_percent_total
+	`, videoID, stats.Day, stats.Views, stats.UniqueViewers, stats.Completions, stats.WatchPercentTotal)
+	return err
+}
+
+// GetVideoAnalytics returns a video's stats for the days from through to,
+// inclusive. UniqueViewers counts each viewer once across the whole range.
+func (c Client) GetVideoAnalytics(ctx context.Context, videoID uuid.UUID, from, to time.Time) (VideoAnalytics, error) {
+	from, to = AnalyticsDay(from), AnalyticsDay(to)
+	rows, err := c.db.QueryContext(ctx, `
+	SELECT day, views, unique_viewers, completions, watch_percent_total
+	FROM video_daily_stats
+	WHERE video_id = ? AND day >= ? AND day <= ?
+	ORDER BY day
+	`, videoID, from, to)
+	if err != nil {
+		return VideoAnalytics{}, err
+	}
+	defer rows.Close()
+
+	analytics := VideoAnalytics{Daily: []VideoDailyStats{}}
+	for rows.Next() {
+		var stats VideoDailyStats
+		if err := rows.Scan(&stats.Day, &stats.Views, &stats.UniqueViewers, &stats.Completions, &stats.WatchPercentTotal); err != nil {
+			return VideoAnalytics{}, err
+		}
+		stats.Day = AnalyticsDay(stats.Day)
+		analytics.Views += stats.Views
+		analytics.Completions += stats.Completions
+		analytics.WatchPercentTotal += stats.WatchPercentTotal
+		analytics.Daily = append(analytics.Daily, stats)
+	}
+	if err := rows.Err(); err != nil {
+		return VideoAnalytics{}, err
+	}
+
+	err = c.db.QueryRowContext(ctx, `
+	SELECT COUNT(DISTINCT viewer_hash)
+	FROM playback_daily_viewers
+	WHERE video_id = ? AND day >= ? AND day <= ?
+	`, videoID, from, to).Scan(&analytics.UniqueViewers)
+	if err != nil {
+		return VideoAnalytics{}, err
+	}
+	return analytics, nil
+}
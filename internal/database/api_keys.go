@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKey lets a machine client act as its user within the key's scopes.
+// Only a hash of the key is stored; the key itself is shown once, when it is
+// created. Prefix is the start of the key, so users can tell keys apart.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// Active reports whether the key can still be used at time t.
+func (k APIKey) Active(t time.Time) bool {
+	return k.ExpiresAt == nil || t.Before(*k.ExpiresAt)
+}
+
+type CreateAPIKeyParams struct {
+	UserID    uuid.UUID
+	Name      string
+	Prefix    string
+	KeyHash   string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+const apiKeyColumns = `id, created_at, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at`
+
+func scanAPIKey(row rowScanner) (APIKey, error) {
+	var key APIKey
+	var scopes string
+	err := row.Scan(
+		&key.ID,
+		&key.CreatedAt,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&scopes,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+	)
+	key.Scopes = splitScopes(scopes)
+	return key, err
+}
+
+func (c Client) CreateAPIKey(ctx context.Context, params CreateAPIKeyParams) (APIKey, error) {
+	query := `
+	INSERT INTO api_keys (id, created_at, user_id, name, prefix, key_hash, scopes, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	var expiresAt *time.Time
+	if params.ExpiresAt != nil {
+		t := params.ExpiresAt.UTC().Truncate(time.Microsecond)
+		expiresAt = &t
+	}
+	key := APIKey{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UserID:    params.UserID,
+		Name:      params.Name,
+		Prefix:    params.Prefix,
+		KeyHash:   params.KeyHash,
+		Scopes:    params.Scopes,
+		ExpiresAt: expiresAt,
+	}
+	_, err := c.db.ExecContext(
+		ctx,
+		query,
+		key.ID,
+		key.CreatedAt,
+		key.UserID,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		strings.Join(key.Scopes, ","),
+		key.ExpiresAt,
+	)
+	if err != nil {
+		return APIKey{}, translateError(err)
+	}
+	return key, nil
+}
+
+// GetAPIKeys lists a user's API keys, oldest first, including expired ones.
+func (c Client) GetAPIKeys(ctx context.Context, userID uuid.UUID) ([]APIKey, error) {
+	query := `
+	SELECT ` + apiKeyColumns + `
+	FROM api_keys
+	WHERE user_id = ?
+	ORDER BY created_at, id
+	`
+	rows, err := c.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (c Client) GetAPIKeyByHash(ctx context.Context, keyHash string) (APIKey, error) {
+	query := `
+	SELECT ` + apiKeyColumns + `
+	FROM api_keys
+	WHERE key_hash = ?
+	`
+	key, err := scanAPIKey(c.db.QueryRowContext(ctx, query, keyHash))
+	if err != nil {
+		return APIKey{}, translateError(err)
+	}
+	return key, nil
+}
+
+// DeleteAPIKey removes one of a user's keys. It returns ErrNotFound if the
+// user has no key with that ID.
+func (c Client) DeleteAPIKey(ctx context.Context, userID, id uuid.UUID) error {
+	res, err := c.db.ExecContext(ctx, `DELETE FROM api_keys WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// RecordAPIKeyUse sets when a key was last used.
+func (c Client) RecordAPIKeyUse(ctx context.Context, id uuid.UUID, at time.Time) error {
+	query := `
+	UPDATE api_keys
+	SET last_used_at = ?
+	WHERE id = ?
+	`
+	res, err := c.db.ExecContext(ctx, query, at.UTC().Truncate(time.Microsecond), id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
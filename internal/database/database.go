@@ -1,90 +1,214 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+type dialect string
+
+const (
+	dialectSQLite   dialect = "sqlite3"
+	dialectPostgres dialect = "postgres"
+)
+
+// rebind rewrites "?" placeholders into the form the dialect expects.
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// dbtx is the query surface shared by *sql.DB and *sql.Tx.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn wraps a *sql.DB or *sql.Tx so queries can be written once with "?"
+// placeholders and still run on every supported backend.
+type conn struct {
+	q       dbtx
+	dialect dialect
+}
+
+func (c conn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return c.q.ExecContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c conn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return c.q.QueryContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c conn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return c.q.QueryRowContext(ctx, c.dialect.rebind(query), args...)
+}
+
 type Client struct {
-	db *sql.DB
+	sqlDB *sql.DB
+	db    conn
+	// tx is set on clients handed out by WithTx.
+	tx *sql.Tx
 }
 
-func NewClient(pathToDB string) (Client, error) {
-	db, err := sql.Open("sqlite3", pathToDB)
+// NewClient opens the database and applies any pending migrations.
+// dsn is either a postgres:// URL or a SQLite file path.
+func NewClient(dsn string) (Client, error) {
+	c, err := Open(dsn)
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
-	err = c.autoMigrate()
+	err = c.MigrateUp()
 	if err != nil {
+		c.Close()
 		return Client{}, err
 	}
 	return c, nil
 
 }
 
-func (c *Client) autoMigrate() error {
-	userTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		password TEXT NOT NULL,
-		email TEXT UNIQUE NOT NULL
-	);
-	`
-	_, err := c.db.Exec(userTable)
+// Open opens the database without touching the schema. The backend is picked
+// from the DSN scheme: postgres:// and postgresql:// URLs use Postgres, and
+// anything else (optionally prefixed with sqlite://) is a SQLite file path.
+func Open(dsn string) (Client, error) {
+	d, source := parseDSN(dsn)
+	db, err := sql.Open(string(d), source)
 	if err != nil {
+		return Client{}, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return Client{}, err
+	}
+	if d == dialectSQLite {
+		if err := checkSQLiteFeatures(db); err != nil {
+			db.Close()
+			return Client{}, err
+		}
+	}
+	return Client{sqlDB: db, db: conn{q: db, dialect: d}}, nil
+}
+
+func parseDSN(dsn string) (dialect, string) {
+	switch {
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		return dialectPostgres, dsn
+	case strings.HasPrefix(dsn, "sqlite://"):
+		return dialectSQLite, sqliteDSN(strings.TrimPrefix(dsn, "sqlite://"))
+	default:
+		return dialectSQLite, sqliteDSN(dsn)
+	}
+}
+
+// checkSQLiteFeatures fails fast when the driver was compiled without FTS5,
+// which the search index needs.
+func checkSQLiteFeatures(db *sql.DB) error {
+	var enabled bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled); err != nil {
 		return err
 	}
-	refreshTokenTable := `
-	CREATE TABLE IF NOT EXISTS refresh_tokens (
-		token TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		revoked_at TIMESTAMP,
-		user_id TEXT NOT NULL,
-		expires_at TIMESTAMP NOT NULL,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(refreshTokenTable)
+	if !enabled {
+		return errors.New("SQLite driver was built without FTS5: build with -tags sqlite_fts5")
+	}
+	return nil
+}
+
+// sqliteDSN turns on foreign key enforcement, which SQLite leaves off by default.
+func sqliteDSN(pathToDB string) string {
+	if strings.Contains(pathToDB, "_foreign_keys=") || strings.Contains(pathToDB, "_fk=") {
+		return pathToDB
+	}
+	separator := "?"
+	if strings.Contains(pathToDB, "?") {
+		separator = "&"
+	}
+	return pathToDB + separator + "_foreign_keys=on"
+}
+
+func (c Client) Close() error {
+	return c.sqlDB.Close()
+}
+
+// WithTx runs fn inside a transaction, passing it a Store bound to that
+// transaction. The transaction commits if fn returns nil and rolls back
+// otherwise. Calling WithTx on a Store that is already in a transaction
+// reuses it, so helpers can be composed freely.
+func (c Client) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return c.inTx(ctx, func(tx Client) error {
+		return fn(tx)
+	})
+}
+
+func (c Client) inTx(ctx context.Context, fn func(tx Client) error) (err error) {
+	if c.tx != nil {
+		return fn(c)
+	}
+
+	tx, err := c.sqlDB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
 
-	videoTable := `
-	CREATE TABLE IF NOT EXISTS videos (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		title TEXT NOT NULL,
-		description TEXT,
-		thumbnail_url TEXT,
-		video_url TEXT TEXT,
-		user_id INTEGER,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(videoTable)
+	err = fn(Client{sqlDB: c.sqlDB, db: conn{q: tx, dialect: c.db.dialect}, tx: tx})
 	if err != nil {
 		return err
 	}
-	return nil
+	return tx.Commit()
 }
 
-func (c Client) Reset() error {
-
-	qbDeleteQueries := map[string]string{
-		"refresh_tokens": "DELETE FROM refresh_tokens",
-		"users":          "DELETE FROM users",
-		"videos":         "DELETE FROM videos",
+func (c Client) Reset(ctx context.Context) error {
+	// Children first so foreign keys are never left dangling.
+	tables := []string{
+		"storage_cleanup",
+		"webhook_deliveries",
+		"webhooks",
+		"refresh_tokens",
+		"account_tokens",
+		"user_identities",
+		"api_keys",
+		"video_shares",
+		"video_collaborators",
+		"playlist_videos",
+		"playlists",
+		"video_tags",
+		"tags",
+		"playback_daily_viewers",
+		"playback_sessions",
+		"video_daily_stats",
+		"videos",
+		"users",
 	}
 
-	for tableName, deleteQuery := range qbDeleteQueries {
-		if _, err := c.db.Exec(deleteQuery); err != nil {
+	for _, tableName := range tables {
+		if _, err := c.db.ExecContext(ctx, "DELETE FROM "+tableName); err != nil {
 			return fmt.Errorf("failed to reset table %s: %w", tableName, err)
 		}
 	}
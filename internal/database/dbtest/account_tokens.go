@@ -0,0 +1,72 @@
+package dbtest
+
+import (
+	"context"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) CreateAccountToken(ctx context.Context, params database.CreateAccountTokenParams) (database.AccountToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[params.UserID]; !ok {
+		return database.AccountToken{}, database.ErrNotFound
+	}
+	for _, token := range s.accountTokens {
+		if token.TokenHash == params.TokenHash {
+			return database.AccountToken{}, database.ErrConflict
+		}
+	}
+	token := database.AccountToken{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UserID:    params.UserID,
+		Purpose:   params.Purpose,
+		TokenHash: params.TokenHash,
+		ExpiresAt: params.ExpiresAt.UTC().Truncate(time.Microsecond),
+	}
+	s.accountTokens[token.ID] = token
+	return token, nil
+}
+
+func (s *Store) CountAccountTokens(ctx context.Context, userID uuid.UUID, purpose database.AccountTokenPurpose, since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, token := range s.accountTokens {
+		if token.UserID == userID && token.Purpose == purpose && !token.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *Store) UseAccountToken(ctx context.Context, purpose database.AccountTokenPurpose, tokenHash string) (database.AccountToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found *database.AccountToken
+	for _, token := range s.accountTokens {
+		if token.TokenHash == tokenHash {
+			found = &token
+			break
+		}
+	}
+	if found == nil || found.Purpose != purpose || found.UsedAt != nil || !found.ExpiresAt.After(time.Now()) {
+		return database.AccountToken{}, database.ErrNotFound
+	}
+
+	usedAt := now()
+	for id, token := range s.accountTokens {
+		if token.UserID == found.UserID && token.Purpose == purpose && token.UsedAt == nil {
+			token.UsedAt = &usedAt
+			s.accountTokens[id] = token
+		}
+	}
+	found.UsedAt = &usedAt
+	return *found, nil
+}
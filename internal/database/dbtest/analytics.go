@@ -0,0 +1,134 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type playbackSessionKey struct {
+	videoID   uuid.UUID
+	sessionID string
+}
+
+type playbackSession struct {
+	viewerHash string
+	day        time.Time
+	maxPercent int
+}
+
+type dailyStatsKey struct {
+	videoID uuid.UUID
+	day     time.Time
+}
+
+func (s *Store) RecordPlaybackEvent(ctx context.Context, event database.PlaybackEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.videos[event.VideoID]; !ok {
+		return database.ErrNotFound
+	}
+
+	key := playbackSessionKey{event.VideoID, event.SessionID}
+	session, ok := s.playbackSessions[key]
+	if !ok {
+		day := database.AnalyticsDay(event.At)
+		sessions := 0
+		for k, other := range s.playbackSessions {
+			if k.videoID == event.VideoID && other.viewerHash == event.ViewerHash && other.day.Equal(day) {
+				sessions++
+			}
+		}
+		if sessions >= database.MaxDailySessionsPerViewer {
+			return database.ErrTooManyPlaybackSessions
+		}
+		stats := database.VideoDailyStats{Day: day, Views: 1, WatchPercentTotal: event.Percent}
+		if sessions == 0 {
+			stats.UniqueViewers = 1
+		}
+		if event.Percent >= 100 {
+			stats.Completions = 1
+		}
+		s.playbackSessions[key] = playbackSession{viewerHash: event.ViewerHash, day: day, maxPercent: event.Percent}
+		s.addDailyStats(event.VideoID, stats)
+		return nil
+	}
+
+	if event.Percent <= session.maxPercent {
+		return nil
+	}
+	stats := database.VideoDailyStats{Day: session.day, WatchPercentTotal: event.Percent - session.maxPercent}
+	if event.Percent >= 100 {
+		stats.Completions = 1
+	}
+	session.maxPercent = event.Percent
+	s.playbackSessions[key] = session
+	s.addDailyStats(event.VideoID, stats)
+	return nil
+}
+
+func (s *Store) GetVideoAnalytics(ctx context.Context, videoID uuid.UUID, from, to time.Time) (database.VideoAnalytics, error) {
+	from, to = database.AnalyticsDay(from), database.AnalyticsDay(to)
+	inRange := func(day time.Time) bool {
+		return !day.Before(from) && !day.After(to)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	analytics := database.VideoAnalytics{Daily: []database.VideoDailyStats{}}
+	for key, stats := range s.dailyStats {
+		if key.videoID != videoID || !inRange(key.day) {
+			continue
+		}
+		analytics.Views += stats.Views
+		analytics.Completions += stats.Completions
+		analytics.WatchPercentTotal += stats.WatchPercentTotal
+		analytics.Daily = append(analytics.Daily, stats)
+	}
+	slices.SortFunc(analytics.Daily, func(a, b database.VideoDailyStats) int {
+		return a.Day.Compare(b.Day)
+	})
+
+	viewers := map[string]bool{}
+	for key, session := range s.playbackSessions {
+		if key.videoID == videoID && inRange(session.day) {
+			viewers[session.viewerHash] = true
+		}
+	}
+	analytics.UniqueViewers = len(viewers)
+	return analytics, nil
+}
+
+// addDailyStats adds stats to the counts for its day. The caller must hold s.mu.
+func (s *Store) addDailyStats(videoID uuid.UUID, stats database.VideoDailyStats) {
+	key := dailyStatsKey{videoID, stats.Day}
+	total, ok := s.dailyStats[key]
+	if !ok {
+		total.Day = stats.Day
+	}
+	total.Views += stats.Views
+	total.UniqueViewers += stats.UniqueViewers
+	total.Completions += stats.Completions
+	total.WatchPercentTotal += stats.WatchPercentTotal
+	s.dailyStats[key] = total
+}
+
+// deletePlaybackStats mirrors the ON DELETE CASCADE from videos. The caller
+// must hold s.mu.
+func (s *Store) deletePlaybackStats(videoID uuid.UUID) {
+	for key := range s.playbackSessions {
+		if key.videoID == videoID {
+			delete(s.playbackSessions, key)
+		}
+	}
+	for key := range s.dailyStats {
+		if key.videoID == videoID {
+			delete(s.dailyStats, key)
+		}
+	}
+}
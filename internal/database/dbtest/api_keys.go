@@ -0,0 +1,99 @@
+package dbtest
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) CreateAPIKey(ctx context.Context, params database.CreateAPIKeyParams) (database.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[params.UserID]; !ok {
+		return database.APIKey{}, database.ErrNotFound
+	}
+	for _, key := range s.apiKeys {
+		if key.KeyHash == params.KeyHash {
+			return database.APIKey{}, database.ErrConflict
+		}
+	}
+	var expiresAt *time.Time
+	if params.ExpiresAt != nil {
+		t := params.ExpiresAt.UTC().Truncate(time.Microsecond)
+		expiresAt = &t
+	}
+	key := database.APIKey{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UserID:    params.UserID,
+		Name:      params.Name,
+		Prefix:    params.Prefix,
+		KeyHash:   params.KeyHash,
+		Scopes:    slices.Clone(params.Scopes),
+		ExpiresAt: expiresAt,
+	}
+	s.apiKeys[key.ID] = key
+	return key, nil
+}
+
+func (s *Store) GetAPIKeys(ctx context.Context, userID uuid.UUID) ([]database.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := []database.APIKey{}
+	for _, key := range s.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b database.APIKey) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID.String(), b.ID.String())
+	})
+	return keys, nil
+}
+
+func (s *Store) GetAPIKeyByHash(ctx context.Context, keyHash string) (database.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.apiKeys {
+		if key.KeyHash == keyHash {
+			return key, nil
+		}
+	}
+	return database.APIKey{}, database.ErrNotFound
+}
+
+func (s *Store) DeleteAPIKey(ctx context.Context, userID, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.apiKeys[id]
+	if !ok || key.UserID != userID {
+		return database.ErrNotFound
+	}
+	delete(s.apiKeys, id)
+	return nil
+}
+
+func (s *Store) RecordAPIKeyUse(ctx context.Context, id uuid.UUID, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.apiKeys[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	t := at.UTC().Truncate(time.Microsecond)
+	key.LastUsedAt = &t
+	s.apiKeys[id] = key
+	return nil
+}
@@ -0,0 +1,112 @@
+// Package dbtest provides an in-memory database.Store for handler tests.
+package dbtest
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Store is an in-memory implementation of database.Store. It follows the
+// same contract as the SQL client: missing rows return database.ErrNotFound
+// and duplicate keys return database.ErrConflict. It is safe for concurrent use.
+type Store struct {
+	mu sync.Mutex
+	state
+}
+
+type state struct {
+	users            map[uuid.UUID]database.User
+	refreshTokens    map[string]database.RefreshToken
+	videos           map[uuid.UUID]database.Video
+	videoShares      map[uuid.UUID]database.VideoShare
+	collaborators    map[collaboratorKey]database.VideoCollaborator
+	playlists        map[uuid.UUID]database.Playlist
+	playlistVideos   map[playlistVideoKey]playlistVideo
+	playbackSessions map[playbackSessionKey]playbackSession
+	dailyStats       map[dailyStatsKey]database.VideoDailyStats
+	webhooks         map[uuid.UUID]database.Webhook
+	deliveries       map[uuid.UUID]database.WebhookDelivery
+	storageCleanups  map[uuid.UUID]database.StorageCleanup
+	apiKeys          map[uuid.UUID]database.APIKey
+	accountTokens    map[uuid.UUID]database.AccountToken
+	identities       map[identityKey]uuid.UUID
+}
+
+func newState() state {
+	return state{
+		users:            map[uuid.UUID]database.User{},
+		refreshTokens:    map[string]database.RefreshToken{},
+		videos:           map[uuid.UUID]database.Video{},
+		videoShares:      map[uuid.UUID]database.VideoShare{},
+		collaborators:    map[collaboratorKey]database.VideoCollaborator{},
+		playlists:        map[uuid.UUID]database.Playlist{},
+		playlistVideos:   map[playlistVideoKey]playlistVideo{},
+		playbackSessions: map[playbackSessionKey]playbackSession{},
+		dailyStats:       map[dailyStatsKey]database.VideoDailyStats{},
+		webhooks:         map[uuid.UUID]database.Webhook{},
+		deliveries:       map[uuid.UUID]database.WebhookDelivery{},
+		storageCleanups:  map[uuid.UUID]database.StorageCleanup{},
+		apiKeys:          map[uuid.UUID]database.APIKey{},
+		accountTokens:    map[uuid.UUID]database.AccountToken{},
+		identities:       map[identityKey]uuid.UUID{},
+	}
+}
+
+func (st state) clone() state {
+	return state{
+		users:            maps.Clone(st.users),
+		refreshTokens:    maps.Clone(st.refreshTokens),
+		videos:           maps.Clone(st.videos),
+		videoShares:      maps.Clone(st.videoShares),
+		collaborators:    maps.Clone(st.collaborators),
+		playlists:        maps.Clone(st.playlists),
+		playlistVideos:   maps.Clone(st.playlistVideos),
+		playbackSessions: maps.Clone(st.playbackSessions),
+		dailyStats:       maps.Clone(st.dailyStats),
+		webhooks:         maps.Clone(st.webhooks),
+		deliveries:       maps.Clone(st.deliveries),
+		storageCleanups:  maps.Clone(st.storageCleanups),
+		apiKeys:          maps.Clone(st.apiKeys),
+		accountTokens:    maps.Clone(st.accountTokens),
+		identities:       maps.Clone(st.identities),
+	}
+}
+
+var _ database.Store = (*Store)(nil)
+
+// NewStore returns an empty Store.
+func NewStore() *Store {
+	return &Store{state: newState()}
+}
+
+// WithTx snapshots the store and restores the snapshot if fn fails. Unlike
+// a real transaction it does not isolate fn from concurrent writers.
+func (s *Store) WithTx(ctx context.Context, fn func(tx database.Store) error) error {
+	s.mu.Lock()
+	snapshot := s.state.clone()
+	s.mu.Unlock()
+
+	if err := fn(s); err != nil {
+		s.mu.Lock()
+		s.state = snapshot
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (s *Store) Reset(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = newState()
+	return nil
+}
+
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
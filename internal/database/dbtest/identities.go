@@ -0,0 +1,43 @@
+package dbtest
+
+import (
+	"context"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type identityKey struct {
+	issuer  string
+	subject string
+}
+
+func (s *Store) GetUserByIdentity(ctx context.Context, issuer, subject string) (*database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID, ok := s.identities[identityKey{issuer, subject}]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *Store) LinkUserIdentity(ctx context.Context, userID uuid.UUID, issuer, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return database.ErrNotFound
+	}
+	key := identityKey{issuer, subject}
+	if _, ok := s.identities[key]; ok {
+		return database.ErrConflict
+	}
+	s.identities[key] = userID
+	return nil
+}
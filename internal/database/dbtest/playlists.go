@@ -0,0 +1,262 @@
+package dbtest
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type playlistVideoKey struct {
+	playlistID uuid.UUID
+	videoID    uuid.UUID
+}
+
+type playlistVideo struct {
+	playlistVideoKey
+	position int
+}
+
+func (s *Store) CreatePlaylist(ctx context.Context, params database.CreatePlaylistParams) (database.Playlist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[params.UserID]; !ok {
+		return database.Playlist{}, database.ErrNotFound
+	}
+	if params.Visibility == "" {
+		params.Visibility = database.VideoVisibilityPrivate
+	}
+	createdAt := now()
+	playlist := database.Playlist{
+		ID:          uuid.New(),
+		CreatedAt:   createdAt,
+		UpdatedAt:   createdAt,
+		UserID:      params.UserID,
+		Title:       params.Title,
+		Description: params.Description,
+		Visibility:  params.Visibility,
+	}
+	s.playlists[playlist.ID] = playlist
+	return s.derivePlaylist(playlist), nil
+}
+
+func (s *Store) GetPlaylist(ctx context.Context, id uuid.UUID) (database.Playlist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	playlist, ok := s.playlists[id]
+	if !ok {
+		return database.Playlist{}, database.ErrNotFound
+	}
+	return s.derivePlaylist(playlist), nil
+}
+
+func (s *Store) GetPlaylists(ctx context.Context, userID uuid.UUID) ([]database.Playlist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	playlists := []database.Playlist{}
+	for _, playlist := range s.playlists {
+		if playlist.UserID == userID {
+			playlists = append(playlists, s.derivePlaylist(playlist))
+		}
+	}
+	slices.SortFunc(playlists, func(a, b database.Playlist) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID.String(), b.ID.String())
+	})
+	return playlists, nil
+}
+
+func (s *Store) UpdatePlaylist(ctx context.Context, playlist database.Playlist) (database.Playlist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.playlists[playlist.ID]
+	if !ok {
+		return database.Playlist{}, database.ErrNotFound
+	}
+	if playlist.CoverVideoID != nil {
+		if _, ok := s.videos[*playlist.CoverVideoID]; !ok {
+			return database.Playlist{}, database.ErrNotFound
+		}
+	}
+	existing.UpdatedAt = now()
+	existing.Title = playlist.Title
+	existing.Description = playlist.Description
+	existing.Visibility = playlist.Visibility
+	existing.CoverVideoID = playlist.CoverVideoID
+	s.playlists[existing.ID] = existing
+	return s.derivePlaylist(existing), nil
+}
+
+func (s *Store) DeletePlaylist(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.playlists[id]; !ok {
+		return database.ErrNotFound
+	}
+	s.deletePlaylist(id)
+	return nil
+}
+
+func (s *Store) GetPlaylistVideos(ctx context.Context, playlistID uuid.UUID) ([]database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.playlistItems(playlistID)
+	videos := make([]database.Video, len(items))
+	for i, item := range items {
+		videos[i] = s.videos[item.videoID]
+	}
+	return videos, nil
+}
+
+func (s *Store) AddPlaylistVideo(ctx context.Context, playlistID, videoID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.playlists[playlistID]; !ok {
+		return database.ErrNotFound
+	}
+	if _, ok := s.videos[videoID]; !ok {
+		return database.ErrNotFound
+	}
+	key := playlistVideoKey{playlistID, videoID}
+	if _, ok := s.playlistVideos[key]; ok {
+		return database.ErrConflict
+	}
+
+	position := 0
+	for _, item := range s.playlistItems(playlistID) {
+		position = max(position, item.position+1)
+	}
+	s.playlistVideos[key] = playlistVideo{playlistVideoKey: key, position: position}
+	s.touchPlaylist(playlistID)
+	return nil
+}
+
+func (s *Store) RemovePlaylistVideo(ctx context.Context, playlistID, videoID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := playlistVideoKey{playlistID, videoID}
+	if _, ok := s.playlistVideos[key]; !ok {
+		return database.ErrNotFound
+	}
+	delete(s.playlistVideos, key)
+
+	playlist := s.playlists[playlistID]
+	if playlist.CoverVideoID != nil && *playlist.CoverVideoID == videoID {
+		playlist.CoverVideoID = nil
+		s.playlists[playlistID] = playlist
+	}
+	s.touchPlaylist(playlistID)
+	return nil
+}
+
+func (s *Store) ReorderPlaylistVideos(ctx context.Context, playlistID uuid.UUID, videoIDs []uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.playlists[playlistID]; !ok {
+		return database.ErrNotFound
+	}
+	items := s.playlistItems(playlistID)
+	current := make([]uuid.UUID, len(items))
+	for i, item := range items {
+		current[i] = item.videoID
+	}
+	if !database.IsPlaylistOrder(current, videoIDs) {
+		return database.ErrInvalidPlaylistOrder
+	}
+
+	for i, videoID := range videoIDs {
+		key := playlistVideoKey{playlistID, videoID}
+		s.playlistVideos[key] = playlistVideo{playlistVideoKey: key, position: i}
+	}
+	s.touchPlaylist(playlistID)
+	return nil
+}
+
+// playlistItems returns a playlist's entries in position order. The caller
+// must hold s.mu.
+func (s *Store) playlistItems(playlistID uuid.UUID) []playlistVideo {
+	items := []playlistVideo{}
+	for key, item := range s.playlistVideos {
+		if key.playlistID == playlistID {
+			items = append(items, item)
+		}
+	}
+	slices.SortFunc(items, func(a, b playlistVideo) int {
+		return cmp.Compare(a.position, b.position)
+	})
+	return items
+}
+
+// derivePlaylist fills in the fields the SQL client computes when reading a
+// playlist. The caller must hold s.mu.
+func (s *Store) derivePlaylist(playlist database.Playlist) database.Playlist {
+	items := s.playlistItems(playlist.ID)
+	playlist.VideoCount = 0
+	for _, item := range items {
+		if s.videos[item.videoID].Visibility != database.VideoVisibilityPrivate {
+			playlist.VideoCount++
+		}
+	}
+	playlist.CoverThumbnailURL = nil
+	if playlist.CoverVideoID != nil {
+		if video := s.videos[*playlist.CoverVideoID]; video.Visibility != database.VideoVisibilityPrivate {
+			playlist.CoverThumbnailURL = video.ThumbnailURL
+		}
+	}
+	if playlist.CoverThumbnailURL == nil {
+		for _, item := range items {
+			if video := s.videos[item.videoID]; video.Visibility != database.VideoVisibilityPrivate {
+				playlist.CoverThumbnailURL = video.ThumbnailURL
+				break
+			}
+		}
+	}
+	return playlist
+}
+
+// touchPlaylist stamps a playlist's updated_at. The caller must hold s.mu.
+func (s *Store) touchPlaylist(id uuid.UUID) {
+	playlist := s.playlists[id]
+	playlist.UpdatedAt = now()
+	s.playlists[id] = playlist
+}
+
+// deletePlaylist removes a playlist and its entries. The caller must hold s.mu.
+func (s *Store) deletePlaylist(id uuid.UUID) {
+	delete(s.playlists, id)
+	for key := range s.playlistVideos {
+		if key.playlistID == id {
+			delete(s.playlistVideos, key)
+		}
+	}
+}
+
+// deleteVideoFromPlaylists mirrors the cascades from videos: the video's
+// entries are deleted and covers that pointed at it are cleared. The caller
+// must hold s.mu.
+func (s *Store) deleteVideoFromPlaylists(videoID uuid.UUID) {
+	for key := range s.playlistVideos {
+		if key.videoID == videoID {
+			delete(s.playlistVideos, key)
+		}
+	}
+	for id, playlist := range s.playlists {
+		if playlist.CoverVideoID != nil && *playlist.CoverVideoID == videoID {
+			playlist.CoverVideoID = nil
+			s.playlists[id] = playlist
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) CreateRefreshToken(ctx context.Context, params database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.refreshTokens[params.TokenHash]; ok {
+		return database.RefreshToken{}, database.ErrConflict
+	}
+	if _, ok := s.users[params.UserID]; !ok {
+		return database.RefreshToken{}, database.ErrNotFound
+	}
+
+	if params.FamilyID == uuid.Nil {
+		params.FamilyID = uuid.New()
+	}
+	params.Scopes = slices.Clone(params.Scopes)
+	createdAt := now()
+	rt := database.RefreshToken{
+		CreateRefreshTokenParams: params,
+		CreatedAt:                createdAt,
+		UpdatedAt:                createdAt,
+		SessionCreatedAt:         createdAt,
+	}
+	s.refreshTokens[params.TokenHash] = rt
+	return rt, nil
+}
+
+func (s *Store) RotateRefreshToken(ctx context.Context, tokenHash string, next database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.refreshTokens[tokenHash]
+	if !ok {
+		return database.RefreshToken{}, database.ErrNotFound
+	}
+	if current.RevokedAt != nil {
+		s.revokeRefreshTokenFamily(current.FamilyID)
+		return database.RefreshToken{}, database.ErrRefreshTokenReused
+	}
+	if !current.ExpiresAt.After(time.Now()) {
+		return database.RefreshToken{}, database.ErrNotFound
+	}
+	if _, ok := s.refreshTokens[next.TokenHash]; ok {
+		return database.RefreshToken{}, database.ErrConflict
+	}
+
+	revokedAt := now()
+	current.RevokedAt = &revokedAt
+	current.UpdatedAt = revokedAt
+	current.ReplacedByHash = &next.TokenHash
+	s.refreshTokens[tokenHash] = current
+
+	next.UserID = current.UserID
+	next.FamilyID = current.FamilyID
+	next.Scopes = current.Scopes
+	rt := database.RefreshToken{
+		CreateRefreshTokenParams: next,
+		CreatedAt:                now(),
+		UpdatedAt:                now(),
+		SessionCreatedAt:         current.SessionCreatedAt,
+	}
+	s.refreshTokens[next.TokenHash] = rt
+	return rt, nil
+}
+
+// revokeRefreshTokenFamily revokes every live token in a family. The caller
+// must hold s.mu.
+func (s *Store) revokeRefreshTokenFamily(familyID uuid.UUID) {
+	revokedAt := now()
+	for tokenHash, rt := range s.refreshTokens {
+		if rt.FamilyID == familyID && rt.RevokedAt == nil {
+			rt.RevokedAt = &revokedAt
+			rt.UpdatedAt = revokedAt
+			s.refreshTokens[tokenHash] = rt
+		}
+	}
+}
+
+func (s *Store) GetRefreshToken(ctx context.Context, tokenHash string) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.refreshTokens[tokenHash]
+	if !ok {
+		return database.RefreshToken{}, database.ErrNotFound
+	}
+	return rt, nil
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.refreshTokens[tokenHash]
+	if !ok {
+		return database.ErrNotFound
+	}
+	revokedAt := now()
+	rt.RevokedAt = &revokedAt
+	s.refreshTokens[tokenHash] = rt
+	return nil
+}
+
+func (s *Store) DeleteRefreshToken(ctx context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.refreshTokens[tokenHash]; !ok {
+		return database.ErrNotFound
+	}
+	delete(s.refreshTokens, tokenHash)
+	return nil
+}
@@ -0,0 +1,85 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// SearchVideos matches every term as a word prefix in the title,
+// description or tags. Title matches outrank description matches, which
+// outrank tag matches.
+func (s *Store) SearchVideos(ctx context.Context, params database.SearchVideosParams) ([]database.VideoSearchResult, error) {
+	params = params.Normalize()
+	terms := database.SearchTerms(params.Query)
+	if len(terms) == 0 {
+		return nil, database.ErrEmptyQuery
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := []database.VideoSearchResult{}
+	for _, video := range s.videos {
+		if video.UserID != params.UserID {
+			continue
+		}
+		titleWords := database.SearchTerms(video.Title)
+		descriptionWords := database.SearchTerms(video.Description)
+		tagWords := database.SearchTerms(strings.Join(video.Tags, " "))
+
+		rank := 0.0
+		matchedAll := true
+		for _, term := range terms {
+			inTitle := countPrefixMatches(titleWords, term)
+			inDescription := countPrefixMatches(descriptionWords, term)
+			inTags := countPrefixMatches(tagWords, term)
+			if inTitle+inDescription+inTags == 0 {
+				matchedAll = false
+				break
+			}
+			rank += 10*float64(inTitle) + 4*float64(inDescription) + 2*float64(inTags)
+		}
+		if !matchedAll {
+			continue
+		}
+
+		results = append(results, database.VideoSearchResult{
+			Video:              video,
+			Rank:               rank,
+			TitleHighlight:     database.HighlightHTML(database.HighlightTerms(video.Title, terms)),
+			DescriptionSnippet: database.HighlightHTML(database.HighlightTerms(video.Description, terms)),
+		})
+	}
+
+	slices.SortFunc(results, func(a, b database.VideoSearchResult) int {
+		switch {
+		case a.Rank > b.Rank:
+			return -1
+		case a.Rank < b.Rank:
+			return 1
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+
+	if params.Offset >= len(results) {
+		return []database.VideoSearchResult{}, nil
+	}
+	results = results[params.Offset:]
+	if len(results) > params.Limit {
+		results = results[:params.Limit]
+	}
+	return results, nil
+}
+
+func countPrefixMatches(words []string, term string) int {
+	n := 0
+	for _, word := range words {
+		if strings.HasPrefix(word, term) {
+			n++
+		}
+	}
+	return n
+}
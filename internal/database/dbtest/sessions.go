@@ -0,0 +1,72 @@
+package dbtest
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetSessions(ctx context.Context, userID uuid.UUID) ([]database.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := []database.Session{}
+	for _, rt := range s.refreshTokens {
+		if rt.UserID != userID || rt.RevokedAt != nil || !rt.ExpiresAt.After(time.Now()) {
+			continue
+		}
+		sessions = append(sessions, database.Session{
+			ID:         rt.FamilyID,
+			CreatedAt:  rt.SessionCreatedAt,
+			LastUsedAt: rt.CreatedAt,
+			ExpiresAt:  rt.ExpiresAt,
+			UserAgent:  rt.UserAgent,
+			IPAddress:  rt.IPAddress,
+			Scopes:     rt.Scopes,
+		})
+	}
+	slices.SortFunc(sessions, func(a, b database.Session) int {
+		if c := b.LastUsedAt.Compare(a.LastUsedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID.String(), b.ID.String())
+	})
+	return sessions, nil
+}
+
+func (s *Store) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := false
+	for _, rt := range s.refreshTokens {
+		if rt.UserID == userID && rt.FamilyID == sessionID && rt.RevokedAt == nil {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return database.ErrNotFound
+	}
+	s.revokeRefreshTokenFamily(sessionID)
+	return nil
+}
+
+func (s *Store) RevokeOtherSessions(ctx context.Context, userID, keep uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revokedAt := now()
+	for tokenHash, rt := range s.refreshTokens {
+		if rt.UserID == userID && rt.FamilyID != keep && rt.RevokedAt == nil {
+			rt.RevokedAt = &revokedAt
+			rt.UpdatedAt = revokedAt
+			s.refreshTokens[tokenHash] = rt
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package dbtest
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) EnqueueStorageCleanup(ctx context.Context, kind, bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := database.StorageCleanup{
+		ID:            uuid.New(),
+		CreatedAt:     now(),
+		Kind:          kind,
+		Bucket:        bucket,
+		Key:           key,
+		NextAttemptAt: now(),
+	}
+	s.storageCleanups[item.ID] = item
+	return nil
+}
+
+func (s *Store) GetDueStorageCleanup(ctx context.Context, limit int) ([]database.StorageCleanup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := []database.StorageCleanup{}
+	for _, item := range s.storageCleanups {
+		if !item.NextAttemptAt.After(now()) {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].NextAttemptAt.Before(items[j].NextAttemptAt)
+	})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+func (s *Store) CompleteStorageCleanup(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.storageCleanups[id]; !ok {
+		return database.ErrNotFound
+	}
+	delete(s.storageCleanups, id)
+	return nil
+}
+
+func (s *Store) RetryStorageCleanup(ctx context.Context, id uuid.UUID, lastError string, nextAttemptAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.storageCleanups[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	item.Attempts++
+	item.LastError = &lastError
+	item.NextAttemptAt = nextAttemptAt.UTC()
+	s.storageCleanups[item.ID] = item
+	return nil
+}
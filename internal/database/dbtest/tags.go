@@ -0,0 +1,54 @@
+package dbtest
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func (s *Store) ListTags(ctx context.Context, params database.ListTagsParams) ([]database.Tag, error) {
+	params = params.Normalize()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := map[string]int{}
+	for _, video := range s.videos {
+		if video.UserID != params.UserID {
+			continue
+		}
+		for _, tag := range video.Tags {
+			if strings.HasPrefix(tag, params.Prefix) {
+				counts[tag]++
+			}
+		}
+	}
+
+	tags := make([]database.Tag, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, database.Tag{Name: name, VideoCount: count})
+	}
+	slices.SortFunc(tags, func(a, b database.Tag) int {
+		if c := cmp.Compare(b.VideoCount, a.VideoCount); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	if len(tags) > params.Limit {
+		tags = tags[:params.Limit]
+	}
+	return tags, nil
+}
+
+// hasAllTags reports whether video carries every one of tags.
+func hasAllTags(video database.Video, tags []string) bool {
+	for _, tag := range database.NormalizeTags(tags) {
+		if !slices.Contains(video.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+package dbtest
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetUsers(ctx context.Context) ([]database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := []database.User{}
+	for _, user := range s.users {
+		users = append(users, database.User{ID: user.ID, CreateUserParams: database.CreateUserParams{Email: user.Email}})
+	}
+	return users, nil
+}
+
+func (s *Store) GetUser(ctx context.Context, id uuid.UUID) (*database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return database.User{}, database.ErrNotFound
+}
+
+func (s *Store) GetUserByRefreshToken(ctx context.Context, tokenHash string) (*database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.refreshTokens[tokenHash]
+	if !ok || rt.RevokedAt != nil || !rt.ExpiresAt.After(time.Now()) {
+		return nil, database.ErrNotFound
+	}
+	user, ok := s.users[rt.UserID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, params database.CreateUserParams) (*database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, params.Email) {
+			return nil, database.ErrConflict
+		}
+	}
+
+	user := database.User{
+		ID:               uuid.New(),
+		CreatedAt:        now(),
+		UpdatedAt:        now(),
+		CreateUserParams: params,
+	}
+	s.users[user.ID] = user
+	return &user, nil
+}
+
+func (s *Store) UpdateUserPassword(ctx context.Context, id uuid.UUID, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	user.Password = password
+	user.UpdatedAt = now()
+	s.users[id] = user
+	return nil
+}
+
+func (s *Store) MarkEmailVerified(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	if user.EmailVerifiedAt == nil {
+		verifiedAt := now()
+		user.EmailVerifiedAt = &verifiedAt
+	}
+	user.UpdatedAt = now()
+	s.users[id] = user
+	return nil
+}
+
+func (s *Store) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return database.ErrNotFound
+	}
+	delete(s.users, id)
+	for token, rt := range s.refreshTokens {
+		if rt.UserID == id {
+			delete(s.refreshTokens, token)
+		}
+	}
+	for videoID, video := range s.videos {
+		if video.UserID == id {
+			delete(s.videos, videoID)
+			s.deleteVideoShares(videoID)
+			s.deleteVideoCollaborators(videoID)
+			s.deleteVideoFromPlaylists(videoID)
+			s.deletePlaybackStats(videoID)
+		}
+	}
+	for playlistID, playlist := range s.playlists {
+		if playlist.UserID == id {
+			s.deletePlaylist(playlistID)
+		}
+	}
+	for key := range s.collaborators {
+		if key.userID == id {
+			delete(s.collaborators, key)
+		}
+	}
+	for webhookID, webhook := range s.webhooks {
+		if webhook.UserID == id {
+			s.deleteWebhook(webhookID)
+		}
+	}
+	for keyID, key := range s.apiKeys {
+		if key.UserID == id {
+			delete(s.apiKeys, keyID)
+		}
+	}
+	for tokenID, token := range s.accountTokens {
+		if token.UserID == id {
+			delete(s.accountTokens, tokenID)
+		}
+	}
+	for key, userID := range s.identities {
+		if userID == id {
+			delete(s.identities, key)
+		}
+	}
+	return nil
+}
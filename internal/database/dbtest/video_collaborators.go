@@ -0,0 +1,106 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type collaboratorKey struct {
+	videoID uuid.UUID
+	userID  uuid.UUID
+}
+
+func (s *Store) GetVideoCollaborator(ctx context.Context, videoID, userID uuid.UUID) (database.VideoCollaborator, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collaborator, ok := s.collaborators[collaboratorKey{videoID, userID}]
+	if !ok {
+		return database.VideoCollaborator{}, database.ErrNotFound
+	}
+	return s.withEmail(collaborator), nil
+}
+
+func (s *Store) GetVideoCollaborators(ctx context.Context, videoID uuid.UUID) ([]database.VideoCollaborator, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collaborators := []database.VideoCollaborator{}
+	for key, collaborator := range s.collaborators {
+		if key.videoID == videoID {
+			collaborators = append(collaborators, s.withEmail(collaborator))
+		}
+	}
+	slices.SortFunc(collaborators, func(a, b database.VideoCollaborator) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Email, b.Email)
+	})
+	return collaborators, nil
+}
+
+func (s *Store) SetVideoCollaborator(ctx context.Context, videoID, userID uuid.UUID, role database.VideoRole) (database.VideoCollaborator, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.videos[videoID]; !ok {
+		return database.VideoCollaborator{}, database.ErrNotFound
+	}
+	if _, ok := s.users[userID]; !ok {
+		return database.VideoCollaborator{}, database.ErrNotFound
+	}
+
+	key := collaboratorKey{videoID, userID}
+	collaborator, ok := s.collaborators[key]
+	if !ok {
+		collaborator = database.VideoCollaborator{
+			VideoID:   videoID,
+			UserID:    userID,
+			CreatedAt: now(),
+		}
+	}
+	collaborator.Role = role
+	s.collaborators[key] = collaborator
+	return s.withEmail(collaborator), nil
+}
+
+func (s *Store) DeleteVideoCollaborator(ctx context.Context, videoID, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := collaboratorKey{videoID, userID}
+	if _, ok := s.collaborators[key]; !ok {
+		return database.ErrNotFound
+	}
+	delete(s.collaborators, key)
+	return nil
+}
+
+// withEmail fills in the collaborator's email the way the SQL client joins
+// it from users. The caller must hold s.mu.
+func (s *Store) withEmail(collaborator database.VideoCollaborator) database.VideoCollaborator {
+	collaborator.Email = s.users[collaborator.UserID].Email
+	return collaborator
+}
+
+// hasCollaborator reports whether userID has a role on videoID. The caller
+// must hold s.mu.
+func (s *Store) hasCollaborator(videoID, userID uuid.UUID) bool {
+	_, ok := s.collaborators[collaboratorKey{videoID, userID}]
+	return ok
+}
+
+// deleteVideoCollaborators mirrors the ON DELETE CASCADE from videos. The
+// caller must hold s.mu.
+func (s *Store) deleteVideoCollaborators(videoID uuid.UUID) {
+	for key := range s.collaborators {
+		if key.videoID == videoID {
+			delete(s.collaborators, key)
+		}
+	}
+}
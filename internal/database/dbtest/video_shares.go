@@ -0,0 +1,112 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) CreateVideoShare(ctx context.Context, params database.CreateVideoShareParams) (database.VideoShare, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.videos[params.VideoID]; !ok {
+		return database.VideoShare{}, database.ErrNotFound
+	}
+	for _, share := range s.videoShares {
+		if share.TokenHash == params.TokenHash {
+			return database.VideoShare{}, database.ErrConflict
+		}
+	}
+
+	var expiresAt *time.Time
+	if params.ExpiresAt != nil {
+		t := params.ExpiresAt.UTC().Truncate(time.Microsecond)
+		expiresAt = &t
+	}
+	share := database.VideoShare{
+		ID:           uuid.New(),
+		CreatedAt:    now(),
+		VideoID:      params.VideoID,
+		TokenHash:    params.TokenHash,
+		ExpiresAt:    expiresAt,
+		MaxViews:     params.MaxViews,
+		PasswordHash: params.PasswordHash,
+	}
+	s.videoShares[share.ID] = share
+	return share, nil
+}
+
+func (s *Store) GetVideoShares(ctx context.Context, videoID uuid.UUID) ([]database.VideoShare, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shares := []database.VideoShare{}
+	for _, share := range s.videoShares {
+		if share.VideoID == videoID {
+			shares = append(shares, share)
+		}
+	}
+	slices.SortFunc(shares, func(a, b database.VideoShare) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return shares, nil
+}
+
+func (s *Store) GetVideoShareByTokenHash(ctx context.Context, tokenHash string) (database.VideoShare, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, share := range s.videoShares {
+		if share.TokenHash == tokenHash {
+			return share, nil
+		}
+	}
+	return database.VideoShare{}, database.ErrNotFound
+}
+
+func (s *Store) RevokeVideoShare(ctx context.Context, videoID, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	share, ok := s.videoShares[id]
+	if !ok || share.VideoID != videoID {
+		return database.ErrNotFound
+	}
+	if share.RevokedAt == nil {
+		t := now()
+		share.RevokedAt = &t
+		s.videoShares[id] = share
+	}
+	return nil
+}
+
+func (s *Store) RecordVideoShareView(ctx context.Context, id uuid.UUID, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	share, ok := s.videoShares[id]
+	if !ok || !share.Active(at) {
+		return database.ErrNotFound
+	}
+	share.ViewCount++
+	s.videoShares[id] = share
+	return nil
+}
+
+// deleteVideoShares mirrors the ON DELETE CASCADE from videos. The caller
+// must hold s.mu.
+func (s *Store) deleteVideoShares(videoID uuid.UUID) {
+	for id, share := range s.videoShares {
+		if share.VideoID == videoID {
+			delete(s.videoShares, id)
+		}
+	}
+}
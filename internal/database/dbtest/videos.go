@@ -0,0 +1,159 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) ListVideos(ctx context.Context, params database.ListVideosParams) (database.VideoPage, error) {
+	params = params.Normalize()
+	if !params.Sort.Valid() {
+		return database.VideoPage{}, database.ErrInvalidCursor
+	}
+
+	var after *database.Video
+	if params.After != "" {
+		cursor, err := database.DecodeVideoCursor(params.After, params.Sort, params.Ascending)
+		if err != nil {
+			return database.VideoPage{}, err
+		}
+		v := cursor.Video()
+		after = &v
+	}
+
+	// compare orders videos the way the listing walks them.
+	compare := func(a, b database.Video) int {
+		c := database.CompareVideos(a, b, params.Sort)
+		if !params.Ascending {
+			c = -c
+		}
+		return c
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	videos := []database.Video{}
+	for _, video := range s.videos {
+		if (params.UserID != uuid.Nil && video.UserID != params.UserID) ||
+			(params.SharedWith != uuid.Nil && !s.hasCollaborator(video.ID, params.SharedWith)) ||
+			(params.Status != "" && video.Status != params.Status) ||
+			(params.Visibility != "" && video.Visibility != params.Visibility) ||
+			(params.HasVideo != nil && (video.VideoURL != nil) != *params.HasVideo) ||
+			(params.CreatedAfter != nil && video.CreatedAt.Before(*params.CreatedAfter)) ||
+			(params.CreatedBefore != nil && !video.CreatedAt.Before(*params.CreatedBefore)) ||
+			(params.AspectRatio != "" && (video.AspectRatio == nil || *video.AspectRatio != params.AspectRatio)) ||
+			!hasAllTags(video, params.Tags) ||
+			(after != nil && compare(video, *after) <= 0) {
+			continue
+		}
+		videos = append(videos, video)
+	}
+	slices.SortFunc(videos, compare)
+
+	page := database.VideoPage{Videos: videos}
+	if len(videos) > params.Limit {
+		page.Videos = videos[:params.Limit]
+		next := database.NewVideoCursor(page.Videos[params.Limit-1], params.Sort, params.Ascending).Encode()
+		page.NextCursor = &next
+	}
+	return page, nil
+}
+
+func (s *Store) GetVideo(ctx context.Context, id uuid.UUID) (database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	video, ok := s.videos[id]
+	if !ok {
+		return database.Video{}, database.ErrNotFound
+	}
+	return video, nil
+}
+
+func (s *Store) CreateVideo(ctx context.Context, params database.CreateVideoParams) (database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[params.UserID]; !ok {
+		return database.Video{}, database.ErrNotFound
+	}
+
+	if params.Visibility == "" {
+		params.Visibility = database.VideoVisibilityPrivate
+	}
+	params.Tags = database.NormalizeTags(params.Tags)
+	video := database.Video{
+		ID:                uuid.New(),
+		CreatedAt:         now(),
+		UpdatedAt:         now(),
+		Status:            database.VideoStatusDraft,
+		CreateVideoParams: params,
+	}
+	s.videos[video.ID] = video
+	return video, nil
+}
+
+func (s *Store) UpdateVideo(ctx context.Context, video database.Video) (database.Video, error) {
+	return s.updateVideo(video, nil)
+}
+
+func (s *Store) UpdateVideoIfUnmodified(ctx context.Context, video database.Video, unmodifiedSince time.Time) (database.Video, error) {
+	return s.updateVideo(video, &unmodifiedSince)
+}
+
+func (s *Store) updateVideo(video database.Video, unmodifiedSince *time.Time) (database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.videos[video.ID]
+	if !ok {
+		return database.Video{}, database.ErrNotFound
+	}
+	if unmodifiedSince != nil && !existing.UpdatedAt.Equal(*unmodifiedSince) {
+		return database.Video{}, database.ErrStale
+	}
+	video.CreatedAt = existing.CreatedAt
+	video.UpdatedAt = now()
+	if video.Tags == nil {
+		video.Tags = existing.Tags
+	} else {
+		video.Tags = database.NormalizeTags(video.Tags)
+	}
+	s.videos[video.ID] = video
+	return video, nil
+}
+
+// SetVideoCreatedAt changes when a video was created, which the store
+// otherwise always sets itself, so tests can give videos the same time.
+func (s *Store) SetVideoCreatedAt(id uuid.UUID, createdAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	video, ok := s.videos[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	video.CreatedAt = createdAt.UTC().Truncate(time.Microsecond)
+	s.videos[id] = video
+	return nil
+}
+
+func (s *Store) DeleteVideo(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.videos[id]; !ok {
+		return database.ErrNotFound
+	}
+	delete(s.videos, id)
+	s.deleteVideoShares(id)
+	s.deleteVideoCollaborators(id)
+	s.deleteVideoFromPlaylists(id)
+	s.deletePlaybackStats(id)
+	return nil
+}
@@ -0,0 +1,236 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) CreateWebhook(ctx context.Context, params database.CreateWebhookParams) (database.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[params.UserID]; !ok {
+		return database.Webhook{}, database.ErrNotFound
+	}
+	webhook := database.Webhook{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UserID:    params.UserID,
+		URL:       params.URL,
+		Events:    slices.Clone(params.Events),
+		Secret:    params.Secret,
+	}
+	s.webhooks[webhook.ID] = webhook
+	return webhook, nil
+}
+
+func (s *Store) GetWebhook(ctx context.Context, id uuid.UUID) (database.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, ok := s.webhooks[id]
+	if !ok {
+		return database.Webhook{}, database.ErrNotFound
+	}
+	return webhook, nil
+}
+
+func (s *Store) GetWebhooks(ctx context.Context, userID uuid.UUID) ([]database.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.userWebhooks(userID), nil
+}
+
+// userWebhooks returns a user's webhooks, oldest first. The caller must hold
+// s.mu.
+func (s *Store) userWebhooks(userID uuid.UUID) []database.Webhook {
+	webhooks := []database.Webhook{}
+	for _, webhook := range s.webhooks {
+		if webhook.UserID == userID {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		if !webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+		}
+		return webhooks[i].ID.String() < webhooks[j].ID.String()
+	})
+	return webhooks
+}
+
+func (s *Store) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return database.ErrNotFound
+	}
+	s.deleteWebhook(id)
+	return nil
+}
+
+// deleteWebhook removes a webhook and its deliveries. The caller must hold
+// s.mu.
+func (s *Store) deleteWebhook(id uuid.UUID) {
+	delete(s.webhooks, id)
+	for deliveryID, delivery := range s.deliveries {
+		if delivery.WebhookID == id {
+			delete(s.deliveries, deliveryID)
+		}
+	}
+}
+
+func (s *Store) EnqueueWebhookEvent(ctx context.Context, userID uuid.UUID, eventType string, payload []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	createdAt := now()
+	for _, webhook := range s.userWebhooks(userID) {
+		if !slices.Contains(webhook.Events, eventType) {
+			continue
+		}
+		s.queueDelivery(webhook.ID, eventType, payload, createdAt)
+	}
+	return nil
+}
+
+// queueDelivery adds a pending delivery that is due now. The caller must
+// hold s.mu.
+func (s *Store) queueDelivery(webhookID uuid.UUID, eventType string, payload []byte, createdAt time.Time) database.WebhookDelivery {
+	nextAttemptAt := createdAt
+	delivery := database.WebhookDelivery{
+		ID:            uuid.New(),
+		CreatedAt:     createdAt,
+		WebhookID:     webhookID,
+		EventType:     eventType,
+		Payload:       slices.Clone(payload),
+		Status:        database.WebhookDeliveryPending,
+		NextAttemptAt: &nextAttemptAt,
+	}
+	s.deliveries[delivery.ID] = delivery
+	return delivery
+}
+
+func (s *Store) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return database.WebhookDelivery{}, database.ErrNotFound
+	}
+	return delivery, nil
+}
+
+func (s *Store) GetWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := []database.WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID.String() < deliveries[j].ID.String()
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (s *Store) ClaimDueWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	at := now()
+	deliveries := []database.WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.Status == database.WebhookDeliveryPending && !delivery.NextAttemptAt.After(at) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttemptAt.Before(*deliveries[j].NextAttemptAt)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	leasedUntil := at.Add(lease)
+	for i := range deliveries {
+		deliveries[i].NextAttemptAt = &leasedUntil
+		s.deliveries[deliveries[i].ID] = deliveries[i]
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID.String() < deliveries[j].ID.String()
+	})
+	return deliveries, nil
+}
+
+func (s *Store) CompleteWebhookDelivery(ctx context.Context, id uuid.UUID, statusCode int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	deliveredAt := now()
+	delivery.Status = database.WebhookDeliverySucceeded
+	delivery.Attempts++
+	delivery.LastStatusCode = &statusCode
+	delivery.LastError = nil
+	delivery.NextAttemptAt = nil
+	delivery.DeliveredAt = &deliveredAt
+	s.deliveries[id] = delivery
+	return nil
+}
+
+func (s *Store) RetryWebhookDelivery(ctx context.Context, id uuid.UUID, statusCode *int, lastError string, nextAttemptAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	delivery.Status = database.WebhookDeliveryPending
+	if nextAttemptAt == nil {
+		delivery.Status = database.WebhookDeliveryFailed
+	} else {
+		t := nextAttemptAt.UTC()
+		nextAttemptAt = &t
+	}
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = &lastError
+	delivery.NextAttemptAt = nextAttemptAt
+	s.deliveries[id] = delivery
+	return nil
+}
+
+func (s *Store) ReplayWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return database.WebhookDelivery{}, database.ErrNotFound
+	}
+	return s.queueDelivery(delivery.WebhookID, delivery.EventType, delivery.Payload, now()), nil
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	// ErrNotFound is returned when a lookup, update or delete matches no row.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write would violate a uniqueness constraint.
+	ErrConflict = errors.New("conflict")
+	// ErrStale is returned when a conditional write finds the row has changed
+	// since the caller read it.
+	ErrStale = errors.New("stale write")
+)
+
+// translateError maps driver-specific errors onto the package's sentinel errors.
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return ErrConflict
+		}
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrConflict
+	}
+	return err
+}
+
+// requireAffected returns ErrNotFound when an update or delete touched no rows.
+func requireAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestTranslateError(t *testing.T) {
+	other := errors.New("disk on fire")
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"nil", nil, nil},
+		{"no rows", sql.ErrNoRows, ErrNotFound},
+		{"wrapped no rows", fmt.Errorf("scan: %w", sql.ErrNoRows), ErrNotFound},
+		{"SQLite unique", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}, ErrConflict},
+		{"SQLite primary key", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintPrimaryKey}, ErrConflict},
+		{"SQLite foreign key", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintForeignKey}, nil},
+		{"Postgres unique", &pq.Error{Code: "23505"}, ErrConflict},
+		{"Postgres foreign key", &pq.Error{Code: "23503"}, nil},
+		{"other", other, other},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := translateError(tt.err)
+			switch {
+			case tt.want != nil && !errors.Is(got, tt.want):
+				t.Fatalf("translateError(%v) = %v, want %v", tt.err, got, tt.want)
+			case tt.want == nil && tt.err != nil && got != tt.err:
+				// Errors without a sentinel pass through untouched.
+				t.Fatalf("translateError(%v) = %v, want it unchanged", tt.err, got)
+			case tt.err == nil && got != nil:
+				t.Fatalf("translateError(nil) = %v", got)
+			}
+		})
+	}
+}
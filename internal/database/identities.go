@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// GetUserByIdentity returns the user an OpenID Connect provider account is
+// linked to.
+func (c Client) GetUserByIdentity(ctx context.Context, issuer, subject string) (*User, error) {
+	query := `
+		SELECT user_id
+		FROM user_identities
+		WHERE issuer = ? AND subject = ?
+	`
+	var id string
+	err := c.db.QueryRowContext(ctx, query, issuer, subject).Scan(&id)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetUser(ctx, userID)
+}
+
+// LinkUserIdentity lets an OpenID Connect provider account log in as a
+// user. It returns ErrConflict if the account is already linked.
+func (c Client) LinkUserIdentity(ctx context.Context, userID uuid.UUID, issuer, subject string) error {
+	query := `
+		INSERT INTO user_identities (issuer, subject, user_id, created_at)
+		VALUES (?, ?, ?, ?)
+	`
+	_, err := c.db.ExecContext(ctx, query, issuer, subject, userID.String(), now())
+	return translateError(err)
+}
@@ -0,0 +1,300 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a single numbered schema change with its up and down SQL.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a known migration has been applied.
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// ErrUnknownVersion is returned when migrating to a version that has no migration file.
+var ErrUnknownVersion = errors.New("unknown migration version")
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, err
+		}
+		contents, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func (c Client) migrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles, path.Join("migrations", migrationDir(c.db.dialect)))
+}
+
+func migrationDir(d dialect) string {
+	if d == dialectPostgres {
+		return "postgres"
+	}
+	return "sqlite"
+}
+
+func (c Client) ensureMigrationsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err := c.sqlDB.Exec(query)
+	return err
+}
+
+func (c Client) appliedMigrations() (map[int]time.Time, error) {
+	if err := c.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := c.sqlDB.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// SchemaVersion returns the highest applied migration version, or 0 for an empty database.
+func (c Client) SchemaVersion() (int, error) {
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// LatestSchemaVersion returns the version of the newest embedded migration.
+func (c Client) LatestSchemaVersion() (int, error) {
+	migrations, err := c.migrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// MigrationStatus lists every embedded migration and whether it has been applied.
+func (c Client) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := c.migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// MigrateUp applies every pending migration.
+func (c Client) MigrateUp() error {
+	latest, err := c.LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+	return c.MigrateTo(latest)
+}
+
+// MigrateTo applies or rolls back migrations until the schema is at version.
+// Version 0 rolls back every migration. Each migration runs in its own
+// transaction together with its schema_migrations bookkeeping.
+func (c Client) MigrateTo(version int) error {
+	migrations, err := c.migrations()
+	if err != nil {
+		return err
+	}
+	if version != 0 && !hasMigration(migrations, version) {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok || m.Version > version {
+			continue
+		}
+		if err := c.applyMigration(m, true); err != nil {
+			return err
+		}
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok || m.Version <= version {
+			continue
+		}
+		if err := c.applyMigration(m, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rollback reverts the given number of most recently applied migrations.
+func (c Client) Rollback(steps int) error {
+	if steps <= 0 {
+		return nil
+	}
+	migrations, err := c.migrations()
+	if err != nil {
+		return err
+	}
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if err := c.applyMigration(m, false); err != nil {
+			return err
+		}
+		steps--
+	}
+	return nil
+}
+
+func (c Client) applyMigration(m Migration, up bool) (err error) {
+	direction, script := "up", m.Up
+	if !up {
+		direction, script = "down", m.Down
+	}
+
+	tx, err := c.sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec(script); err != nil {
+		return fmt.Errorf("migration %d_%s %s: %w", m.Version, m.Name, direction, err)
+	}
+
+	if up {
+		_, err = tx.Exec(c.db.dialect.rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+			m.Version, m.Name, time.Now().UTC())
+	} else {
+		_, err = tx.Exec(c.db.dialect.rebind(`DELETE FROM schema_migrations WHERE version = ?`), m.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func hasMigration(migrations []Migration, version int) bool {
+	for _, m := range migrations {
+		if m.Version == version {
+			return true
+		}
+	}
+	return false
+}
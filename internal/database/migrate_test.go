@@ -0,0 +1,188 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestSQLiteMigrations(t *testing.T) {
+	testMigrationRoundTrip(t, newSQLiteClient(t))
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	testMigrationRoundTrip(t, newPostgresClient(t))
+}
+
+// testMigrationRoundTrip rolls every migration back one at a time and
+// applies them again, so each down migration undoes its up migration
+// cleanly enough for the up migration to run again.
+func testMigrationRoundTrip(t *testing.T, c database.Client) {
+	ctx := context.Background()
+	latest, err := c.LatestSchemaVersion()
+	if err != nil {
+		t.Fatalf("LatestSchemaVersion: %v", err)
+	}
+
+	for version := latest - 1; version >= 0; version-- {
+		if err := c.MigrateTo(version); err != nil {
+			t.Fatalf("MigrateTo(%d) down: %v", version, err)
+		}
+		assertApplied(t, c, version)
+	}
+	for version := 1; version <= latest; version++ {
+		if err := c.MigrateTo(version); err != nil {
+			t.Fatalf("MigrateTo(%d) up: %v", version, err)
+		}
+		assertApplied(t, c, version)
+	}
+
+	// The rebuilt schema works.
+	user, err := c.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", Password: "x"})
+	if err != nil {
+		t.Fatalf("CreateUser after the round trip: %v", err)
+	}
+	if _, err := c.CreateVideo(ctx, database.CreateVideoParams{Title: "t", UserID: user.ID, Tags: []string{"go"}}); err != nil {
+		t.Fatalf("CreateVideo after the round trip: %v", err)
+	}
+
+	if err := c.Rollback(1); err != nil {
+		t.Fatalf("Rollback(1): %v", err)
+	}
+	assertApplied(t, c, latest-1)
+	if err := c.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	assertApplied(t, c, latest)
+
+	if err := c.MigrateTo(latest + 1); !errors.Is(err, database.ErrUnknownVersion) {
+		t.Fatalf("MigrateTo(%d): got error %v, want ErrUnknownVersion", latest+1, err)
+	}
+}
+
+// assertApplied checks that exactly the migrations up to version are
+// applied.
+func assertApplied(t *testing.T, c database.Client, version int) {
+	t.Helper()
+	statuses, err := c.MigrationStatus()
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	for _, s := range statuses {
+		if s.Applied != (s.Version <= version) {
+			t.Fatalf("at version %d, migration %d_%s applied = %v", version, s.Version, s.Name, s.Applied)
+		}
+	}
+}
+
+// Migration 2 tightens the videos foreign key on SQLite. It must stop on
+// videos whose owner doesn't exist rather than drop them.
+func TestSQLiteMigrationKeepsVideosWithoutOwner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tubely.db")
+	c, err := database.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer c.Close()
+	if err := c.MigrateTo(1); err != nil {
+		t.Fatalf("MigrateTo(1): %v", err)
+	}
+
+	raw, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	defer raw.Close()
+	if _, err := raw.Exec(`INSERT INTO videos (id, title, user_id) VALUES ('orphan', 'lost', 'nobody')`); err != nil {
+		t.Fatalf("inserting a video without an owner: %v", err)
+	}
+
+	err = c.MigrateUp()
+	if err == nil || !strings.Contains(err.Error(), "videos_without_an_owner_must_be_reassigned_or_deleted") {
+		t.Fatalf("MigrateUp with a video without an owner: got error %v", err)
+	}
+	assertApplied(t, c, 1)
+	var count int
+	if err := raw.QueryRow(`SELECT COUNT(*) FROM videos WHERE id = 'orphan'`).Scan(&count); err != nil || count != 1 {
+		t.Fatalf("video without an owner: count %d, %v; want it kept", count, err)
+	}
+
+	if _, err := raw.Exec(`DELETE FROM videos WHERE id = 'orphan'`); err != nil {
+		t.Fatalf("deleting the video: %v", err)
+	}
+	if err := c.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp once the video is gone: %v", err)
+	}
+}
+
+func TestSQLiteMigrationKeepsRefreshTokensWithoutUser(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tubely.db")
+	c, err := database.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer c.Close()
+	if err := c.MigrateTo(2); err != nil {
+		t.Fatalf("MigrateTo(2): %v", err)
+	}
+
+	raw, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	defer raw.Close()
+	if _, err := raw.Exec(`INSERT INTO refresh_tokens (token, user_id, expires_at) VALUES ('orphan', 'nobody', CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatalf("inserting a refresh token without a user: %v", err)
+	}
+
+	err = c.MigrateUp()
+	if err == nil || !strings.Contains(err.Error(), "refresh_tokens_without_a_user_must_be_deleted") {
+		t.Fatalf("MigrateUp with a refresh token without a user: got error %v", err)
+	}
+	assertApplied(t, c, 2)
+	var count int
+	if err := raw.QueryRow(`SELECT COUNT(*) FROM refresh_tokens WHERE token = 'orphan'`).Scan(&count); err != nil || count != 1 {
+		t.Fatalf("refresh token without a user: count %d, %v; want it kept", count, err)
+	}
+
+	if _, err := raw.Exec(`DELETE FROM refresh_tokens WHERE token = 'orphan'`); err != nil {
+		t.Fatalf("deleting the refresh token: %v", err)
+	}
+	if err := c.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp once the refresh token is gone: %v", err)
+	}
+}
+
+func TestSQLiteMigrationIndexesExistingTags(t *testing.T) {
+	testMigrationIndexesExistingTags(t, newSQLiteClient(t))
+}
+
+func TestPostgresMigrationIndexesExistingTags(t *testing.T) {
+	testMigrationIndexesExistingTags(t, newPostgresClient(t))
+}
+
+// Migration 22 puts tags in the search index. Videos tagged before it must
+// be found by their tags afterwards.
+func testMigrationIndexesExistingTags(t *testing.T, c database.Client) {
+	ctx := context.Background()
+	user := createUser(t, c, "a@example.com")
+	_, err := c.CreateVideo(ctx, database.CreateVideoParams{Title: "Hike", UserID: user.ID, Tags: []string{"outdoors"}})
+	if err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+
+	if err := c.MigrateTo(21); err != nil {
+		t.Fatalf("MigrateTo(21): %v", err)
+	}
+	if err := c.MigrateTo(22); err != nil {
+		t.Fatalf("MigrateTo(22): %v", err)
+	}
+	if got := search(t, c, user.ID, "outdoors"); len(got) != 1 {
+		t.Fatalf("search by a tag from before the migration = %q", got)
+	}
+}
@@ -0,0 +1,3 @@
+-- The column fixes SQLite needed are part of the initial Postgres schema;
+-- only the lookup index is added here.
+CREATE INDEX IF NOT EXISTS idx_videos_user_id_created_at ON videos(user_id, created_at);
@@ -0,0 +1,12 @@
+CREATE TABLE storage_cleanup (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	kind TEXT NOT NULL,
+	bucket TEXT NOT NULL DEFAULT '',
+	object_key TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	next_attempt_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_storage_cleanup_next_attempt_at ON storage_cleanup(next_attempt_at);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_videos_user_id_duration;
+DROP INDEX IF EXISTS idx_videos_user_id_title;
+DROP INDEX IF EXISTS idx_videos_user_id_updated_at;
+
+ALTER TABLE videos DROP COLUMN aspect_ratio;
+ALTER TABLE videos DROP COLUMN duration_seconds;
+ALTER TABLE videos DROP COLUMN status;
@@ -0,0 +1,9 @@
+ALTER TABLE videos ADD COLUMN status TEXT NOT NULL DEFAULT 'draft';
+ALTER TABLE videos ADD COLUMN duration_seconds DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN aspect_ratio TEXT;
+
+UPDATE videos SET status = 'ready' WHERE video_url IS NOT NULL;
+
+CREATE INDEX idx_videos_user_id_updated_at ON videos(user_id, updated_at);
+CREATE INDEX idx_videos_user_id_title ON videos(user_id, title);
+CREATE INDEX idx_videos_user_id_duration ON videos(user_id, duration_seconds);
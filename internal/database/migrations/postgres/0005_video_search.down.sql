@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_videos_search_document;
+ALTER TABLE videos DROP COLUMN search_document;
@@ -0,0 +1,9 @@
+-- A generated column keeps the search document in step with every write.
+-- The 'simple' configuration skips stemming so prefix queries match what
+-- users type.
+ALTER TABLE videos ADD COLUMN search_document tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('simple', title), 'A') ||
+	setweight(to_tsvector('simple', description), 'B')
+) STORED;
+
+CREATE INDEX idx_videos_search_document ON videos USING GIN (search_document);
@@ -0,0 +1,3 @@
+ALTER TABLE videos ADD COLUMN visibility TEXT NOT NULL DEFAULT 'private';
+
+CREATE INDEX idx_videos_visibility_created_at ON videos(visibility, created_at);
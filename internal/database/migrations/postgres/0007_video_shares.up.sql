@@ -0,0 +1,13 @@
+CREATE TABLE video_shares (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	video_id UUID NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	token_hash TEXT NOT NULL UNIQUE,
+	expires_at TIMESTAMPTZ,
+	max_views INTEGER,
+	view_count INTEGER NOT NULL DEFAULT 0,
+	password_hash TEXT,
+	revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_video_shares_video_id_created_at ON video_shares(video_id, created_at);
@@ -0,0 +1,9 @@
+CREATE TABLE video_collaborators (
+	video_id UUID NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (video_id, user_id)
+);
+
+CREATE INDEX idx_video_collaborators_user_id ON video_collaborators(user_id);
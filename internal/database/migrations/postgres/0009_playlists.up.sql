@@ -0,0 +1,23 @@
+CREATE TABLE playlists (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	visibility TEXT NOT NULL DEFAULT 'private',
+	cover_video_id UUID REFERENCES videos(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_playlists_user_id_created_at ON playlists(user_id, created_at);
+
+CREATE TABLE playlist_videos (
+	playlist_id UUID NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+	video_id UUID NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	added_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (playlist_id, video_id)
+);
+
+CREATE INDEX idx_playlist_videos_playlist_id_position ON playlist_videos(playlist_id, position);
+CREATE INDEX idx_playlist_videos_video_id ON playlist_videos(video_id);
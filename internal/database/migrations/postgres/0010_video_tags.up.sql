@@ -0,0 +1,17 @@
+-- Tags belong to a user, so each user has their own autocomplete vocabulary.
+-- Names are stored normalized (lowercase, single spaces).
+CREATE TABLE tags (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	UNIQUE (user_id, name)
+);
+
+CREATE TABLE video_tags (
+	video_id UUID NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	tag_id UUID NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+	PRIMARY KEY (video_id, tag_id)
+);
+
+CREATE INDEX idx_video_tags_tag_id ON video_tags(tag_id);
@@ -0,0 +1,30 @@
+-- events is a comma-separated list of the event types the webhook wants.
+CREATE TABLE webhooks (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	url TEXT NOT NULL,
+	events TEXT NOT NULL,
+	secret TEXT NOT NULL
+);
+
+CREATE INDEX idx_webhooks_user_id ON webhooks(user_id);
+
+-- Deliveries are kept once finished as the webhook's delivery log;
+-- next_attempt_at is NULL for deliveries that won't be attempted again.
+CREATE TABLE webhook_deliveries (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+	event_type TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_status_code INTEGER,
+	last_error TEXT,
+	next_attempt_at TIMESTAMPTZ,
+	delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, created_at);
+CREATE INDEX idx_webhook_deliveries_next_attempt_at ON webhook_deliveries(status, next_attempt_at);
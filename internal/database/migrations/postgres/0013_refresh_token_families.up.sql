@@ -0,0 +1,9 @@
+-- Each refresh replaces the token it was given, and the tokens descended
+-- from one login share a family_id so they can be revoked together.
+-- Existing tokens each start a family of their own.
+ALTER TABLE refresh_tokens ADD COLUMN family_id UUID;
+UPDATE refresh_tokens SET family_id = gen_random_uuid();
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+ALTER TABLE refresh_tokens ADD COLUMN replaced_by TEXT;
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
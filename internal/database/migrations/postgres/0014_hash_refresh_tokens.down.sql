@@ -0,0 +1,5 @@
+-- Hashes can't be turned back into tokens, so every session is dropped.
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens RENAME COLUMN token_hash TO token;
+ALTER TABLE refresh_tokens RENAME COLUMN replaced_by_hash TO replaced_by;
@@ -0,0 +1,8 @@
+-- Refresh tokens are stored as the SHA-256 of the token, like share links.
+-- Existing tokens are hashed in place, so sessions survive the migration.
+UPDATE refresh_tokens
+SET token = encode(sha256(convert_to(token, 'UTF8')), 'hex'),
+	replaced_by = encode(sha256(convert_to(replaced_by, 'UTF8')), 'hex');
+
+ALTER TABLE refresh_tokens RENAME COLUMN token TO token_hash;
+ALTER TABLE refresh_tokens RENAME COLUMN replaced_by TO replaced_by_hash;
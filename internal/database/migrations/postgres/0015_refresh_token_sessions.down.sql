@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_refresh_tokens_user_id;
+ALTER TABLE refresh_tokens DROP COLUMN ip_address;
+ALTER TABLE refresh_tokens DROP COLUMN user_agent;
+ALTER TABLE refresh_tokens DROP COLUMN session_created_at;
@@ -0,0 +1,12 @@
+-- Every refresh token family is a session the user can see and revoke. The
+-- live token records the client that last refreshed it, and every token in
+-- a family carries the time the session started.
+ALTER TABLE refresh_tokens ADD COLUMN session_created_at TIMESTAMPTZ;
+UPDATE refresh_tokens rt SET session_created_at = (
+	SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = rt.family_id
+);
+ALTER TABLE refresh_tokens ALTER COLUMN session_created_at SET NOT NULL;
+ALTER TABLE refresh_tokens ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN ip_address TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
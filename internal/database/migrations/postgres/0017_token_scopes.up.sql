@@ -0,0 +1,10 @@
+-- Access tokens carry the scopes of the login they come from, so each
+-- session remembers the scopes it was granted. Existing sessions keep full
+-- access. API key scopes move to the same names.
+ALTER TABLE refresh_tokens ADD COLUMN scopes TEXT NOT NULL DEFAULT '';
+UPDATE refresh_tokens SET scopes = 'videos:read,videos:write,videos:delete,admin';
+
+UPDATE api_keys SET scopes = replace(replace(replace(scopes,
+	'read', 'videos:read'),
+	'upload', 'videos:write'),
+	'delete', 'videos:delete');
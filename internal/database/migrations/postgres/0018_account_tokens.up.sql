@@ -0,0 +1,18 @@
+-- Accounts from before email verification existed count as verified, so
+-- their uploads keep working.
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+UPDATE users SET email_verified_at = created_at;
+
+-- Single-use tokens mailed to a user, such as password reset links. Only a
+-- hash of each token is stored.
+CREATE TABLE account_tokens (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	purpose TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_account_tokens_user_id ON account_tokens(user_id, purpose);
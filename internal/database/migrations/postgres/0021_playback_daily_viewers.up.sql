@@ -0,0 +1,15 @@
+-- One row per viewer per video per day, counting the sessions they
+-- started. Inserting it decides whether a session is the viewer's first of
+-- the day, so two sessions starting at once can't both count as unique.
+CREATE TABLE playback_daily_viewers (
+	video_id UUID NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	viewer_hash TEXT NOT NULL,
+	day DATE NOT NULL,
+	sessions INTEGER NOT NULL,
+	PRIMARY KEY (video_id, viewer_hash, day)
+);
+
+INSERT INTO playback_daily_viewers (video_id, viewer_hash, day, sessions)
+SELECT video_id, viewer_hash, day, COUNT(*)
+FROM playback_sessions
+GROUP BY video_id, viewer_hash, day;
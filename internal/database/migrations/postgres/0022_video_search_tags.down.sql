@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_videos_search_document;
+ALTER TABLE videos DROP COLUMN IF EXISTS search_document;
+ALTER TABLE videos ADD COLUMN search_document tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('simple', title), 'A') ||
+	setweight(to_tsvector('simple', description), 'B')
+) STORED;
+
+CREATE INDEX idx_videos_search_document ON videos USING GIN (search_document);
+
+ALTER TABLE videos DROP COLUMN IF EXISTS search_tags;
@@ -0,0 +1,21 @@
+-- Tags live in their own tables, which a generated column can't read, so
+-- each video keeps its tag names in search_tags for the search document.
+-- The store rewrites it whenever a video's tags change.
+ALTER TABLE videos ADD COLUMN search_tags TEXT NOT NULL DEFAULT '';
+
+UPDATE videos v SET search_tags = COALESCE((
+	SELECT string_agg(t.name, ' ')
+	FROM video_tags vt
+	JOIN tags t ON t.id = vt.tag_id
+	WHERE vt.video_id = v.id
+), '');
+
+DROP INDEX idx_videos_search_document;
+ALTER TABLE videos DROP COLUMN search_document;
+ALTER TABLE videos ADD COLUMN search_document tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('simple', title), 'A') ||
+	setweight(to_tsvector('simple', description), 'B') ||
+	setweight(to_tsvector('simple', search_tags), 'C')
+) STORED;
+
+CREATE INDEX idx_videos_search_document ON videos USING GIN (search_document);
@@ -0,0 +1,45 @@
+-- videos.video_url was declared as "TEXT TEXT" and videos.user_id as INTEGER
+-- even though user IDs are TEXT UUIDs. SQLite can't alter a column type, so
+-- rebuild the table.
+--
+-- The old table didn't enforce its foreign key, so it can hold videos whose
+-- owner doesn't exist. The new one can't, and those videos must not be lost
+-- quietly: the migration fails on the constraint below until they are given
+-- an owner or deleted by hand.
+CREATE TEMP TABLE migration_0002_check (
+	orphaned_videos INTEGER NOT NULL,
+	CONSTRAINT videos_without_an_owner_must_be_reassigned_or_deleted CHECK (orphaned_videos = 0)
+);
+INSERT INTO migration_0002_check
+SELECT COUNT(*) FROM videos
+WHERE user_id IS NULL OR CAST(user_id AS TEXT) NOT IN (SELECT id FROM users);
+DROP TABLE migration_0002_check;
+
+CREATE TABLE videos_new (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	thumbnail_url TEXT,
+	video_url TEXT,
+	user_id TEXT NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO videos_new (id, created_at, updated_at, title, description, thumbnail_url, video_url, user_id)
+SELECT
+	id,
+	COALESCE(created_at, CURRENT_TIMESTAMP),
+	COALESCE(updated_at, CURRENT_TIMESTAMP),
+	title,
+	COALESCE(description, ''),
+	thumbnail_url,
+	video_url,
+	CAST(user_id AS TEXT)
+FROM videos;
+
+DROP TABLE videos;
+ALTER TABLE videos_new RENAME TO videos;
+
+CREATE INDEX idx_videos_user_id_created_at ON videos(user_id, created_at);
@@ -0,0 +1,19 @@
+CREATE TABLE refresh_tokens_old (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+INSERT INTO refresh_tokens_old (token, created_at, updated_at, revoked_at, user_id, expires_at)
+SELECT token, created_at, updated_at, revoked_at, user_id, expires_at
+FROM refresh_tokens;
+
+DROP TABLE refresh_tokens;
+ALTER TABLE refresh_tokens_old RENAME TO refresh_tokens;
+
+DROP INDEX IF EXISTS idx_storage_cleanup_next_attempt_at;
+DROP TABLE storage_cleanup;
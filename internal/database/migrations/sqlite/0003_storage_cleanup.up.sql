@@ -0,0 +1,43 @@
+-- refresh_tokens gains ON DELETE CASCADE below. The old table didn't enforce
+-- its foreign key, so it can hold tokens whose user doesn't exist. Rather
+-- than drop them quietly, the migration fails on the constraint below until
+-- they are deleted by hand.
+CREATE TEMP TABLE migration_0003_check (
+	orphaned_refresh_tokens INTEGER NOT NULL,
+	CONSTRAINT refresh_tokens_without_a_user_must_be_deleted CHECK (orphaned_refresh_tokens = 0)
+);
+INSERT INTO migration_0003_check
+SELECT COUNT(*) FROM refresh_tokens
+WHERE user_id NOT IN (SELECT id FROM users);
+DROP TABLE migration_0003_check;
+
+CREATE TABLE storage_cleanup (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	kind TEXT NOT NULL,
+	bucket TEXT NOT NULL DEFAULT '',
+	object_key TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	next_attempt_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_storage_cleanup_next_attempt_at ON storage_cleanup(next_attempt_at);
+
+-- Refresh tokens now go away with their user.
+CREATE TABLE refresh_tokens_new (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO refresh_tokens_new (token, created_at, updated_at, revoked_at, user_id, expires_at)
+SELECT token, created_at, updated_at, revoked_at, user_id, expires_at
+FROM refresh_tokens;
+
+DROP TABLE refresh_tokens;
+ALTER TABLE refresh_tokens_new RENAME TO refresh_tokens;
@@ -0,0 +1,15 @@
+ALTER TABLE videos ADD COLUMN status TEXT NOT NULL DEFAULT 'draft';
+ALTER TABLE videos ADD COLUMN duration_seconds REAL NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN aspect_ratio TEXT;
+
+UPDATE videos SET status = 'ready' WHERE video_url IS NOT NULL;
+
+-- Timestamps written by the application carry a UTC offset. Bring rows that
+-- got CURRENT_TIMESTAMP into the same form so text comparisons (used for
+-- range filters and cursors) order them correctly.
+UPDATE videos SET created_at = created_at || '+00:00' WHERE length(created_at) = 19;
+UPDATE videos SET updated_at = updated_at || '+00:00' WHERE length(updated_at) = 19;
+
+CREATE INDEX idx_videos_user_id_updated_at ON videos(user_id, updated_at);
+CREATE INDEX idx_videos_user_id_title ON videos(user_id, title);
+CREATE INDEX idx_videos_user_id_duration ON videos(user_id, duration_seconds);
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS videos_search_delete;
+DROP TRIGGER IF EXISTS videos_search_update;
+DROP TRIGGER IF EXISTS videos_search_insert;
+DROP TABLE IF EXISTS videos_fts;
+DROP TABLE IF EXISTS video_search_docs;
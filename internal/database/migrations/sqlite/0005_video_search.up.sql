@@ -0,0 +1,44 @@
+-- Full-text index over video text. Requires SQLite built with FTS5
+-- (go build -tags sqlite_fts5). The tags and captions columns are reserved
+-- for later and indexed empty for now.
+--
+-- FTS rows are keyed by video_search_docs.doc_id, an INTEGER PRIMARY KEY that
+-- is stable across VACUUM, unlike the implicit rowid of videos.
+CREATE TABLE video_search_docs (
+	doc_id INTEGER PRIMARY KEY,
+	video_id TEXT NOT NULL UNIQUE
+);
+
+CREATE VIRTUAL TABLE videos_fts USING fts5(
+	title,
+	description,
+	tags,
+	captions,
+	tokenize = 'unicode61 remove_diacritics 2',
+	prefix = '2 3'
+);
+
+INSERT INTO video_search_docs (video_id) SELECT id FROM videos;
+INSERT INTO videos_fts (rowid, title, description, tags, captions)
+SELECT d.doc_id, v.title, v.description, '', ''
+FROM videos v
+JOIN video_search_docs d ON d.video_id = v.id;
+
+-- Triggers keep the index in step with every write to videos, including
+-- rows removed by ON DELETE CASCADE.
+CREATE TRIGGER videos_search_insert AFTER INSERT ON videos BEGIN
+	INSERT INTO video_search_docs (video_id) VALUES (new.id);
+	INSERT INTO videos_fts (rowid, title, description, tags, captions)
+	VALUES ((SELECT doc_id FROM video_search_docs WHERE video_id = new.id), new.title, new.description, '', '');
+END;
+
+CREATE TRIGGER videos_search_update AFTER UPDATE OF title, description ON videos BEGIN
+	UPDATE videos_fts
+	SET title = new.title, description = new.description
+	WHERE rowid = (SELECT doc_id FROM video_search_docs WHERE video_id = new.id);
+END;
+
+CREATE TRIGGER videos_search_delete AFTER DELETE ON videos BEGIN
+	DELETE FROM videos_fts WHERE rowid = (SELECT doc_id FROM video_search_docs WHERE video_id = old.id);
+	DELETE FROM video_search_docs WHERE video_id = old.id;
+END;
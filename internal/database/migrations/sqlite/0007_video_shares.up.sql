@@ -0,0 +1,14 @@
+CREATE TABLE video_shares (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	video_id TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	expires_at TIMESTAMP,
+	max_views INTEGER,
+	view_count INTEGER NOT NULL DEFAULT 0,
+	password_hash TEXT,
+	revoked_at TIMESTAMP,
+	FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_video_shares_video_id_created_at ON video_shares(video_id, created_at);
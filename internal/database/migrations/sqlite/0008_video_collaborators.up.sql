@@ -0,0 +1,11 @@
+CREATE TABLE video_collaborators (
+	video_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	role TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (video_id, user_id),
+	FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_video_collaborators_user_id ON video_collaborators(user_id);
@@ -0,0 +1,27 @@
+CREATE TABLE playlists (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	user_id TEXT NOT NULL,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	visibility TEXT NOT NULL DEFAULT 'private',
+	cover_video_id TEXT,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (cover_video_id) REFERENCES videos(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_playlists_user_id_created_at ON playlists(user_id, created_at);
+
+CREATE TABLE playlist_videos (
+	playlist_id TEXT NOT NULL,
+	video_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	added_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (playlist_id, video_id),
+	FOREIGN KEY (playlist_id) REFERENCES playlists(id) ON DELETE CASCADE,
+	FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_playlist_videos_playlist_id_position ON playlist_videos(playlist_id, position);
+CREATE INDEX idx_playlist_videos_video_id ON playlist_videos(video_id);
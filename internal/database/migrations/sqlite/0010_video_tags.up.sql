@@ -0,0 +1,20 @@
+-- Tags belong to a user, so each user has their own autocomplete vocabulary.
+-- Names are stored normalized (lowercase, single spaces).
+CREATE TABLE tags (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	UNIQUE (user_id, name),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE video_tags (
+	video_id TEXT NOT NULL,
+	tag_id TEXT NOT NULL,
+	PRIMARY KEY (video_id, tag_id),
+	FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_video_tags_tag_id ON video_tags(tag_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS video_daily_stats;
+DROP TABLE IF EXISTS playback_sessions;
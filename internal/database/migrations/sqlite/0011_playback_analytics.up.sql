@@ -0,0 +1,25 @@
+-- One row per player session. Sessions deduplicate beacons and remember
+-- who watched, so unique viewers can be counted over any range of days.
+CREATE TABLE playback_sessions (
+	video_id TEXT NOT NULL,
+	session_id TEXT NOT NULL,
+	viewer_hash TEXT NOT NULL,
+	day DATE NOT NULL,
+	max_percent INTEGER NOT NULL,
+	started_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (video_id, session_id),
+	FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_playback_sessions_video_id_day ON playback_sessions(video_id, day, viewer_hash);
+
+CREATE TABLE video_daily_stats (
+	video_id TEXT NOT NULL,
+	day DATE NOT NULL,
+	views INTEGER NOT NULL DEFAULT 0,
+	unique_viewers INTEGER NOT NULL DEFAULT 0,
+	completions INTEGER NOT NULL DEFAULT 0,
+	watch_percent_total INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (video_id, day),
+	FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
@@ -0,0 +1,32 @@
+-- events is a comma-separated list of the event types the webhook wants.
+CREATE TABLE webhooks (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	user_id TEXT NOT NULL,
+	url TEXT NOT NULL,
+	events TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_webhooks_user_id ON webhooks(user_id);
+
+-- Deliveries are kept once finished as the webhook's delivery log;
+-- next_attempt_at is NULL for deliveries that won't be attempted again.
+CREATE TABLE webhook_deliveries (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	webhook_id TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_status_code INTEGER,
+	last_error TEXT,
+	next_attempt_at TIMESTAMP,
+	delivered_at TIMESTAMP,
+	FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, created_at);
+CREATE INDEX idx_webhook_deliveries_next_attempt_at ON webhook_deliveries(status, next_attempt_at);
@@ -0,0 +1,26 @@
+-- Each refresh replaces the token it was given, and the tokens descended
+-- from one login share a family_id so they can be revoked together.
+-- Existing tokens each start a family of their own.
+CREATE TABLE refresh_tokens_new (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	family_id TEXT NOT NULL,
+	replaced_by TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO refresh_tokens_new (token, created_at, updated_at, revoked_at, user_id, expires_at, family_id)
+SELECT token, created_at, updated_at, revoked_at, user_id, expires_at,
+	printf('%s-%s-%s-%s-%s',
+		lower(hex(randomblob(4))), lower(hex(randomblob(2))), lower(hex(randomblob(2))),
+		lower(hex(randomblob(2))), lower(hex(randomblob(6))))
+FROM refresh_tokens;
+
+DROP TABLE refresh_tokens;
+ALTER TABLE refresh_tokens_new RENAME TO refresh_tokens;
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
@@ -0,0 +1,17 @@
+-- Hashes can't be turned back into tokens, so every session is dropped.
+CREATE TABLE refresh_tokens_old (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	family_id TEXT NOT NULL,
+	replaced_by TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+DROP TABLE refresh_tokens;
+ALTER TABLE refresh_tokens_old RENAME TO refresh_tokens;
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
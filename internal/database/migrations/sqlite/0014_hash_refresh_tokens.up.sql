@@ -0,0 +1,19 @@
+-- Refresh tokens are stored as the SHA-256 of the token, like share links.
+-- SQLite can't hash the existing plaintext tokens, so they are dropped and
+-- their users have to log in again.
+CREATE TABLE refresh_tokens_new (
+	token_hash TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	family_id TEXT NOT NULL,
+	replaced_by_hash TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+DROP TABLE refresh_tokens;
+ALTER TABLE refresh_tokens_new RENAME TO refresh_tokens;
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
@@ -0,0 +1,20 @@
+CREATE TABLE refresh_tokens_old (
+	token_hash TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	family_id TEXT NOT NULL,
+	replaced_by_hash TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO refresh_tokens_old (token_hash, created_at, updated_at, revoked_at, user_id, expires_at, family_id, replaced_by_hash)
+SELECT token_hash, created_at, updated_at, revoked_at, user_id, expires_at, family_id, replaced_by_hash
+FROM refresh_tokens;
+
+DROP TABLE refresh_tokens;
+ALTER TABLE refresh_tokens_old RENAME TO refresh_tokens;
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
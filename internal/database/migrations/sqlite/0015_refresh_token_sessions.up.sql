@@ -0,0 +1,32 @@
+-- Every refresh token family is a session the user can see and revoke. The
+-- live token records the client that last refreshed it, and every token in
+-- a family carries the time the session started.
+CREATE TABLE refresh_tokens_new (
+	token_hash TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	family_id TEXT NOT NULL,
+	replaced_by_hash TEXT,
+	session_created_at TIMESTAMP NOT NULL,
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip_address TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO refresh_tokens_new (
+	token_hash, created_at, updated_at, revoked_at, user_id, expires_at,
+	family_id, replaced_by_hash, session_created_at
+)
+SELECT token_hash, created_at, updated_at, revoked_at, user_id, expires_at,
+	family_id, replaced_by_hash,
+	(SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = rt.family_id)
+FROM refresh_tokens rt;
+
+DROP TABLE refresh_tokens;
+ALTER TABLE refresh_tokens_new RENAME TO refresh_tokens;
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
@@ -0,0 +1,16 @@
+-- Only a hash of each key is stored; prefix is the start of the key, kept so
+-- users can tell their keys apart. scopes is a comma-separated list.
+CREATE TABLE api_keys (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	expires_at TIMESTAMP,
+	last_used_at TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
@@ -0,0 +1,6 @@
+UPDATE api_keys SET scopes = replace(replace(replace(scopes,
+	'videos:read', 'read'),
+	'videos:write', 'upload'),
+	'videos:delete', 'delete');
+
+ALTER TABLE refresh_tokens DROP COLUMN scopes;
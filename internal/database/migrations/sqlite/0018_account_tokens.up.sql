@@ -0,0 +1,19 @@
+-- Accounts from before email verification existed count as verified, so
+-- their uploads keep working.
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+UPDATE users SET email_verified_at = created_at;
+
+-- Single-use tokens mailed to a user, such as password reset links. Only a
+-- hash of each token is stored.
+CREATE TABLE account_tokens (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	user_id TEXT NOT NULL,
+	purpose TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_account_tokens_user_id ON account_tokens(user_id, purpose);
@@ -0,0 +1,12 @@
+-- Accounts at OpenID Connect providers that log in as a user. A provider
+-- account is identified by its issuer and subject, never by its email.
+CREATE TABLE user_identities (
+	issuer TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (issuer, subject),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
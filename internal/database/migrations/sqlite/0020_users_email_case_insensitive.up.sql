@@ -0,0 +1,4 @@
+-- Email addresses are looked up case-insensitively, so no two users may
+-- have addresses that differ only in case. This fails if some already do;
+-- rename or delete one of each pair first.
+CREATE UNIQUE INDEX idx_users_email_lower ON users(lower(email));
@@ -0,0 +1,16 @@
+-- One row per viewer per video per day, counting the sessions they
+-- started. Inserting it decides whether a session is the viewer's first of
+-- the day, so two sessions starting at once can't both count as unique.
+CREATE TABLE playback_daily_viewers (
+	video_id TEXT NOT NULL,
+	viewer_hash TEXT NOT NULL,
+	day DATE NOT NULL,
+	sessions INTEGER NOT NULL,
+	PRIMARY KEY (video_id, viewer_hash, day),
+	FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+INSERT INTO playback_daily_viewers (video_id, viewer_hash, day, sessions)
+SELECT video_id, viewer_hash, day, COUNT(*)
+FROM playback_sessions
+GROUP BY video_id, viewer_hash, day;
@@ -0,0 +1,16 @@
+DROP TRIGGER IF EXISTS videos_search_insert;
+CREATE TRIGGER videos_search_insert AFTER INSERT ON videos BEGIN
+	INSERT INTO video_search_docs (video_id) VALUES (new.id);
+	INSERT INTO videos_fts (rowid, title, description, tags, captions)
+	VALUES ((SELECT doc_id FROM video_search_docs WHERE video_id = new.id), new.title, new.description, '', '');
+END;
+
+DROP TRIGGER IF EXISTS videos_search_update;
+CREATE TRIGGER videos_search_update AFTER UPDATE OF title, description ON videos BEGIN
+	UPDATE videos_fts
+	SET title = new.title, description = new.description
+	WHERE rowid = (SELECT doc_id FROM video_search_docs WHERE video_id = new.id);
+END;
+
+UPDATE videos_fts SET tags = '';
+ALTER TABLE videos DROP COLUMN search_tags;
@@ -0,0 +1,32 @@
+-- Tags live in their own tables, which the search index can't follow, so
+-- each video keeps its tag names in search_tags for the index to read. The
+-- store rewrites it whenever a video's tags change.
+ALTER TABLE videos ADD COLUMN search_tags TEXT NOT NULL DEFAULT '';
+
+UPDATE videos SET search_tags = COALESCE((
+	SELECT group_concat(t.name, ' ')
+	FROM video_tags vt
+	JOIN tags t ON t.id = vt.tag_id
+	WHERE vt.video_id = videos.id
+), '');
+
+UPDATE videos_fts SET tags = (
+	SELECT v.search_tags
+	FROM video_search_docs d
+	JOIN videos v ON v.id = d.video_id
+	WHERE d.doc_id = videos_fts.rowid
+);
+
+DROP TRIGGER videos_search_insert;
+CREATE TRIGGER videos_search_insert AFTER INSERT ON videos BEGIN
+	INSERT INTO video_search_docs (video_id) VALUES (new.id);
+	INSERT INTO videos_fts (rowid, title, description, tags, captions)
+	VALUES ((SELECT doc_id FROM video_search_docs WHERE video_id = new.id), new.title, new.description, new.search_tags, '');
+END;
+
+DROP TRIGGER videos_search_update;
+CREATE TRIGGER videos_search_update AFTER UPDATE OF title, description, search_tags ON videos BEGIN
+	UPDATE videos_fts
+	SET title = new.title, description = new.description, tags = new.search_tags
+	WHERE rowid = (SELECT doc_id FROM video_search_docs WHERE video_id = new.id);
+END;
@@ -0,0 +1,324 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidPlaylistOrder is returned when a reorder doesn't list every video
+// in the playlist exactly once.
+var ErrInvalidPlaylistOrder = errors.New("order must list every video in the playlist exactly once")
+
+// Playlist is an ordered collection of videos. Its visibility uses the same
+// levels as a video's.
+type Playlist struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UserID      uuid.UUID `json:"user_id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Visibility  string    `json:"visibility"`
+	// CoverVideoID picks the video whose thumbnail covers the playlist.
+	CoverVideoID *uuid.UUID `json:"cover_video_id"`
+	// VideoCount and CoverThumbnailURL are derived when the playlist is
+	// read. The cover is CoverVideoID's thumbnail, falling back to the first
+	// video's. Private videos are neither counted nor used as the cover,
+	// since the playlist may be shown to people who can't see them.
+	VideoCount        int     `json:"video_count"`
+	CoverThumbnailURL *string `json:"cover_thumbnail_url"`
+}
+
+type CreatePlaylistParams struct {
+	UserID      uuid.UUID
+	Title       string
+	Description string
+	// Visibility defaults to VideoVisibilityPrivate.
+	Visibility string
+}
+
+const playlistQuery = `
+	SELECT
+		p.id,
+		p.created_at,
+		p.updated_at,
+		p.user_id,
+		p.title,
+		p.description,
+		p.visibility,
+		p.cover_video_id,
+		(
+			SELECT COUNT(*)
+			FROM playlist_videos pv
+			JOIN videos v ON v.id = pv.video_id
+			WHERE pv.playlist_id = p.id AND v.visibility <> 'private'
+		),
+		COALESCE(
+			(
+				SELECT v.thumbnail_url
+				FROM videos v
+				WHERE v.id = p.cover_video_id AND v.visibility <> 'private'
+			),
+			(
+				SELECT v.thumbnail_url
+				FROM playlist_videos pv
+				JOIN videos v ON v.id = pv.video_id
+				WHERE pv.playlist_id = p.id AND v.visibility <> 'private'
+				ORDER BY pv.position
+				LIMIT 1
+			)
+		)
+	FROM playlists p
+	`
+
+func scanPlaylist(row rowScanner) (Playlist, error) {
+	var playlist Playlist
+	err := row.Scan(
+		&playlist.ID,
+		&playlist.CreatedAt,
+		&playlist.UpdatedAt,
+		&playlist.UserID,
+		&playlist.Title,
+		&playlist.Description,
+		&playlist.Visibility,
+		&playlist.CoverVideoID,
+		&playlist.VideoCount,
+		&playlist.CoverThumbnailURL,
+	)
+	return playlist, err
+}
+
+func (c Client) CreatePlaylist(ctx context.Context, params CreatePlaylistParams) (Playlist, error) {
+	query := `
+	INSERT INTO playlists (
+		id,
+		created_at,
+		updated_at,
+		user_id,
+		title,
+		description,
+		visibility
+	) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	if params.Visibility == "" {
+		params.Visibility = VideoVisibilityPrivate
+	}
+	id := uuid.New()
+	createdAt := now()
+	var playlist Playlist
+	err := c.inTx(ctx, func(tx Client) error {
+		_, err := tx.db.ExecContext(ctx, query, id, createdAt, createdAt, params.UserID, params.Title, params.Description, params.Visibility)
+		if err != nil {
+			return translateError(err)
+		}
+		playlist, err = tx.GetPlaylist(ctx, id)
+		return err
+	})
+	if err != nil {
+		return Playlist{}, err
+	}
+	return playlist, nil
+}
+
+func (c Client) GetPlaylist(ctx context.Context, id uuid.UUID) (Playlist, error) {
+	query := playlistQuery + `WHERE p.id = ?`
+	playlist, err := scanPlaylist(c.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return Playlist{}, translateError(err)
+	}
+	return playlist, nil
+}
+
+// GetPlaylists lists a user's playlists, newest first.
+func (c Client) GetPlaylists(ctx context.Context, userID uuid.UUID) ([]Playlist, error) {
+	query := playlistQuery + `
+	WHERE p.user_id = ?
+	ORDER BY p.created_at DESC, p.id
+	`
+	rows, err := c.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	playlists := []Playlist{}
+	for rows.Next() {
+		playlist, err := scanPlaylist(rows)
+		if err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, playlist)
+	}
+	return playlists, rows.Err()
+}
+
+// UpdatePlaylist writes a playlist's title, description, visibility and
+// cover, and returns it as stored.
+func (c Client) UpdatePlaylist(ctx context.Context, playlist Playlist) (Playlist, error) {
+	query := `
+	UPDATE playlists
+	SET
+		updated_at = ?,
+		title = ?,
+		description = ?,
+		visibility = ?,
+		cover_video_id = ?
+	WHERE id = ?
+	`
+	var updated Playlist
+	err := c.inTx(ctx, func(tx Client) error {
+		res, err := tx.db.ExecContext(ctx, query, now(), playlist.Title, playlist.Description, playlist.Visibility, playlist.CoverVideoID, playlist.ID)
+		if err != nil {
+			return translateError(err)
+		}
+		if err := requireAffected(res); err != nil {
+			return err
+		}
+		updated, err = tx.GetPlaylist(ctx, playlist.ID)
+		return err
+	})
+	if err != nil {
+		return Playlist{}, err
+	}
+	return updated, nil
+}
+
+func (c Client) DeletePlaylist(ctx context.Context, id uuid.UUID) error {
+	res, err := c.db.ExecContext(ctx, `DELETE FROM playlists WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// GetPlaylistVideos returns the videos in a playlist in playlist order.
+func (c Client) GetPlaylistVideos(ctx context.Context, playlistID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT ` + videoColumns("v") + `
+	FROM playlist_videos pv
+	JOIN videos v ON v.id = pv.video_id
+	WHERE pv.playlist_id = ?
+	ORDER BY pv.position
+	`
+	rows, err := c.db.QueryContext(ctx, query, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := c.attachTagsToAll(ctx, videos); err != nil {
+		return nil, err
+	}
+	return videos, nil
+}
+
+// AddPlaylistVideo appends a video to the end of a playlist. It returns
+// ErrConflict if the video is already in it.
+func (c Client) AddPlaylistVideo(ctx context.Context, playlistID, videoID uuid.UUID) error {
+	query := `
+	INSERT INTO playlist_videos (playlist_id, video_id, position, added_at)
+	VALUES (?, ?, ?, ?)
+	`
+	return c.inTx(ctx, func(tx Client) error {
+		if err := tx.touchPlaylist(ctx, playlistID); err != nil {
+			return err
+		}
+		var position int
+		err := tx.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(position) + 1, 0) FROM playlist_videos WHERE playlist_id = ?`, playlistID).Scan(&position)
+		if err != nil {
+			return err
+		}
+		_, err = tx.db.ExecContext(ctx, query, playlistID, videoID, position, now())
+		return translateError(err)
+	})
+}
+
+// RemovePlaylistVideo takes a video out of a playlist, clearing the cover
+// if the video was it.
+func (c Client) RemovePlaylistVideo(ctx context.Context, playlistID, videoID uuid.UUID) error {
+	return c.inTx(ctx, func(tx Client) error {
+		res, err := tx.db.ExecContext(ctx, `DELETE FROM playlist_videos WHERE playlist_id = ? AND video_id = ?`, playlistID, videoID)
+		if err != nil {
+			return err
+		}
+		if err := requireAffected(res); err != nil {
+			return err
+		}
+		_, err = tx.db.ExecContext(ctx, `UPDATE playlists SET cover_video_id = NULL WHERE id = ? AND cover_video_id = ?`, playlistID, videoID)
+		if err != nil {
+			return err
+		}
+		return tx.touchPlaylist(ctx, playlistID)
+	})
+}
+
+// ReorderPlaylistVideos puts a playlist's videos in the order of videoIDs,
+// which must list each of them exactly once.
+func (c Client) ReorderPlaylistVideos(ctx context.Context, playlistID uuid.UUID, videoIDs []uuid.UUID) error {
+	return c.inTx(ctx, func(tx Client) error {
+		if err := tx.touchPlaylist(ctx, playlistID); err != nil {
+			return err
+		}
+		current, err := tx.GetPlaylistVideos(ctx, playlistID)
+		if err != nil {
+			return err
+		}
+		currentIDs := make([]uuid.UUID, len(current))
+		for i, video := range current {
+			currentIDs[i] = video.ID
+		}
+		if !IsPlaylistOrder(currentIDs, videoIDs) {
+			return ErrInvalidPlaylistOrder
+		}
+		for i, videoID := range videoIDs {
+			_, err := tx.db.ExecContext(ctx, `UPDATE playlist_videos SET position = ? WHERE playlist_id = ? AND video_id = ?`, i, playlistID, videoID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// touchPlaylist stamps a playlist's updated_at when its videos change, and
+// returns ErrNotFound if it doesn't exist.
+func (c Client) touchPlaylist(ctx context.Context, id uuid.UUID) error {
+	res, err := c.db.ExecContext(ctx, `UPDATE playlists SET updated_at = ? WHERE id = ?`, now(), id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// IsPlaylistOrder reports whether order lists every ID in current exactly
+// once, in any order.
+func IsPlaylistOrder(current, order []uuid.UUID) bool {
+	if len(current) != len(order) {
+		return false
+	}
+	remaining := make(map[uuid.UUID]bool, len(current))
+	for _, id := range current {
+		remaining[id] = true
+	}
+	for _, id := range order {
+		if !remaining[id] {
+			return false
+		}
+		delete(remaining, id)
+	}
+	return true
+}
@@ -1,83 +1,220 @@
 package database
 
 import (
-	"database/sql"
+	"context"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrRefreshTokenReused is returned by RotateRefreshToken when the token has
+// already been revoked. A revoked token coming back means a copy of it is in
+// someone else's hands, so its whole family is revoked too.
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+// RefreshToken is a long-lived session token. Only a hash of the token is
+// stored; the token itself is handed to the client once, when it is issued.
 type RefreshToken struct {
 	CreateRefreshTokenParams
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	RevokedAt *time.Time `json:"revoked_at"`
+	// ReplacedByHash is the hash of the token this one was rotated into, if
+	// any.
+	ReplacedByHash *string `json:"-"`
+	// SessionCreatedAt is when the family's first token was issued, at
+	// login.
+	SessionCreatedAt time.Time `json:"session_created_at"`
 }
 
 type CreateRefreshTokenParams struct {
-	Token     string    `json:"token"`
+	TokenHash string    `json:"-"`
 	UserID    uuid.UUID `json:"user_id"`
 	ExpiresAt time.Time `json:"expires_at"`
+	// FamilyID links every token rotated from the same login. Leave it
+	// zero to start a new family.
+	FamilyID uuid.UUID `json:"family_id"`
+	// UserAgent and IPAddress describe the client the token was issued to.
+	UserAgent string `json:"user_agent"`
+	IPAddress string `json:"ip_address"`
+	// Scopes are what access tokens issued for this login may do. Every
+	// token in a family has the scopes of its first.
+	Scopes []string `json:"scopes"`
 }
 
-func (c Client) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToken, error) {
+func (c Client) CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) (RefreshToken, error) {
+	if params.FamilyID == uuid.Nil {
+		params.FamilyID = uuid.New()
+	}
+	return c.insertRefreshToken(ctx, params, time.Time{})
+}
+
+// insertRefreshToken stores a token in a session that started at
+// sessionCreatedAt, or at the token's own creation if that is zero.
+func (c Client) insertRefreshToken(ctx context.Context, params CreateRefreshTokenParams, sessionCreatedAt time.Time) (RefreshToken, error) {
 	query := `
 		INSERT INTO refresh_tokens (
-			token,
+			token_hash,
 			created_at,
 			updated_at,
 			user_id,
-			expires_at
-		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
+			expires_at,
+			family_id,
+			session_created_at,
+			user_agent,
+			ip_address,
+			scopes
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, params.Token, params.UserID.String(), params.ExpiresAt)
+	createdAt := now()
+	if sessionCreatedAt.IsZero() {
+		sessionCreatedAt = createdAt
+	}
+	_, err := c.db.ExecContext(
+		ctx,
+		query,
+		params.TokenHash,
+		createdAt,
+		createdAt,
+		params.UserID.String(),
+		params.ExpiresAt,
+		params.FamilyID.String(),
+		sessionCreatedAt,
+		params.UserAgent,
+		params.IPAddress,
+		strings.Join(params.Scopes, ","),
+	)
+	if err != nil {
+		return RefreshToken{}, translateError(err)
+	}
+
+	return c.GetRefreshToken(ctx, params.TokenHash)
+}
+
+// RotateRefreshToken exchanges a live refresh token for a new one in the
+// same family: the token hashing to tokenHash is revoked and next, which must
+// have a new TokenHash and ExpiresAt and describes the client refreshing, is
+// created for the same user. Unknown and expired tokens return
+// ErrNotFound. A token that was already revoked returns
+// ErrRefreshTokenReused after revoking every token in its family.
+func (c Client) RotateRefreshToken(ctx context.Context, tokenHash string, next CreateRefreshTokenParams) (RefreshToken, error) {
+	var rotated RefreshToken
+	reused := false
+	err := c.inTx(ctx, func(tx Client) error {
+		current, err := tx.GetRefreshToken(ctx, tokenHash)
+		if err != nil {
+			return err
+		}
+		if current.RevokedAt != nil {
+			// Commit the family revocation; the error is reported after.
+			reused = true
+			return tx.revokeRefreshTokenFamily(ctx, current.FamilyID)
+		}
+		if !current.ExpiresAt.After(time.Now()) {
+			return ErrNotFound
+		}
+
+		// Guard the revocation, so if two refreshes race with the same
+		// token the loser is treated as the reuse it is.
+		res, err := tx.db.ExecContext(ctx, `
+			UPDATE refresh_tokens
+			SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP, replaced_by_hash = ?
+			WHERE token_hash = ? AND revoked_at IS NULL
+		`, next.TokenHash, tokenHash)
+		if err != nil {
+			return err
+		}
+		if err := requireAffected(res); errors.Is(err, ErrNotFound) {
+			reused = true
+			return tx.revokeRefreshTokenFamily(ctx, current.FamilyID)
+		} else if err != nil {
+			return err
+		}
+
+		next.UserID = current.UserID
+		next.FamilyID = current.FamilyID
+		next.Scopes = current.Scopes
+		rotated, err = tx.insertRefreshToken(ctx, next, current.SessionCreatedAt)
+		return err
+	})
 	if err != nil {
 		return RefreshToken{}, err
 	}
+	if reused {
+		return RefreshToken{}, ErrRefreshTokenReused
+	}
+	return rotated, nil
+}
 
-	return c.GetRefreshToken(params.Token)
+func (c Client) revokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := c.db.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE family_id = ? AND revoked_at IS NULL
+	`, familyID.String())
+	return err
 }
 
-func (c Client) RevokeRefreshToken(token string) error {
+func (c Client) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
 	query := `
 		UPDATE refresh_tokens
 		SET revoked_at = CURRENT_TIMESTAMP
-		WHERE token = ?
+		WHERE token_hash = ?
 	`
-	_, err := c.db.Exec(query, token)
-	return err
+	res, err := c.db.ExecContext(ctx, query, tokenHash)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
 }
 
-func (c Client) GetRefreshToken(token string) (RefreshToken, error) {
+func (c Client) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
 	query := `
-		SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
+		SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by_hash,
+			session_created_at, user_agent, ip_address, scopes
 		FROM refresh_tokens
-		WHERE token = ?
+		WHERE token_hash = ?
 	`
 	var rt RefreshToken
-	var userID string
-	err := c.db.QueryRow(query, token).
-		Scan(&rt.Token, &rt.CreatedAt, &rt.UpdatedAt, &userID, &rt.ExpiresAt, &rt.RevokedAt)
+	var userID, familyID, scopes string
+	err := c.db.QueryRowContext(ctx, query, tokenHash).
+		Scan(&rt.TokenHash, &rt.CreatedAt, &rt.UpdatedAt, &userID, &rt.ExpiresAt, &rt.RevokedAt, &familyID, &rt.ReplacedByHash,
+			&rt.SessionCreatedAt, &rt.UserAgent, &rt.IPAddress, &scopes)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return RefreshToken{}, nil
-		}
-		return RefreshToken{}, err
+		return RefreshToken{}, translateError(err)
 	}
 
 	rt.UserID, err = uuid.Parse(userID)
 	if err != nil {
 		return RefreshToken{}, err
 	}
+	rt.FamilyID, err = uuid.Parse(familyID)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	rt.Scopes = splitScopes(scopes)
 
 	return rt, nil
 }
 
-func (c Client) DeleteRefreshToken(token string) error {
+func (c Client) DeleteRefreshToken(ctx context.Context, tokenHash string) error {
 	query := `
 		DELETE FROM refresh_tokens
-		WHERE token = ?
+		WHERE token_hash = ?
 	`
-	_, err := c.db.Exec(query, token)
-	return err
+	res, err := c.db.ExecContext(ctx, query, tokenHash)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// splitScopes parses a comma-separated scopes column.
+func splitScopes(scopes string) []string {
+	if scopes == "" {
+		return []string{}
+	}
+	return strings.Split(scopes, ",")
 }
@@ -0,0 +1,208 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultSearchPageSize = 20
+	MaxSearchPageSize     = 50
+	maxSearchTerms        = 10
+)
+
+// ErrEmptyQuery is returned when a search query has no searchable words.
+var ErrEmptyQuery = errors.New("empty search query")
+
+// Highlight delimiters are control characters the backends wrap matches
+// in. They are swapped for <mark> tags only after the surrounding text has
+// been HTML-escaped, so user-supplied titles can't inject markup.
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// SearchVideosParams describes a full-text search over one user's videos.
+type SearchVideosParams struct {
+	UserID uuid.UUID
+	Query  string
+	// Limit is clamped to MaxSearchPageSize and defaults to DefaultSearchPageSize.
+	Limit  int
+	Offset int
+}
+
+// VideoSearchResult is a matching video with its relevance and HTML snippets
+// in which matched words are wrapped in <mark> tags.
+type VideoSearchResult struct {
+	Video
+	Rank               float64 `json:"rank"`
+	TitleHighlight     string  `json:"title_highlight"`
+	DescriptionSnippet string  `json:"description_snippet"`
+}
+
+// SearchTerms splits a query into the lowercased words it searches for.
+// Every term matches as a prefix.
+func SearchTerms(query string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return terms
+}
+
+// Normalize fills in defaults and clamps the page size.
+func (p SearchVideosParams) Normalize() SearchVideosParams {
+	if p.Limit <= 0 {
+		p.Limit = DefaultSearchPageSize
+	}
+	if p.Limit > MaxSearchPageSize {
+		p.Limit = MaxSearchPageSize
+	}
+	if p.Offset < 0 {
+		p.Offset = 0
+	}
+	return p
+}
+
+// SearchVideos ranks a user's videos against the query. It is backed by FTS5
+// on SQLite and a tsvector index on Postgres.
+func (c Client) SearchVideos(ctx context.Context, params SearchVideosParams) ([]VideoSearchResult, error) {
+	params = params.Normalize()
+	terms := SearchTerms(params.Query)
+	if len(terms) == 0 {
+		return nil, ErrEmptyQuery
+	}
+
+	var query string
+	var args []any
+	if c.db.dialect == dialectPostgres {
+		prefixes := make([]string, len(terms))
+		for i, term := range terms {
+			prefixes[i] = term + ":*"
+		}
+		query = `
+		SELECT ` + videoColumns("v") + `,
+			ts_rank(v.search_document, q.query) AS rank,
+			ts_headline('simple', v.title, q.query, 'StartSel=` + highlightStart + `, StopSel=` + highlightStop + `, HighlightAll=true'),
+			ts_headline('simple', v.description, q.query, 'StartSel=` + highlightStart + `, StopSel=` + highlightStop + `, MaxWords=24, MinWords=8')
+		FROM videos v, to_tsquery('simple', ?) AS q(query)
+		WHERE v.user_id = ? AND v.search_document @@ q.query
+		ORDER BY rank DESC, v.id
+		LIMIT ? OFFSET ?
+		`
+		args = []any{strings.Join(prefixes, " & "), params.UserID, params.Limit, params.Offset}
+	} else {
+		// Quote every term so FTS5 operators in user input are taken literally.
+		prefixes := make([]string, len(terms))
+		for i, term := range terms {
+			prefixes[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+		}
+		// bm25 is lower-is-better, so negate it to get a score where higher wins.
+		query = `
+		SELECT ` + videoColumns("v") + `,
+			-bm25(videos_fts, 10.0, 4.0, 2.0, 1.0) AS rank,
+			highlight(videos_fts, 0, '` + highlightStart + `', '` + highlightStop + `'),
+			snippet(videos_fts, 1, '` + highlightStart + `', '` + highlightStop + `', '…', 24)
+		FROM videos_fts
+		JOIN video_search_docs d ON d.doc_id = videos_fts.rowid
+		JOIN videos v ON v.id = d.video_id
+		WHERE videos_fts MATCH ? AND v.user_id = ?
+		ORDER BY rank DESC, v.id
+		LIMIT ? OFFSET ?
+		`
+		args = []any{strings.Join(prefixes, " "), params.UserID, params.Limit, params.Offset}
+	}
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []VideoSearchResult{}
+	for rows.Next() {
+		var result VideoSearchResult
+		var titleHighlight, descriptionSnippet string
+		if err := rows.Scan(
+			&result.ID,
+			&result.CreatedAt,
+			&result.UpdatedAt,
+			&result.Title,
+			&result.Description,
+			&result.ThumbnailURL,
+			&result.VideoURL,
+			&result.Status,
+			&result.DurationSeconds,
+			&result.AspectRatio,
+			&result.Visibility,
+			&result.UserID,
+			&result.Rank,
+			&titleHighlight,
+			&descriptionSnippet,
+		); err != nil {
+			return nil, err
+		}
+		result.TitleHighlight = HighlightHTML(titleHighlight)
+		result.DescriptionSnippet = HighlightHTML(descriptionSnippet)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	videos := make([]*Video, len(results))
+	for i := range results {
+		videos[i] = &results[i].Video
+	}
+	if err := c.attachTags(ctx, videos...); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// HighlightHTML escapes text and turns the backend's highlight delimiters
+// into <mark> tags.
+func HighlightHTML(text string) string {
+	escaped := html.EscapeString(text)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightStop, "</mark>")
+}
+
+// HighlightTerms wraps every word of text that starts with one of terms in
+// highlight delimiters. Backends without native highlighting use it.
+func HighlightTerms(text string, terms []string) string {
+	var b strings.Builder
+	word := []rune{}
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := string(word)
+		lower := strings.ToLower(w)
+		for _, term := range terms {
+			if strings.HasPrefix(lower, term) {
+				w = highlightStart + w + highlightStop
+				break
+			}
+		}
+		b.WriteString(w)
+		word = word[:0]
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		b.WriteRune(r)
+	}
+	flush()
+	return b.String()
+}
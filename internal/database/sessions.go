@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is one login as its user sees it: a refresh token family, shown
+// through the family's live token. Its ID is the family ID.
+type Session struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// LastUsedAt is when the session last refreshed, which is when its live
+	// token was issued.
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// UserAgent and IPAddress describe the client that last refreshed.
+	UserAgent string   `json:"user_agent"`
+	IPAddress string   `json:"ip_address"`
+	Scopes    []string `json:"scopes"`
+}
+
+// GetSessions lists a user's active sessions, most recently used first.
+func (c Client) GetSessions(ctx context.Context, userID uuid.UUID) ([]Session, error) {
+	query := `
+		SELECT family_id, session_created_at, created_at, expires_at, user_agent, ip_address, scopes
+		FROM refresh_tokens
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY created_at DESC, family_id
+	`
+	rows, err := c.db.QueryContext(ctx, query, userID.String(), time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		var id, scopes string
+		if err := rows.Scan(
+			&id,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+			&session.UserAgent,
+			&session.IPAddress,
+			&scopes,
+		); err != nil {
+			return nil, err
+		}
+		session.ID, err = uuid.Parse(id)
+		if err != nil {
+			return nil, err
+		}
+		session.Scopes = splitScopes(scopes)
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes every token in one of a user's sessions. It returns
+// ErrNotFound if the user has no unrevoked session with that ID.
+func (c Client) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND family_id = ? AND revoked_at IS NULL
+	`
+	res, err := c.db.ExecContext(ctx, query, userID.String(), sessionID.String())
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// RevokeOtherSessions revokes all of a user's sessions except keep. Pass
+// uuid.Nil to revoke them all.
+func (c Client) RevokeOtherSessions(ctx context.Context, userID, keep uuid.UUID) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND family_id <> ? AND revoked_at IS NULL
+	`
+	_, err := c.db.ExecContext(ctx, query, userID.String(), keep.String())
+	return err
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Storage cleanup kinds.
+const (
+	CleanupKindS3    = "s3"
+	CleanupKindAsset = "asset"
+)
+
+// StorageCleanup is an outbox entry for a stored file that should be deleted.
+// Entries are written in the same transaction as the row change that orphaned
+// the file, and removed once a worker has deleted it.
+type StorageCleanup struct {
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	Kind          string    `json:"kind"`
+	Bucket        string    `json:"bucket"`
+	Key           string    `json:"key"`
+	Attempts      int       `json:"attempts"`
+	LastError     *string   `json:"last_error"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+}
+
+func (c Client) EnqueueStorageCleanup(ctx context.Context, kind, bucket, key string) error {
+	query := `
+	INSERT INTO storage_cleanup (
+		id,
+		created_at,
+		kind,
+		bucket,
+		object_key,
+		next_attempt_at
+	) VALUES (?, ?, ?, ?, ?, ?)
+	`
+	now := time.Now().UTC()
+	_, err := c.db.ExecContext(ctx, query, uuid.New(), now, kind, bucket, key, now)
+	return translateError(err)
+}
+
+// GetDueStorageCleanup returns up to limit entries whose next attempt is due.
+func (c Client) GetDueStorageCleanup(ctx context.Context, limit int) ([]StorageCleanup, error) {
+	query := `
+	SELECT id, created_at, kind, bucket, object_key, attempts, last_error, next_attempt_at
+	FROM storage_cleanup
+	WHERE next_attempt_at <= ?
+	ORDER BY next_attempt_at
+	LIMIT ?
+	`
+	rows, err := c.db.QueryContext(ctx, query, time.Now().UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []StorageCleanup{}
+	for rows.Next() {
+		var item StorageCleanup
+		if err := rows.Scan(
+			&item.ID,
+			&item.CreatedAt,
+			&item.Kind,
+			&item.Bucket,
+			&item.Key,
+			&item.Attempts,
+			&item.LastError,
+			&item.NextAttemptAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// CompleteStorageCleanup removes an entry once its file is gone.
+func (c Client) CompleteStorageCleanup(ctx context.Context, id uuid.UUID) error {
+	res, err := c.db.ExecContext(ctx, `DELETE FROM storage_cleanup WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// RetryStorageCleanup records a failed attempt and schedules the next one.
+func (c Client) RetryStorageCleanup(ctx context.Context, id uuid.UUID, lastError string, nextAttemptAt time.Time) error {
+	query := `
+	UPDATE storage_cleanup
+	SET
+		attempts = attempts + 1,
+		last_error = ?,
+		next_attempt_at = ?
+	WHERE id = ?
+	`
+	res, err := c.db.ExecContext(ctx, query, lastError, nextAttemptAt.UTC(), id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
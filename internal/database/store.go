@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserStore persists user accounts.
+type UserStore interface {
+	GetUsers(ctx context.Context) ([]User, error)
+	GetUser(ctx context.Context, id uuid.UUID) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserByRefreshToken(ctx context.Context, tokenHash string) (*User, error)
+	CreateUser(ctx context.Context, params CreateUserParams) (*User, error)
+	UpdateUserPassword(ctx context.Context, id uuid.UUID, password string) error
+	MarkEmailVerified(ctx context.Context, id uuid.UUID) error
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+}
+
+// AccountTokenStore persists the single-use tokens mailed to users, by hash.
+type AccountTokenStore interface {
+	CreateAccountToken(ctx context.Context, params CreateAccountTokenParams) (AccountToken, error)
+	CountAccountTokens(ctx context.Context, userID uuid.UUID, purpose AccountTokenPurpose, since time.Time) (int, error)
+	UseAccountToken(ctx context.Context, purpose AccountTokenPurpose, tokenHash string) (AccountToken, error)
+}
+
+// IdentityStore persists the OpenID Connect provider accounts linked to
+// users.
+type IdentityStore interface {
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (*User, error)
+	LinkUserIdentity(ctx context.Context, userID uuid.UUID, issuer, subject string) error
+}
+
+// TokenStore persists refresh tokens, by hash, and the sessions they
+// rotate in.
+type TokenStore interface {
+	CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) (RefreshToken, error)
+	GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, tokenHash string, next CreateRefreshTokenParams) (RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, tokenHash string) error
+	DeleteRefreshToken(ctx context.Context, tokenHash string) error
+	GetSessions(ctx context.Context, userID uuid.UUID) ([]Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	RevokeOtherSessions(ctx context.Context, userID, keep uuid.UUID) error
+}
+
+// APIKeyStore persists users' API keys, by hash.
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, params CreateAPIKeyParams) (APIKey, error)
+	GetAPIKeys(ctx context.Context, userID uuid.UUID) ([]APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (APIKey, error)
+	DeleteAPIKey(ctx context.Context, userID, id uuid.UUID) error
+	RecordAPIKeyUse(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+// VideoStore persists video metadata.
+type VideoStore interface {
+	ListVideos(ctx context.Context, params ListVideosParams) (VideoPage, error)
+	SearchVideos(ctx context.Context, params SearchVideosParams) ([]VideoSearchResult, error)
+	GetVideo(ctx context.Context, id uuid.UUID) (Video, error)
+	CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error)
+	UpdateVideo(ctx context.Context, video Video) (Video, error)
+	UpdateVideoIfUnmodified(ctx context.Context, video Video, unmodifiedSince time.Time) (Video, error)
+	DeleteVideo(ctx context.Context, id uuid.UUID) error
+	ListTags(ctx context.Context, params ListTagsParams) ([]Tag, error)
+}
+
+// ShareStore persists video share links.
+type ShareStore interface {
+	CreateVideoShare(ctx context.Context, params CreateVideoShareParams) (VideoShare, error)
+	GetVideoShares(ctx context.Context, videoID uuid.UUID) ([]VideoShare, error)
+	GetVideoShareByTokenHash(ctx context.Context, tokenHash string) (VideoShare, error)
+	RevokeVideoShare(ctx context.Context, videoID, id uuid.UUID) error
+	RecordVideoShareView(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+// CollaboratorStore persists the roles users have on each other's videos.
+type CollaboratorStore interface {
+	GetVideoCollaborator(ctx context.Context, videoID, userID uuid.UUID) (VideoCollaborator, error)
+	GetVideoCollaborators(ctx context.Context, videoID uuid.UUID) ([]VideoCollaborator, error)
+	SetVideoCollaborator(ctx context.Context, videoID, userID uuid.UUID, role VideoRole) (VideoCollaborator, error)
+	DeleteVideoCollaborator(ctx context.Context, videoID, userID uuid.UUID) error
+}
+
+// PlaylistStore persists playlists and the order of the videos in them.
+type PlaylistStore interface {
+	CreatePlaylist(ctx context.Context, params CreatePlaylistParams) (Playlist, error)
+	GetPlaylist(ctx context.Context, id uuid.UUID) (Playlist, error)
+	GetPlaylists(ctx context.Context, userID uuid.UUID) ([]Playlist, error)
+	UpdatePlaylist(ctx context.Context, playlist Playlist) (Playlist, error)
+	DeletePlaylist(ctx context.Context, id uuid.UUID) error
+	GetPlaylistVideos(ctx context.Context, playlistID uuid.UUID) ([]Video, error)
+	AddPlaylistVideo(ctx context.Context, playlistID, videoID uuid.UUID) error
+	RemovePlaylistVideo(ctx context.Context, playlistID, videoID uuid.UUID) error
+	ReorderPlaylistVideos(ctx context.Context, playlistID uuid.UUID, videoIDs []uuid.UUID) error
+}
+
+// AnalyticsStore persists playback sessions and daily per-video stats.
+type AnalyticsStore interface {
+	RecordPlaybackEvent(ctx context.Context, event PlaybackEvent) error
+	GetVideoAnalytics(ctx context.Context, videoID uuid.UUID, from, to time.Time) (VideoAnalytics, error)
+}
+
+// WebhookStore persists users' webhooks and the log of deliveries to them.
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, params CreateWebhookParams) (Webhook, error)
+	GetWebhook(ctx context.Context, id uuid.UUID) (Webhook, error)
+	GetWebhooks(ctx context.Context, userID uuid.UUID) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+	EnqueueWebhookEvent(ctx context.Context, userID uuid.UUID, eventType string, payload []byte) error
+	GetWebhookDelivery(ctx context.Context, id uuid.UUID) (WebhookDelivery, error)
+	GetWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]WebhookDelivery, error)
+	ClaimDueWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error)
+	CompleteWebhookDelivery(ctx context.Context, id uuid.UUID, statusCode int) error
+	RetryWebhookDelivery(ctx context.Context, id uuid.UUID, statusCode *int, lastError string, nextAttemptAt *time.Time) error
+	ReplayWebhookDelivery(ctx context.Context, id uuid.UUID) (WebhookDelivery, error)
+}
+
+// CleanupStore is the outbox of stored files waiting to be deleted.
+type CleanupStore interface {
+	EnqueueStorageCleanup(ctx context.Context, kind, bucket, key string) error
+	GetDueStorageCleanup(ctx context.Context, limit int) ([]StorageCleanup, error)
+	CompleteStorageCleanup(ctx context.Context, id uuid.UUID) error
+	RetryStorageCleanup(ctx context.Context, id uuid.UUID, lastError string, nextAttemptAt time.Time) error
+}
+
+// Store is everything the API needs from a database. Lookups that match
+// nothing return ErrNotFound and writes that break a uniqueness rule return
+// ErrConflict, whatever the backend.
+type Store interface {
+	UserStore
+	AccountTokenStore
+	IdentityStore
+	TokenStore
+	APIKeyStore
+	VideoStore
+	ShareStore
+	CollaboratorStore
+	PlaylistStore
+	AnalyticsStore
+	WebhookStore
+	CleanupStore
+	// WithTx runs fn as a single unit of work: every call fn makes on tx
+	// commits together, or none do if fn returns an error.
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+	Reset(ctx context.Context) error
+}
+
+var _ Store = Client{}
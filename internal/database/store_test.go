@@ -0,0 +1,1154 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database/dbtest"
+	"github.com/google/uuid"
+)
+
+// postgresDSNEnv names the Postgres database the store tests also run
+// against when it is set. The tests empty it first, so never point it at a
+// database you want to keep.
+const postgresDSNEnv = "TUBELY_TEST_POSTGRES_DSN"
+
+// newSQLiteClient returns a migrated client on a fresh SQLite file.
+func newSQLiteClient(t *testing.T) database.Client {
+	t.Helper()
+	c, err := database.NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// newPostgresClient returns a migrated, emptied client on the database in
+// TUBELY_TEST_POSTGRES_DSN, and skips the test if it isn't set.
+func newPostgresClient(t *testing.T) database.Client {
+	t.Helper()
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+	c, err := database.NewClient(dsn)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if err := c.Reset(context.Background()); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	return c
+}
+
+func TestSQLiteStore(t *testing.T) {
+	runStoreTests(t, func(t *testing.T) database.Store { return newSQLiteClient(t) })
+}
+
+func TestPostgresStore(t *testing.T) {
+	if os.Getenv(postgresDSNEnv) == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+	runStoreTests(t, func(t *testing.T) database.Store { return newPostgresClient(t) })
+}
+
+// TestMemoryStore holds the in-memory fake handler tests use to the same
+// contract as the SQL client.
+func TestMemoryStore(t *testing.T) {
+	runStoreTests(t, func(t *testing.T) database.Store { return dbtest.NewStore() })
+}
+
+// runStoreTests checks the Store contract. Every implementation must pass
+// it, so handlers behave the same whatever the backend.
+func runStoreTests(t *testing.T, newStore func(t *testing.T) database.Store) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s database.Store)
+	}{
+		{"Users", testUsers},
+		{"Videos", testVideos},
+		{"VideoListing", testVideoListing},
+		{"Search", testSearch},
+		{"SearchRanking", testSearchRanking},
+		{"Tags", testTags},
+		{"RefreshTokens", testRefreshTokens},
+		{"APIKeys", testAPIKeys},
+		{"AccountTokens", testAccountTokens},
+		{"Identities", testIdentities},
+		{"VideoShares", testVideoShares},
+		{"Collaborators", testCollaborators},
+		{"Playlists", testPlaylists},
+		{"PlaylistCovers", testPlaylistCovers},
+		{"PlaybackAnalytics", testPlaybackAnalytics},
+		{"PlaybackSessionLimit", testPlaybackSessionLimit},
+		{"WebhookDeliveries", testWebhookDeliveries},
+		{"WithTx", testWithTx},
+		{"DeleteUser", testDeleteUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStore(t))
+		})
+	}
+}
+
+func createUser(t *testing.T, s database.Store, email string) database.User {
+	t.Helper()
+	user, err := s.CreateUser(context.Background(), database.CreateUserParams{Email: email, Password: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser(%q): %v", email, err)
+	}
+	return *user
+}
+
+func createVideo(t *testing.T, s database.Store, userID uuid.UUID, title, visibility string) database.Video {
+	t.Helper()
+	video, err := s.CreateVideo(context.Background(), database.CreateVideoParams{
+		Title:      title,
+		UserID:     userID,
+		Visibility: visibility,
+	})
+	if err != nil {
+		t.Fatalf("CreateVideo(%q): %v", title, err)
+	}
+	return video
+}
+
+func wantErr(t *testing.T, what string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Fatalf("%s: got error %v, want %v", what, err, want)
+	}
+}
+
+func testUsers(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "a@example.com")
+	if user.Email != "a@example.com" || user.EmailVerified() {
+		t.Fatalf("CreateUser returned %+v", user)
+	}
+
+	_, err := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", Password: "other"})
+	wantErr(t, "CreateUser with a taken email", err, database.ErrConflict)
+	_, err = s.CreateUser(ctx, database.CreateUserParams{Email: "A@Example.com", Password: "other"})
+	wantErr(t, "CreateUser with a taken email in other case", err, database.ErrConflict)
+
+	for _, email := range []string{"a@example.com", "A@EXAMPLE.COM"} {
+		got, err := s.GetUserByEmail(ctx, email)
+		if err != nil || got.ID != user.ID {
+			t.Fatalf("GetUserByEmail(%q) = %v, %v", email, got.ID, err)
+		}
+	}
+	_, err = s.GetUserByEmail(ctx, "nobody@example.com")
+	wantErr(t, "GetUserByEmail for an unknown email", err, database.ErrNotFound)
+	_, err = s.GetUser(ctx, uuid.New())
+	wantErr(t, "GetUser for an unknown ID", err, database.ErrNotFound)
+
+	if err := s.UpdateUserPassword(ctx, user.ID, "new-hash"); err != nil {
+		t.Fatalf("UpdateUserPassword: %v", err)
+	}
+	wantErr(t, "UpdateUserPassword for an unknown ID", s.UpdateUserPassword(ctx, uuid.New(), "x"), database.ErrNotFound)
+
+	if err := s.MarkEmailVerified(ctx, user.ID); err != nil {
+		t.Fatalf("MarkEmailVerified: %v", err)
+	}
+	first, err := s.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if first.Password != "new-hash" || !first.EmailVerified() {
+		t.Fatalf("GetUser after updates = %+v", first)
+	}
+	// Verifying again keeps the first time.
+	if err := s.MarkEmailVerified(ctx, user.ID); err != nil {
+		t.Fatalf("MarkEmailVerified again: %v", err)
+	}
+	again, _ := s.GetUser(ctx, user.ID)
+	if !again.EmailVerifiedAt.Equal(*first.EmailVerifiedAt) {
+		t.Fatalf("MarkEmailVerified moved email_verified_at from %v to %v", first.EmailVerifiedAt, again.EmailVerifiedAt)
+	}
+
+	users, err := s.GetUsers(ctx)
+	if err != nil || len(users) != 1 {
+		t.Fatalf("GetUsers = %d users, %v", len(users), err)
+	}
+}
+
+func testVideos(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "a@example.com")
+
+	video, err := s.CreateVideo(ctx, database.CreateVideoParams{
+		Title:       "First",
+		Description: "desc",
+		UserID:      user.ID,
+		Tags:        []string{"Go", "go", " Tutorials "},
+	})
+	if err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+	if video.Visibility != database.VideoVisibilityPrivate || video.Status != database.VideoStatusDraft {
+		t.Fatalf("CreateVideo defaults: visibility %q, status %q", video.Visibility, video.Status)
+	}
+
+	got, err := s.GetVideo(ctx, video.ID)
+	if err != nil {
+		t.Fatalf("GetVideo: %v", err)
+	}
+	if got.Title != "First" || got.UserID != user.ID || len(got.Tags) != 2 {
+		t.Fatalf("GetVideo = %+v", got)
+	}
+	_, err = s.GetVideo(ctx, uuid.New())
+	wantErr(t, "GetVideo for an unknown ID", err, database.ErrNotFound)
+
+	url := "https://example.com/v.mp4"
+	got.VideoURL = &url
+	got.Title = "Renamed"
+	got.Tags = nil
+	updated, err := s.UpdateVideo(ctx, got)
+	if err != nil {
+		t.Fatalf("UpdateVideo: %v", err)
+	}
+	if updated.Title != "Renamed" || updated.VideoURL == nil || *updated.VideoURL != url || len(updated.Tags) != 2 {
+		t.Fatalf("UpdateVideo = %+v", updated)
+	}
+
+	_, err = s.UpdateVideoIfUnmodified(ctx, updated, updated.UpdatedAt.Add(-time.Hour))
+	wantErr(t, "UpdateVideoIfUnmodified with an old time", err, database.ErrStale)
+	if _, err := s.UpdateVideoIfUnmodified(ctx, updated, updated.UpdatedAt); err != nil {
+		t.Fatalf("UpdateVideoIfUnmodified with the current time: %v", err)
+	}
+
+	if err := s.DeleteVideo(ctx, video.ID); err != nil {
+		t.Fatalf("DeleteVideo: %v", err)
+	}
+	wantErr(t, "DeleteVideo twice", s.DeleteVideo(ctx, video.ID), database.ErrNotFound)
+	_, err = s.GetVideo(ctx, video.ID)
+	wantErr(t, "GetVideo after delete", err, database.ErrNotFound)
+}
+
+func testVideoListing(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "a@example.com")
+	other := createUser(t, s, "b@example.com")
+	for _, title := range []string{"one", "two", "three", "four", "five"} {
+		createVideo(t, s, user.ID, title, database.VideoVisibilityPrivate)
+	}
+	createVideo(t, s, other.ID, "not mine", database.VideoVisibilityPublic)
+
+	seen := map[uuid.UUID]bool{}
+	params := database.ListVideosParams{UserID: user.ID, Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("ListVideos never ran out of pages")
+		}
+		page, err := s.ListVideos(ctx, params)
+		if err != nil {
+			t.Fatalf("ListVideos: %v", err)
+		}
+		for _, v := range page.Videos {
+			if v.UserID != user.ID {
+				t.Fatalf("ListVideos returned another user's video %q", v.Title)
+			}
+			if seen[v.ID] {
+				t.Fatalf("ListVideos returned %q twice", v.Title)
+			}
+			seen[v.ID] = true
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		params.After = *page.NextCursor
+	}
+	if len(seen) != 5 {
+		t.Fatalf("ListVideos returned %d videos over all pages, want 5", len(seen))
+	}
+
+	_, err := s.ListVideos(ctx, database.ListVideosParams{UserID: user.ID, After: "not a cursor"})
+	wantErr(t, "ListVideos with a bad cursor", err, database.ErrInvalidCursor)
+}
+
+// search returns the titles of user's videos that match query, best first.
+func search(t *testing.T, s database.Store, userID uuid.UUID, query string) []string {
+	t.Helper()
+	results, err := s.SearchVideos(context.Background(), database.SearchVideosParams{UserID: userID, Query: query})
+	if err != nil {
+		t.Fatalf("SearchVideos(%q): %v", query, err)
+	}
+	out := []string{}
+	for _, result := range results {
+		out = append(out, result.Title)
+	}
+	return out
+}
+
+func testSearch(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "a@example.com")
+	other := createUser(t, s, "b@example.com")
+	createVideo(t, s, other.ID, "Alpine hiking", database.VideoVisibilityPublic)
+
+	// The index follows every insert, update and delete.
+	video, err := s.CreateVideo(ctx, database.CreateVideoParams{Title: "Alpine hiking", Description: "Glaciers and passes", UserID: user.ID})
+	if err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+	if got := search(t, s, user.ID, "alp"); !slices.Equal(got, []string{"Alpine hiking"}) {
+		t.Fatalf("search after insert = %q, want only the user's own video", got)
+	}
+	if got := search(t, s, user.ID, "glacier"); len(got) != 1 {
+		t.Fatalf("search of the description = %q", got)
+	}
+
+	video.Title = "Coastal walks"
+	video.Description = "Cliffs and coves"
+	if _, err := s.UpdateVideo(ctx, video); err != nil {
+		t.Fatalf("UpdateVideo: %v", err)
+	}
+	for query, want := range map[string]int{"alpine": 0, "glaciers": 0, "coastal": 1, "coves": 1} {
+		if got := search(t, s, user.ID, query); len(got) != want {
+			t.Fatalf("search(%q) after update = %q, want %d results", query, got, want)
+		}
+	}
+
+	if err := s.DeleteVideo(ctx, video.ID); err != nil {
+		t.Fatalf("DeleteVideo: %v", err)
+	}
+	if got := search(t, s, user.ID, "coastal"); len(got) != 0 {
+		t.Fatalf("search after delete = %q", got)
+	}
+
+	// Every term must match, and search syntax in the query is just text.
+	createVideo(t, s, user.ID, "Mountain bikes", database.VideoVisibilityPrivate)
+	if got := search(t, s, user.ID, "mountain cars"); len(got) != 0 {
+		t.Fatalf("search with an unmatched term = %q", got)
+	}
+	if got := search(t, s, user.ID, `mountain OR "cars" NEAR(bikes*`); len(got) != 0 {
+		t.Fatalf("search with FTS operators = %q", got)
+	}
+	if got := search(t, s, user.ID, `"mountain" bikes*`); !slices.Equal(got, []string{"Mountain bikes"}) {
+		t.Fatalf("search with quotes = %q", got)
+	}
+	_, err = s.SearchVideos(ctx, database.SearchVideosParams{UserID: user.ID, Query: " *!? "})
+	wantErr(t, "SearchVideos without words", err, database.ErrEmptyQuery)
+
+	// Highlights are HTML with only our <mark> tags in it.
+	createVideo(t, s, user.ID, `Rust <script>alert("x")</script> & friends`, database.VideoVisibilityPrivate)
+	results, err := s.SearchVideos(ctx, database.SearchVideosParams{UserID: user.ID, Query: "rust"})
+	if err != nil || len(results) != 1 {
+		t.Fatalf("SearchVideos = %v, %v", results, err)
+	}
+	if want := `<mark>Rust</mark> &lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; friends`; results[0].TitleHighlight != want {
+		t.Fatalf("TitleHighlight = %s, want %s", results[0].TitleHighlight, want)
+	}
+}
+
+func testSearchRanking(t *testing.T, s database.Store) {
+	user := createUser(t, s, "a@example.com")
+	create := func(title, description string) {
+		t.Helper()
+		_, err := s.CreateVideo(context.Background(), database.CreateVideoParams{Title: title, Description: description, UserID: user.ID})
+		if err != nil {
+			t.Fatalf("CreateVideo(%q): %v", title, err)
+		}
+	}
+	create("Gardening basics", "All about gophers in the garden")
+	create("Gophers explained", "A short film about burrows")
+	create("Gophers of the prairie", "Where gophers live and what gophers eat")
+	// Videos that don't match make the term rare enough to rank on.
+	for _, title := range []string{"Cooking", "Sailing", "Knitting", "Chess", "Painting", "Running"} {
+		create(title, "Nothing to see here")
+	}
+
+	// Title matches outrank description matches, and more matches rank
+	// higher.
+	want := []string{"Gophers of the prairie", "Gophers explained", "Gardening basics"}
+	if got := search(t, s, user.ID, "gopher"); !slices.Equal(got, want) {
+		t.Fatalf("search ranked %q, want %q", got, want)
+	}
+
+	results, err := s.SearchVideos(context.Background(), database.SearchVideosParams{UserID: user.ID, Query: "gopher", Limit: 1, Offset: 1})
+	if err != nil || len(results) != 1 || results[0].Title != want[1] {
+		t.Fatalf("second page of one = %v, %v", results, err)
+	}
+}
+
+func testTags(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "a@example.com")
+	other := createUser(t, s, "b@example.com")
+	create := func(userID uuid.UUID, title string, tags ...string) database.Video {
+		t.Helper()
+		video, err := s.CreateVideo(ctx, database.CreateVideoParams{Title: title, UserID: userID, Tags: tags})
+		if err != nil {
+			t.Fatalf("CreateVideo(%q): %v", title, err)
+		}
+		return video
+	}
+	listTags := func(userID uuid.UUID, prefix string) []string {
+		t.Helper()
+		tags, err := s.ListTags(ctx, database.ListTagsParams{UserID: userID, Prefix: prefix})
+		if err != nil {
+			t.Fatalf("ListTags(%q): %v", prefix, err)
+		}
+		names := []string{}
+		for _, tag := range tags {
+			names = append(names, fmt.Sprintf("%s:%d", tag.Name, tag.VideoCount))
+		}
+		return names
+	}
+	listTagged := func(tags ...string) []string {
+		t.Helper()
+		page, err := s.ListVideos(ctx, database.ListVideosParams{UserID: user.ID, Tags: tags, Sort: database.VideoSortTitle, Ascending: true})
+		if err != nil {
+			t.Fatalf("ListVideos(%q): %v", tags, err)
+		}
+		return titles(page.Videos)
+	}
+
+	hike := create(user.ID, "Hike", "Road  Trip", "outdoors", "road trip")
+	create(user.ID, "Drive", "road trip", "cars")
+	create(user.ID, "Percent", "100%", "100 pct", "a_b", "axb", `c\d`, "cd")
+	create(other.ID, "Theirs", "road trip", "outdoors")
+
+	got, err := s.GetVideo(ctx, hike.ID)
+	if err != nil || !slices.Equal(got.Tags, []string{"outdoors", "road trip"}) {
+		t.Fatalf("GetVideo tags = %q, %v; want them normalized, deduplicated and sorted", got.Tags, err)
+	}
+
+	// Most used first, then by name, and only the user's own.
+	if got := listTags(user.ID, ""); !slices.Equal(got[:2], []string{"road trip:2", "100 pct:1"}) || len(got) != 9 {
+		t.Fatalf("ListTags = %q", got)
+	}
+	if got := listTags(user.ID, " ROAD "); !slices.Equal(got, []string{"road trip:2"}) {
+		t.Fatalf("ListTags with an unnormalized prefix = %q", got)
+	}
+	// LIKE wildcards in the prefix are matched literally.
+	for prefix, want := range map[string][]string{
+		"100%": {"100%:1"},
+		"a_":   {"a_b:1"},
+		`c\`:   {`c\d:1`},
+		"%":    {},
+		"_":    {},
+	} {
+		if got := listTags(user.ID, prefix); !slices.Equal(got, want) {
+			t.Fatalf("ListTags(%q) = %q, want %q", prefix, got, want)
+		}
+	}
+	tags, err := s.ListTags(ctx, database.ListTagsParams{UserID: user.ID, Limit: 1})
+	if err != nil || len(tags) != 1 {
+		t.Fatalf("ListTags with a limit of 1 = %v, %v", tags, err)
+	}
+
+	// Listings filter on every tag given.
+	if got := listTagged("Road Trip"); !slices.Equal(got, []string{"Drive", "Hike"}) {
+		t.Fatalf("ListVideos tagged road trip = %q", got)
+	}
+	if got := listTagged("road trip", "outdoors"); !slices.Equal(got, []string{"Hike"}) {
+		t.Fatalf("ListVideos tagged road trip and outdoors = %q", got)
+	}
+	if got := listTagged("nothing"); len(got) != 0 {
+		t.Fatalf("ListVideos with an unused tag = %q", got)
+	}
+
+	// Search finds videos by their tags, and follows changes to them.
+	if got := search(t, s, user.ID, "outdoor"); !slices.Equal(got, []string{"Hike"}) {
+		t.Fatalf("search by tag = %q", got)
+	}
+	got.Tags = []string{"mountains"}
+	if _, err := s.UpdateVideo(ctx, got); err != nil {
+		t.Fatalf("UpdateVideo: %v", err)
+	}
+	if got := search(t, s, user.ID, "outdoor"); len(got) != 0 {
+		t.Fatalf("search by a removed tag = %q", got)
+	}
+	if got := search(t, s, user.ID, "mountain"); !slices.Equal(got, []string{"Hike"}) {
+		t.Fatalf("search by an added tag = %q", got)
+	}
+
+	// Tags no video carries any more are gone, for this user only.
+	if got := listTags(user.ID, "outdoors"); len(got) != 0 {
+		t.Fatalf("ListTags of a tag removed from its only video = %q", got)
+	}
+	if got := listTags(other.ID, "outdoors"); !slices.Equal(got, []string{"outdoors:1"}) {
+		t.Fatalf("ListTags of another user's tag = %q", got)
+	}
+	if got := listTags(user.ID, "road"); !slices.Equal(got, []string{"road trip:1"}) {
+		t.Fatalf("ListTags after removing a tag from one of two videos = %q", got)
+	}
+	if err := s.DeleteVideo(ctx, hike.ID); err != nil {
+		t.Fatalf("DeleteVideo: %v", err)
+	}
+	if got := listTags(user.ID, "mountains"); len(got) != 0 {
+		t.Fatalf("ListTags of a deleted video's tag = %q", got)
+	}
+}
+
+func testRefreshTokens(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "a@example.com")
+	expires := time.Now().Add(time.Hour)
+
+	first, err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		TokenHash: "hash-1",
+		UserID:    user.ID,
+		ExpiresAt: expires,
+		Scopes:    []string{"videos:read"},
+	})
+	if err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+	_, err = s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{TokenHash: "hash-1", UserID: user.ID, ExpiresAt: expires})
+	wantErr(t, "CreateRefreshToken with a taken hash", err, database.ErrConflict)
+
+	got, err := s.GetUserByRefreshToken(ctx, "hash-1")
+	if err != nil || got.ID != user.ID {
+		t.Fatalf("GetUserByRefreshToken = %v, %v", got, err)
+	}
+
+	second, err := s.RotateRefreshToken(ctx, "hash-1", database.CreateRefreshTokenParams{TokenHash: "hash-2", ExpiresAt: expires})
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+	if second.FamilyID != first.FamilyID || second.UserID != user.ID || len(second.Scopes) != 1 {
+		t.Fatalf("RotateRefreshToken = %+v, want family %v with the first token's scopes", second, first.FamilyID)
+	}
+	_, err = s.GetUserByRefreshToken(ctx, "hash-1")
+	wantErr(t, "GetUserByRefreshToken for a rotated token", err, database.ErrNotFound)
+
+	// Presenting the rotated token again revokes the whole family.
+	_, err = s.RotateRefreshToken(ctx, "hash-1", database.CreateRefreshTokenParams{TokenHash: "hash-3", ExpiresAt: expires})
+	wantErr(t, "RotateRefreshToken with a used token", err, database.ErrRefreshTokenReused)
+	_, err = s.GetUserByRefreshToken(ctx, "hash-2")
+	wantErr(t, "GetUserByRefreshToken after reuse", err, database.ErrNotFound)
+	_, err = s.RotateRefreshToken(ctx, "unknown", database.CreateRefreshTokenParams{TokenHash: "hash-4", ExpiresAt: expires})
+	wantErr(t, "RotateRefreshToken with an unknown token", err, database.ErrNotFound)
+
+	if _, err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{TokenHash: "hash-5", UserID: user.ID, ExpiresAt: expires}); err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+	sessions, err := s.GetSessions(ctx, user.ID)
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("GetSessions = %d sessions, %v; want the one live session", len(sessions), err)
+	}
+	if err := s.RevokeSession(ctx, user.ID, sessions[0].ID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	wantErr(t, "RevokeSession twice", s.RevokeSession(ctx, user.ID, sessions[0].ID), database.ErrNotFound)
+	wantErr(t, "RevokeRefreshToken for an unknown token", s.RevokeRefreshToken(ctx, "unknown"), database.ErrNotFound)
+}
+
+func testAPIKeys(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "a@example.com")
+	other := createUser(t, s, "b@example.com")
+
+	key, err := s.CreateAPIKey(ctx, database.CreateAPIKeyParams{
+		UserID:  user.ID,
+		Name:    "ci",
+		Prefix:  "tub_abc",
+		KeyHash: "key-hash",
+		Scopes:  []string{"videos:read", "videos:write"},
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	_, err = s.CreateAPIKey(ctx, database.CreateAPIKeyParams{UserID: user.ID, Name: "dup", Prefix: "tub_abc", KeyHash: "key-hash"})
+	wantErr(t, "CreateAPIKey with a taken hash", err, database.ErrConflict)
+
+	got, err := s.GetAPIKeyByHash(ctx, "key-hash")
+	if err != nil || got.ID != key.ID || len(got.Scopes) != 2 {
+		t.Fatalf("GetAPIKeyByHash = %+v, %v", got, err)
+	}
+	_, err = s.GetAPIKeyByHash(ctx, "unknown")
+	wantErr(t, "GetAPIKeyByHash for an unknown hash", err, database.ErrNotFound)
+
+	usedAt := time.Now().UTC().Truncate(time.Second)
+	if err := s.RecordAPIKeyUse(ctx, key.ID, usedAt); err != nil {
+		t.Fatalf("RecordAPIKeyUse: %v", err)
+	}
+	keys, err := s.GetAPIKeys(ctx, user.ID)
+	if err != nil || len(keys) != 1 || keys[0].LastUsedAt == nil || !keys[0].LastUsedAt.Equal(usedAt) {
+		t.Fatalf("GetAPIKeys = %+v, %v", keys, err)
+	}
+
+	wantErr(t, "DeleteAPIKey for another user", s.DeleteAPIKey(ctx, other.ID, key.ID), database.ErrNotFound)
+	if err := s.DeleteAPIKey(ctx, user.ID, key.ID); err != nil {
+		t.Fatalf("DeleteAPIKey: %v", err)
+	}
+	wantErr(t, "DeleteAPIKey twice", s.DeleteAPIKey(ctx, user.ID, key.ID), database.ErrNotFound)
+}
+
+func testAccountTokens(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "a@example.com")
+	create := func(hash string, purpose database.AccountTokenPurpose, ttl time.Duration) {
+		t.Helper()
+		_, err := s.CreateAccountToken(ctx, database.CreateAccountTokenParams{
+			UserID:    user.ID,
+			Purpose:   purpose,
+			TokenHash: hash,
+			ExpiresAt: time.Now().Add(ttl),
+		})
+		if err != nil {
+			t.Fatalf("CreateAccountToken(%q): %v", hash, err)
+		}
+	}
+	create("reset-1", database.AccountTokenPasswordReset, time.Hour)
+	create("reset-2", database.AccountTokenPasswordReset, time.Hour)
+	create("verify-1", database.AccountTokenEmailVerification, time.Hour)
+	create("expired", database.AccountTokenEmailVerification, -time.Minute)
+
+	count, err := s.CountAccountTokens(ctx, user.ID, database.AccountTokenPasswordReset, time.Now().Add(-time.Hour))
+	if err != nil || count != 2 {
+		t.Fatalf("CountAccountTokens = %d, %v; want 2", count, err)
+	}
+
+	_, err = s.UseAccountToken(ctx, database.AccountTokenEmailVerification, "reset-1")
+	wantErr(t, "UseAccountToken for another purpose", err, database.ErrNotFound)
+	_, err = s.UseAccountToken(ctx, database.AccountTokenEmailVerification, "expired")
+	wantErr(t, "UseAccountToken for an expired token", err, database.ErrNotFound)
+
+	token, err := s.UseAccountToken(ctx, database.AccountTokenPasswordReset, "reset-1")
+	if err != nil || token.UserID != user.ID || token.UsedAt == nil {
+		t.Fatalf("UseAccountToken = %+v, %v", token, err)
+	}
+	_, err = s.UseAccountToken(ctx, database.AccountTokenPasswordReset, "reset-1")
+	wantErr(t, "UseAccountToken twice", err, database.ErrNotFound)
+	// Using one token spends the others of its purpose, but no others.
+	_, err = s.UseAccountToken(ctx, database.AccountTokenPasswordReset, "reset-2")
+	wantErr(t, "UseAccountToken for a token spent with another", err, database.ErrNotFound)
+	if _, err := s.UseAccountToken(ctx, database.AccountTokenEmailVerification, "verify-1"); err != nil {
+		t.Fatalf("UseAccountToken for another purpose's token: %v", err)
+	}
+}
+
+func testIdentities(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "a@example.com")
+
+	_, err := s.GetUserByIdentity(ctx, "https://idp.example.com", "sub-1")
+	wantErr(t, "GetUserByIdentity before linking", err, database.ErrNotFound)
+
+	if err := s.LinkUserIdentity(ctx, user.ID, "https://idp.example.com", "sub-1"); err != nil {
+		t.Fatalf("LinkUserIdentity: %v", err)
+	}
+	wantErr(t, "LinkUserIdentity twice", s.LinkUserIdentity(ctx, user.ID, "https://idp.example.com", "sub-1"), database.ErrConflict)
+
+	got, err := s.GetUserByIdentity(ctx, "https://idp.example.com", "sub-1")
+	if err != nil || got.ID != user.ID {
+		t.Fatalf("GetUserByIdentity = %v, %v", got, err)
+	}
+	// The same subject at another issuer is another account.
+	_, err = s.GetUserByIdentity(ctx, "https://other.example.com", "sub-1")
+	wantErr(t, "GetUserByIdentity at another issuer", err, database.ErrNotFound)
+}
+
+func testVideoShares(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "a@example.com")
+	video := createVideo(t, s, user.ID, "shared", database.VideoVisibilityPrivate)
+
+	maxViews := 1
+	share, err := s.CreateVideoShare(ctx, database.CreateVideoShareParams{VideoID: video.ID, TokenHash: "share-hash", MaxViews: &maxViews})
+	if err != nil {
+		t.Fatalf("CreateVideoShare: %v", err)
+	}
+	got, err := s.GetVideoShareByTokenHash(ctx, "share-hash")
+	if err != nil || got.ID != share.ID {
+		t.Fatalf("GetVideoShareByTokenHash = %+v, %v", got, err)
+	}
+
+	if err := s.RecordVideoShareView(ctx, share.ID, time.Now()); err != nil {
+		t.Fatalf("RecordVideoShareView: %v", err)
+	}
+	wantErr(t, "RecordVideoShareView past max_views", s.RecordVideoShareView(ctx, share.ID, time.Now()), database.ErrNotFound)
+
+	if err := s.RevokeVideoShare(ctx, video.ID, share.ID); err != nil {
+		t.Fatalf("RevokeVideoShare: %v", err)
+	}
+	wantErr(t, "RevokeVideoShare on another video", s.RevokeVideoShare(ctx, uuid.New(), share.ID), database.ErrNotFound)
+	shares, err := s.GetVideoShares(ctx, video.ID)
+	if err != nil || len(shares) != 1 || shares[0].RevokedAt == nil {
+		t.Fatalf("GetVideoShares = %+v, %v", shares, err)
+	}
+
+	// Concurrent views never take a share past max_views.
+	maxViews = 3
+	limited, err := s.CreateVideoShare(ctx, database.CreateVideoShareParams{VideoID: video.ID, TokenHash: "limited-hash", MaxViews: &maxViews})
+	if err != nil {
+		t.Fatalf("CreateVideoShare: %v", err)
+	}
+	errs := make(chan error, 10)
+	for range cap(errs) {
+		go func() { errs <- s.RecordVideoShareView(ctx, limited.ID, time.Now()) }()
+	}
+	views := 0
+	for range cap(errs) {
+		err := <-errs
+		if err == nil {
+			views++
+		} else if !errors.Is(err, database.ErrNotFound) {
+			t.Fatalf("concurrent RecordVideoShareView: %v", err)
+		}
+	}
+	if views != maxViews {
+		t.Fatalf("%d concurrent views were recorded, want %d", views, maxViews)
+	}
+	limited, err = s.GetVideoShareByTokenHash(ctx, "limited-hash")
+	if err != nil || limited.ViewCount != maxViews {
+		t.Fatalf("GetVideoShareByTokenHash = %+v, %v; want %d views", limited, err, maxViews)
+	}
+
+	// Nor past its expiry.
+	past := time.Now().Add(-time.Minute)
+	expired, err := s.CreateVideoShare(ctx, database.CreateVideoShareParams{VideoID: video.ID, TokenHash: "expired-hash", ExpiresAt: &past})
+	if err != nil {
+		t.Fatalf("CreateVideoShare: %v", err)
+	}
+	wantErr(t, "RecordVideoShareView after expiry", s.RecordVideoShareView(ctx, expired.ID, time.Now()), database.ErrNotFound)
+}
+
+func testCollaborators(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	owner := createUser(t, s, "owner@example.com")
+	editor := createUser(t, s, "editor@example.com")
+	video := createVideo(t, s, owner.ID, "team video", database.VideoVisibilityPrivate)
+
+	if _, err := s.SetVideoCollaborator(ctx, video.ID, editor.ID, database.VideoRoleViewer); err != nil {
+		t.Fatalf("SetVideoCollaborator: %v", err)
+	}
+	// Setting a role again replaces it.
+	if _, err := s.SetVideoCollaborator(ctx, video.ID, editor.ID, database.VideoRoleEditor); err != nil {
+		t.Fatalf("SetVideoCollaborator again: %v", err)
+	}
+	got, err := s.GetVideoCollaborator(ctx, video.ID, editor.ID)
+	if err != nil || got.Role != database.VideoRoleEditor || got.Email != "editor@example.com" {
+		t.Fatalf("GetVideoCollaborator = %+v, %v", got, err)
+	}
+	all, err := s.GetVideoCollaborators(ctx, video.ID)
+	if err != nil || len(all) != 1 {
+		t.Fatalf("GetVideoCollaborators = %+v, %v", all, err)
+	}
+
+	shared, err := s.ListVideos(ctx, database.ListVideosParams{SharedWith: editor.ID})
+	if err != nil || len(shared.Videos) != 1 || shared.Videos[0].ID != video.ID {
+		t.Fatalf("ListVideos shared with the editor = %+v, %v", shared.Videos, err)
+	}
+
+	if err := s.DeleteVideoCollaborator(ctx, video.ID, editor.ID); err != nil {
+		t.Fatalf("DeleteVideoCollaborator: %v", err)
+	}
+	_, err = s.GetVideoCollaborator(ctx, video.ID, editor.ID)
+	wantErr(t, "GetVideoCollaborator after delete", err, database.ErrNotFound)
+	wantErr(t, "DeleteVideoCollaborator twice", s.DeleteVideoCollaborator(ctx, video.ID, editor.ID), database.ErrNotFound)
+}
+
+func testPlaylists(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "a@example.com")
+	a := createVideo(t, s, user.ID, "a", database.VideoVisibilityPublic)
+	b := createVideo(t, s, user.ID, "b", database.VideoVisibilityPublic)
+	c := createVideo(t, s, user.ID, "c", database.VideoVisibilityPublic)
+
+	playlist, err := s.CreatePlaylist(ctx, database.CreatePlaylistParams{UserID: user.ID, Title: "mix"})
+	if err != nil {
+		t.Fatalf("CreatePlaylist: %v", err)
+	}
+	if playlist.Visibility != database.VideoVisibilityPrivate {
+		t.Fatalf("CreatePlaylist visibility = %q, want private", playlist.Visibility)
+	}
+	for _, v := range []database.Video{a, b, c} {
+		if err := s.AddPlaylistVideo(ctx, playlist.ID, v.ID); err != nil {
+			t.Fatalf("AddPlaylistVideo(%q): %v", v.Title, err)
+		}
+	}
+	wantErr(t, "AddPlaylistVideo twice", s.AddPlaylistVideo(ctx, playlist.ID, a.ID), database.ErrConflict)
+
+	wantErr(t, "ReorderPlaylistVideos missing a video", s.ReorderPlaylistVideos(ctx, playlist.ID, []uuid.UUID{c.ID, a.ID}), database.ErrInvalidPlaylistOrder)
+	if err := s.ReorderPlaylistVideos(ctx, playlist.ID, []uuid.UUID{c.ID, a.ID, b.ID}); err != nil {
+		t.Fatalf("ReorderPlaylistVideos: %v", err)
+	}
+	videos, err := s.GetPlaylistVideos(ctx, playlist.ID)
+	if err != nil {
+		t.Fatalf("GetPlaylistVideos: %v", err)
+	}
+	if len(videos) != 3 || videos[0].ID != c.ID || videos[1].ID != a.ID || videos[2].ID != b.ID {
+		t.Fatalf("GetPlaylistVideos order = %v", titles(videos))
+	}
+
+	if err := s.RemovePlaylistVideo(ctx, playlist.ID, a.ID); err != nil {
+		t.Fatalf("RemovePlaylistVideo: %v", err)
+	}
+	wantErr(t, "RemovePlaylistVideo twice", s.RemovePlaylistVideo(ctx, playlist.ID, a.ID), database.ErrNotFound)
+
+	playlist.Title = "renamed"
+	playlist.Visibility = database.VideoVisibilityPublic
+	updated, err := s.UpdatePlaylist(ctx, playlist)
+	if err != nil || updated.Title != "renamed" || updated.Visibility != database.VideoVisibilityPublic {
+		t.Fatalf("UpdatePlaylist = %+v, %v", updated, err)
+	}
+	lists, err := s.GetPlaylists(ctx, user.ID)
+	if err != nil || len(lists) != 1 {
+		t.Fatalf("GetPlaylists = %+v, %v", lists, err)
+	}
+
+	if err := s.DeletePlaylist(ctx, playlist.ID); err != nil {
+		t.Fatalf("DeletePlaylist: %v", err)
+	}
+	_, err = s.GetPlaylist(ctx, playlist.ID)
+	wantErr(t, "GetPlaylist after delete", err, database.ErrNotFound)
+}
+
+func testPlaylistCovers(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "a@example.com")
+	withThumbnail := func(title, visibility string) database.Video {
+		t.Helper()
+		video := createVideo(t, s, user.ID, title, visibility)
+		url := "https://example.com/" + title + ".png"
+		video.ThumbnailURL = &url
+		video, err := s.UpdateVideo(ctx, video)
+		if err != nil {
+			t.Fatalf("UpdateVideo(%q): %v", title, err)
+		}
+		return video
+	}
+	hidden := withThumbnail("hidden", database.VideoVisibilityPrivate)
+	shown := withThumbnail("shown", database.VideoVisibilityUnlisted)
+
+	playlist, err := s.CreatePlaylist(ctx, database.CreatePlaylistParams{UserID: user.ID, Title: "mix", Visibility: database.VideoVisibilityPublic})
+	if err != nil {
+		t.Fatalf("CreatePlaylist: %v", err)
+	}
+	get := func() database.Playlist {
+		t.Helper()
+		playlist, err := s.GetPlaylist(ctx, playlist.ID)
+		if err != nil {
+			t.Fatalf("GetPlaylist: %v", err)
+		}
+		return playlist
+	}
+	cover := func() *string {
+		t.Helper()
+		return get().CoverThumbnailURL
+	}
+
+	if err := s.AddPlaylistVideo(ctx, playlist.ID, hidden.ID); err != nil {
+		t.Fatalf("AddPlaylistVideo: %v", err)
+	}
+	if got := get(); got.CoverThumbnailURL != nil || got.VideoCount != 0 {
+		t.Fatalf("playlist of private videos = %+v, want no cover and no videos counted", got)
+	}
+
+	if err := s.AddPlaylistVideo(ctx, playlist.ID, shown.ID); err != nil {
+		t.Fatalf("AddPlaylistVideo: %v", err)
+	}
+	if got := cover(); got == nil || *got != *shown.ThumbnailURL {
+		t.Fatalf("cover falls back to %v, want the first video that isn't private", got)
+	}
+	if got := get().VideoCount; got != 1 {
+		t.Fatalf("VideoCount = %d, want only the video that isn't private", got)
+	}
+
+	playlist.CoverVideoID = &hidden.ID
+	if _, err := s.UpdatePlaylist(ctx, playlist); err != nil {
+		t.Fatalf("UpdatePlaylist: %v", err)
+	}
+	if got := cover(); got == nil || *got != *shown.ThumbnailURL {
+		t.Fatalf("cover with a private cover video = %v, want the fallback", got)
+	}
+
+	hidden.Visibility = database.VideoVisibilityPublic
+	if _, err := s.UpdateVideo(ctx, hidden); err != nil {
+		t.Fatalf("UpdateVideo: %v", err)
+	}
+	if got := cover(); got == nil || *got != *hidden.ThumbnailURL {
+		t.Fatalf("cover = %v, want the cover video's once it is public", got)
+	}
+	playlists, err := s.GetPlaylists(ctx, user.ID)
+	if err != nil || len(playlists) != 1 || playlists[0].VideoCount != 2 {
+		t.Fatalf("GetPlaylists = %+v, %v; want the playlist counting both videos once both are visible", playlists, err)
+	}
+}
+
+func titles(videos []database.Video) []string {
+	var out []string
+	for _, v := range videos {
+		out = append(out, v.Title)
+	}
+	return out
+}
+
+func testPlaybackAnalytics(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "a@example.com")
+	video := createVideo(t, s, user.ID, "Watched", database.VideoVisibilityPublic)
+	day1 := time.Date(2025, 3, 1, 23, 0, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Hour)
+	record := func(session, viewer string, percent int, at time.Time) {
+		t.Helper()
+		err := s.RecordPlaybackEvent(ctx, database.PlaybackEvent{VideoID: video.ID, SessionID: session, ViewerHash: viewer, Percent: percent, At: at})
+		if err != nil {
+			t.Fatalf("RecordPlaybackEvent(%s, %d): %v", session, percent, err)
+		}
+	}
+
+	// One session counts one view, and only progress past its furthest
+	// point, however many events it sends and in whatever order.
+	record("s1", "alice", 0, day1)
+	record("s1", "alice", 50, day1)
+	record("s1", "alice", 25, day1)
+	record("s1", "alice", 50, day1)
+	record("s1", "alice", 100, day1)
+	record("s1", "alice", 100, day1)
+	// A second session from the same viewer is a view but not a new viewer.
+	record("s2", "alice", 25, day1)
+	// Sessions count on the day they started, even if they finish later.
+	record("s3", "bob", 0, day1)
+	record("s3", "bob", 75, day2)
+	record("s4", "bob", 0, day2)
+	record("s5", "carol", 100, day2)
+
+	got, err := s.GetVideoAnalytics(ctx, video.ID, day1, day2)
+	if err != nil {
+		t.Fatalf("GetVideoAnalytics: %v", err)
+	}
+	want := database.VideoAnalytics{
+		Views:             5,
+		UniqueViewers:     3,
+		Completions:       2,
+		WatchPercentTotal: 100 + 25 + 75 + 0 + 100,
+		Daily: []database.VideoDailyStats{
+			{Day: database.AnalyticsDay(day1), Views: 3, UniqueViewers: 2, Completions: 1, WatchPercentTotal: 100 + 25 + 75},
+			{Day: database.AnalyticsDay(day2), Views: 2, UniqueViewers: 2, Completions: 1, WatchPercentTotal: 100},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetVideoAnalytics =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// Unique viewers over a range count each viewer once, not once a day.
+	got, err = s.GetVideoAnalytics(ctx, video.ID, day2, day2.AddDate(0, 0, 7))
+	if err != nil || got.Views != 2 || got.UniqueViewers != 2 || len(got.Daily) != 1 {
+		t.Fatalf("GetVideoAnalytics of day 2 = %+v, %v", got, err)
+	}
+	got, err = s.GetVideoAnalytics(ctx, video.ID, day1.AddDate(0, 0, -7), day1.AddDate(0, 0, -1))
+	if err != nil || got.Views != 0 || got.UniqueViewers != 0 || len(got.Daily) != 0 {
+		t.Fatalf("GetVideoAnalytics before any views = %+v, %v", got, err)
+	}
+
+	// Stats go with the video.
+	if err := s.DeleteVideo(ctx, video.ID); err != nil {
+		t.Fatalf("DeleteVideo: %v", err)
+	}
+	got, err = s.GetVideoAnalytics(ctx, video.ID, day1, day2)
+	if err != nil || got.Views != 0 || got.UniqueViewers != 0 {
+		t.Fatalf("GetVideoAnalytics after delete = %+v, %v", got, err)
+	}
+}
+
+func testPlaybackSessionLimit(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "a@example.com")
+	video := createVideo(t, s, user.ID, "Replayed", database.VideoVisibilityPublic)
+	day := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	record := func(session, viewer string, percent int, at time.Time) error {
+		return s.RecordPlaybackEvent(ctx, database.PlaybackEvent{VideoID: video.ID, SessionID: session, ViewerHash: viewer, Percent: percent, At: at})
+	}
+
+	for i := range database.MaxDailySessionsPerViewer {
+		if err := record(fmt.Sprintf("s%d", i), "spammer", 0, day); err != nil {
+			t.Fatalf("session %d: %v", i, err)
+		}
+	}
+	wantErr(t, "a session over the limit", record("one-more", "spammer", 0, day), database.ErrTooManyPlaybackSessions)
+	// Sessions already started still count their progress, other viewers
+	// aren't limited, and the limit starts over the next day.
+	if err := record("s0", "spammer", 100, day); err != nil {
+		t.Fatalf("progress of a started session: %v", err)
+	}
+	if err := record("other", "viewer", 0, day); err != nil {
+		t.Fatalf("another viewer's session: %v", err)
+	}
+	if err := record("tomorrow", "spammer", 0, day.AddDate(0, 0, 1)); err != nil {
+		t.Fatalf("a session the next day: %v", err)
+	}
+
+	got, err := s.GetVideoAnalytics(ctx, video.ID, day, day)
+	if err != nil {
+		t.Fatalf("GetVideoAnalytics: %v", err)
+	}
+	if got.Views != database.MaxDailySessionsPerViewer+1 || got.UniqueViewers != 2 || got.Completions != 1 {
+		t.Fatalf("GetVideoAnalytics = %+v, want the refused session left out", got)
+	}
+}
+
+func testWebhookDeliveries(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "a@example.com")
+	webhook, err := s.CreateWebhook(ctx, database.CreateWebhookParams{UserID: user.ID, URL: "https://example.com/hook", Events: []string{"video.created"}, Secret: "secret"})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	enqueue := func(n int) {
+		t.Helper()
+		for i := range n {
+			if err := s.EnqueueWebhookEvent(ctx, user.ID, "video.created", []byte(fmt.Sprintf(`{"n":%d}`, i))); err != nil {
+				t.Fatalf("EnqueueWebhookEvent: %v", err)
+			}
+		}
+	}
+	claim := func(limit int, lease time.Duration) []database.WebhookDelivery {
+		t.Helper()
+		deliveries, err := s.ClaimDueWebhookDeliveries(ctx, limit, lease)
+		if err != nil {
+			t.Fatalf("ClaimDueWebhookDeliveries: %v", err)
+		}
+		return deliveries
+	}
+
+	// Claims take the oldest due deliveries, and what one claim took isn't
+	// due for the next.
+	enqueue(3)
+	first := claim(2, time.Hour)
+	if len(first) != 2 || string(first[0].Payload) != `{"n":0}` || string(first[1].Payload) != `{"n":1}` {
+		t.Fatalf("first claim = %+v, want the two oldest deliveries", first)
+	}
+	if first[0].NextAttemptAt == nil || first[0].NextAttemptAt.Before(time.Now().Add(59*time.Minute)) {
+		t.Fatalf("claimed delivery's next attempt = %v, want an hour away", first[0].NextAttemptAt)
+	}
+	if second := claim(2, time.Hour); len(second) != 1 || string(second[0].Payload) != `{"n":2}` {
+		t.Fatalf("second claim = %+v, want the one left", second)
+	}
+	if third := claim(2, time.Hour); len(third) != 0 {
+		t.Fatalf("third claim = %+v, want none", third)
+	}
+
+	// Recording the attempt replaces the lease. Failed and delivered
+	// deliveries are never claimed.
+	past := time.Now().Add(-time.Second)
+	if err := s.RetryWebhookDelivery(ctx, first[0].ID, nil, "unreachable", &past); err != nil {
+		t.Fatalf("RetryWebhookDelivery: %v", err)
+	}
+	if err := s.RetryWebhookDelivery(ctx, first[1].ID, nil, "unreachable", nil); err != nil {
+		t.Fatalf("RetryWebhookDelivery giving up: %v", err)
+	}
+	retried := claim(10, 0)
+	if len(retried) != 1 || retried[0].ID != first[0].ID || retried[0].Attempts != 1 {
+		t.Fatalf("claim after a retry = %+v, want the retried delivery", retried)
+	}
+	// A lease that has run out, as when the claimer died, makes the
+	// delivery due again.
+	if again := claim(10, time.Hour); len(again) != 1 || again[0].ID != first[0].ID {
+		t.Fatalf("claim after the lease ran out = %+v, want the delivery again", again)
+	}
+	if err := s.CompleteWebhookDelivery(ctx, first[0].ID, 200); err != nil {
+		t.Fatalf("CompleteWebhookDelivery: %v", err)
+	}
+
+	// Concurrent claims never hand out the same delivery twice.
+	const pending = 10
+	enqueue(pending)
+	claims := make(chan []database.WebhookDelivery, 5)
+	errs := make(chan error, cap(claims))
+	for range cap(claims) {
+		go func() {
+			deliveries, err := s.ClaimDueWebhookDeliveries(ctx, 3, time.Hour)
+			claims <- deliveries
+			errs <- err
+		}()
+	}
+	claimed := map[uuid.UUID]bool{}
+	for range cap(claims) {
+		if err := <-errs; err != nil {
+			t.Fatalf("concurrent ClaimDueWebhookDeliveries: %v", err)
+		}
+		for _, delivery := range <-claims {
+			if claimed[delivery.ID] {
+				t.Fatalf("delivery %s was claimed twice", delivery.ID)
+			}
+			claimed[delivery.ID] = true
+		}
+	}
+	for _, delivery := range claim(pending, time.Hour) {
+		if claimed[delivery.ID] {
+			t.Fatalf("delivery %s was claimed twice", delivery.ID)
+		}
+		claimed[delivery.ID] = true
+	}
+	if len(claimed) != pending {
+		t.Fatalf("%d deliveries were claimed, want %d", len(claimed), pending)
+	}
+
+	deliveries, err := s.GetWebhookDeliveries(ctx, webhook.ID, 100)
+	if err != nil || len(deliveries) != 3+pending {
+		t.Fatalf("GetWebhookDeliveries = %d deliveries, %v", len(deliveries), err)
+	}
+}
+
+func testWithTx(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	errRollback := errors.New("roll back")
+
+	err := s.WithTx(ctx, func(tx database.Store) error {
+		if _, err := tx.CreateUser(ctx, database.CreateUserParams{Email: "rolled@example.com", Password: "x"}); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	wantErr(t, "WithTx", err, errRollback)
+	_, err = s.GetUserByEmail(ctx, "rolled@example.com")
+	wantErr(t, "GetUserByEmail after a rolled back WithTx", err, database.ErrNotFound)
+
+	err = s.WithTx(ctx, func(tx database.Store) error {
+		user, err := tx.CreateUser(ctx, database.CreateUserParams{Email: "kept@example.com", Password: "x"})
+		if err != nil {
+			return err
+		}
+		// Writes are visible inside the transaction.
+		_, err = tx.GetUser(ctx, user.ID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if _, err := s.GetUserByEmail(ctx, "kept@example.com"); err != nil {
+		t.Fatalf("GetUserByEmail after a committed WithTx: %v", err)
+	}
+}
+
+func testDeleteUser(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "a@example.com")
+	video := createVideo(t, s, user.ID, "gone", database.VideoVisibilityPrivate)
+	if _, err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{TokenHash: "rt", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+	if err := s.LinkUserIdentity(ctx, user.ID, "https://idp.example.com", "sub"); err != nil {
+		t.Fatalf("LinkUserIdentity: %v", err)
+	}
+
+	if err := s.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	wantErr(t, "DeleteUser twice", s.DeleteUser(ctx, user.ID), database.ErrNotFound)
+	_, err := s.GetVideo(ctx, video.ID)
+	wantErr(t, "GetVideo after its owner was deleted", err, database.ErrNotFound)
+	_, err = s.GetRefreshToken(ctx, "rt")
+	wantErr(t, "GetRefreshToken after its user was deleted", err, database.ErrNotFound)
+	_, err = s.GetUserByIdentity(ctx, "https://idp.example.com", "sub")
+	wantErr(t, "GetUserByIdentity after its user was deleted", err, database.ErrNotFound)
+	// The email can be used again.
+	createUser(t, s, "a@example.com")
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultTagPageSize = 10
+	MaxTagPageSize     = 50
+)
+
+// Tag is one of a user's tags with the number of their videos that carry it.
+type Tag struct {
+	Name       string `json:"name"`
+	VideoCount int    `json:"video_count"`
+}
+
+// NormalizeTag lowercases a tag and collapses its whitespace, so "Road  Trip"
+// and "road trip" are the same tag.
+func NormalizeTag(tag string) string {
+	return strings.Join(strings.Fields(strings.ToLower(tag)), " ")
+}
+
+// NormalizeTags normalizes every tag, then drops empty and duplicate ones.
+// The result is sorted.
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag = NormalizeTag(tag); tag != "" {
+			normalized = append(normalized, tag)
+		}
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// ListTagsParams selects a user's tags for autocomplete.
+type ListTagsParams struct {
+	UserID uuid.UUID
+	// Prefix is normalized like a tag before matching.
+	Prefix string
+	// Limit is clamped to MaxTagPageSize and defaults to DefaultTagPageSize.
+	Limit int
+}
+
+// Normalize fills in defaults, clamps the page size and normalizes the prefix.
+func (p ListTagsParams) Normalize() ListTagsParams {
+	if p.Limit <= 0 {
+		p.Limit = DefaultTagPageSize
+	}
+	if p.Limit > MaxTagPageSize {
+		p.Limit = MaxTagPageSize
+	}
+	p.Prefix = NormalizeTag(p.Prefix)
+	return p
+}
+
+// ListTags returns the tags on a user's videos that start with the prefix,
+// most used first. Tags no video carries any more are left out.
+func (c Client) ListTags(ctx context.Context, params ListTagsParams) ([]Tag, error) {
+	params = params.Normalize()
+	query := `
+	SELECT t.name, COUNT(*) AS video_count
+	FROM tags t
+	JOIN video_tags vt ON vt.tag_id = t.id
+	WHERE t.user_id = ? AND t.name LIKE ? ESCAPE '\'
+	GROUP BY t.name
+	ORDER BY video_count DESC, t.name
+	LIMIT ?
+	`
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(params.Prefix) + "%"
+	rows, err := c.db.QueryContext(ctx, query, params.UserID, pattern, params.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.Name, &tag.VideoCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// setVideoTags replaces a video's tags. Tags belong to the video's owner, so
+// userID must be the owner's ID. Tags left on no video are deleted, and the
+// video's search_tags are rewritten so search finds it by its new tags.
+func (c Client) setVideoTags(ctx context.Context, videoID, userID uuid.UUID, names []string) error {
+	names = NormalizeTags(names)
+	return c.inTx(ctx, func(tx Client) error {
+		if _, err := tx.db.ExecContext(ctx, `DELETE FROM video_tags WHERE video_id = ?`, videoID); err != nil {
+			return err
+		}
+		_, err := tx.db.ExecContext(ctx, `UPDATE videos SET search_tags = ? WHERE id = ?`, strings.Join(names, " "), videoID)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			_, err := tx.db.ExecContext(ctx, `
+			INSERT INTO tags (id, user_id, name, created_at)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT (user_id, name) DO NOTHING
+			`, uuid.New(), userID, name, now())
+			if err != nil {
+				return err
+			}
+			var tagID uuid.UUID
+			err = tx.db.QueryRowContext(ctx, `SELECT id FROM tags WHERE user_id = ? AND name = ?`, userID, name).Scan(&tagID)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.db.ExecContext(ctx, `INSERT INTO video_tags (video_id, tag_id) VALUES (?, ?)`, videoID, tagID); err != nil {
+				return translateError(err)
+			}
+		}
+
+		_, err = tx.db.ExecContext(ctx, `
+		DELETE FROM tags
+		WHERE user_id = ?
+			AND NOT EXISTS (SELECT 1 FROM video_tags vt WHERE vt.tag_id = tags.id)
+		`, userID)
+		return err
+	})
+}
+
+// attachTags loads the tags of each video, sorted by name.
+func (c Client) attachTags(ctx context.Context, videos ...*Video) error {
+	if len(videos) == 0 {
+		return nil
+	}
+	byID := make(map[uuid.UUID]*Video, len(videos))
+	args := make([]any, 0, len(videos))
+	for _, video := range videos {
+		video.Tags = []string{}
+		byID[video.ID] = video
+		args = append(args, video.ID)
+	}
+
+	query := `
+	SELECT vt.video_id, t.name
+	FROM video_tags vt
+	JOIN tags t ON t.id = vt.tag_id
+	WHERE vt.video_id IN (?` + strings.Repeat(", ?", len(args)-1) + `)
+	ORDER BY t.name
+	`
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var videoID uuid.UUID
+		var name string
+		if err := rows.Scan(&videoID, &name); err != nil {
+			return err
+		}
+		video := byID[videoID]
+		video.Tags = append(video.Tags, name)
+	}
+	return rows.Err()
+}
+
+// attachTagsToAll is attachTags for a slice of videos.
+func (c Client) attachTagsToAll(ctx context.Context, videos []Video) error {
+	ptrs := make([]*Video, len(videos))
+	for i := range videos {
+		ptrs[i] = &videos[i]
+	}
+	return c.attachTags(ctx, ptrs...)
+}
@@ -1,8 +1,7 @@
 package database
 
 import (
-	"database/sql"
-	"errors"
+	"context"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,15 +11,22 @@ type User struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// EmailVerifiedAt is nil until the user confirms their email address.
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
 	CreateUserParams
 }
 
+// EmailVerified reports whether the user has confirmed their email address.
+func (u User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
 type CreateUserParams struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
-func (c Client) GetUsers() ([]User, error) {
+func (c Client) GetUsers(ctx context.Context) ([]User, error) {
 	query := `
 		SELECT
 			id,
@@ -28,7 +34,7 @@ func (c Client) GetUsers() ([]User, error) {
 		FROM users
 	`
 
-	rows, err := c.db.Query(query)
+	rows, err := c.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -48,23 +54,21 @@ func (c Client) GetUsers() ([]User, error) {
 		users = append(users, user)
 	}
 
-	return users, nil
+	return users, rows.Err()
 }
 
-func (c Client) GetUserByEmail(email string) (User, error) {
+// GetUserByEmail looks a user up by email address, ignoring case.
+func (c Client) GetUserByEmail(ctx context.Context, email string) (User, error) {
 	query := `
-		SELECT id, created_at, updated_at, email, password
+		SELECT id, created_at, updated_at, email, password, email_verified_at
 		FROM users
-		WHERE email = ?
+		WHERE lower(email) = lower(?)
 	`
 	var user User
 	var id string
-	err := c.db.QueryRow(query, email).Scan(&id, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
+	err := c.db.QueryRowContext(ctx, query, email).Scan(&id, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password, &user.EmailVerifiedAt)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return User{}, nil
-		}
-		return User{}, err
+		return User{}, translateError(err)
 	}
 	user.ID, err = uuid.Parse(id)
 	if err != nil {
@@ -73,22 +77,19 @@ func (c Client) GetUserByEmail(email string) (User, error) {
 	return user, nil
 }
 
-func (c Client) GetUserByRefreshToken(token string) (*User, error) {
+func (c Client) GetUserByRefreshToken(ctx context.Context, tokenHash string) (*User, error) {
 	query := `
-		SELECT u.id, u.email, u.created_at, u.updated_at, u.password
+		SELECT u.id, u.email, u.created_at, u.updated_at, u.password, u.email_verified_at
 		FROM users u
 		JOIN refresh_tokens rt ON u.id = rt.user_id
-		WHERE rt.token = ?
+		WHERE rt.token_hash = ? AND rt.revoked_at IS NULL AND rt.expires_at > ?
 	`
 
 	var user User
 	var id string
-	err := c.db.QueryRow(query, token).Scan(&id, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.Password)
+	err := c.db.QueryRowContext(ctx, query, tokenHash, time.Now().UTC()).Scan(&id, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.Password, &user.EmailVerifiedAt)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
-		return nil, err
+		return nil, translateError(err)
 	}
 	user.ID, err = uuid.Parse(id)
 	if err != nil {
@@ -98,7 +99,7 @@ func (c Client) GetUserByRefreshToken(token string) (*User, error) {
 	return &user, nil
 }
 
-func (c Client) CreateUser(params CreateUserParams) (*User, error) {
+func (c Client) CreateUser(ctx context.Context, params CreateUserParams) (*User, error) {
 	id := uuid.New()
 
 	query := `
@@ -107,28 +108,32 @@ func (c Client) CreateUser(params CreateUserParams) (*User, error) {
 		VALUES
 		    (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
 	`
-	_, err := c.db.Exec(query, id.String(), params.Email, params.Password)
+	var user *User
+	err := c.inTx(ctx, func(tx Client) error {
+		if _, err := tx.db.ExecContext(ctx, query, id.String(), params.Email, params.Password); err != nil {
+			return translateError(err)
+		}
+		var err error
+		user, err = tx.GetUser(ctx, id)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	return c.GetUser(id)
+	return user, nil
 }
 
-func (c Client) GetUser(id uuid.UUID) (*User, error) {
+func (c Client) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
 	query := `
-		SELECT id, created_at, updated_at, email, password
+		SELECT id, created_at, updated_at, email, password, email_verified_at
 		FROM users
 		WHERE id = ?
 	`
 	var user User
 	var idStr string
-	err := c.db.QueryRow(query, id.String()).Scan(&idStr, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
+	err := c.db.QueryRowContext(ctx, query, id.String()).Scan(&idStr, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password, &user.EmailVerifiedAt)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
-		return nil, err
+		return nil, translateError(err)
 	}
 	user.ID, err = uuid.Parse(idStr)
 	if err != nil {
@@ -137,11 +142,50 @@ func (c Client) GetUser(id uuid.UUID) (*User, error) {
 	return &user, nil
 }
 
-func (c Client) DeleteUser(id uuid.UUID) error {
+// UpdateUserPassword replaces a user's password hash.
+func (c Client) UpdateUserPassword(ctx context.Context, id uuid.UUID, password string) error {
+	query := `
+		UPDATE users
+		SET password = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	res, err := c.db.ExecContext(ctx, query, password, id.String())
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// MarkEmailVerified records that a user confirmed their email address. A
+// user who already had keeps their original verification time.
+func (c Client) MarkEmailVerified(ctx context.Context, id uuid.UUID) error {
 	query := `
-		DELETE FROM users
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, ?), updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id.String())
-	return err
+	res, err := c.db.ExecContext(ctx, query, now(), id.String())
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// DeleteUser removes a user together with their refresh tokens in one transaction.
+func (c Client) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	return c.inTx(ctx, func(tx Client) error {
+		if _, err := tx.db.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE user_id = ?`, id.String()); err != nil {
+			return err
+		}
+
+		query := `
+			DELETE FROM users
+			WHERE id = ?
+		`
+		res, err := tx.db.ExecContext(ctx, query, id.String())
+		if err != nil {
+			return err
+		}
+		return requireAffected(res)
+	})
 }
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoRole is the access a user has to a video. Each role includes the
+// ones before it: viewers can watch, editors can also change metadata and
+// upload files, and owners can also delete the video and manage who has
+// access to it.
+type VideoRole string
+
+const (
+	VideoRoleViewer VideoRole = "viewer"
+	VideoRoleEditor VideoRole = "editor"
+	VideoRoleOwner  VideoRole = "owner"
+)
+
+func (r VideoRole) rank() int {
+	switch r {
+	case VideoRoleViewer:
+		return 1
+	case VideoRoleEditor:
+		return 2
+	case VideoRoleOwner:
+		return 3
+	}
+	return 0
+}
+
+// Valid reports whether r is a known role.
+func (r VideoRole) Valid() bool {
+	return r.rank() > 0
+}
+
+// Includes reports whether r grants everything other does. The empty role
+// includes nothing.
+func (r VideoRole) Includes(other VideoRole) bool {
+	return r.rank() > 0 && r.rank() >= other.rank()
+}
+
+// VideoCollaborator is a role on a video granted to a user other than the
+// one who created it.
+type VideoCollaborator struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	Role      VideoRole `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func scanVideoCollaborator(row rowScanner) (VideoCollaborator, error) {
+	var collaborator VideoCollaborator
+	err := row.Scan(
+		&collaborator.VideoID,
+		&collaborator.UserID,
+		&collaborator.Email,
+		&collaborator.Role,
+		&collaborator.CreatedAt,
+	)
+	return collaborator, err
+}
+
+func (c Client) GetVideoCollaborator(ctx context.Context, videoID, userID uuid.UUID) (VideoCollaborator, error) {
+	query := `
+	SELECT vc.video_id, vc.user_id, u.email, vc.role, vc.created_at
+	FROM video_collaborators vc
+	JOIN users u ON u.id = vc.user_id
+	WHERE vc.video_id = ? AND vc.user_id = ?
+	`
+	collaborator, err := scanVideoCollaborator(c.db.QueryRowContext(ctx, query, videoID, userID))
+	if err != nil {
+		return VideoCollaborator{}, translateError(err)
+	}
+	return collaborator, nil
+}
+
+func (c Client) GetVideoCollaborators(ctx context.Context, videoID uuid.UUID) ([]VideoCollaborator, error) {
+	query := `
+	SELECT vc.video_id, vc.user_id, u.email, vc.role, vc.created_at
+	FROM video_collaborators vc
+	JOIN users u ON u.id = vc.user_id
+	WHERE vc.video_id = ?
+	ORDER BY vc.created_at, u.email
+	`
+	rows, err := c.db.QueryContext(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collaborators := []VideoCollaborator{}
+	for rows.Next() {
+		collaborator, err := scanVideoCollaborator(rows)
+		if err != nil {
+			return nil, err
+		}
+		collaborators = append(collaborators, collaborator)
+	}
+	return collaborators, rows.Err()
+}
+
+// SetVideoCollaborator grants userID a role on a video, replacing any role
+// they already had.
+func (c Client) SetVideoCollaborator(ctx context.Context, videoID, userID uuid.UUID, role VideoRole) (VideoCollaborator, error) {
+	query := `
+	INSERT INTO video_collaborators (video_id, user_id, role, created_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT (video_id, user_id) DO UPDATE SET role = excluded.role
+	`
+	var collaborator VideoCollaborator
+	err := c.inTx(ctx, func(tx Client) error {
+		if _, err := tx.db.ExecContext(ctx, query, videoID, userID, role, now()); err != nil {
+			return translateError(err)
+		}
+		var err error
+		collaborator, err = tx.GetVideoCollaborator(ctx, videoID, userID)
+		return err
+	})
+	if err != nil {
+		return VideoCollaborator{}, err
+	}
+	return collaborator, nil
+}
+
+func (c Client) DeleteVideoCollaborator(ctx context.Context, videoID, userID uuid.UUID) error {
+	query := `
+	DELETE FROM video_collaborators
+	WHERE video_id = ? AND user_id = ?
+	`
+	res, err := c.db.ExecContext(ctx, query, videoID, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
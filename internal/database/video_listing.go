@@ -0,0 +1,318 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultVideoPageSize = 25
+	MaxVideoPageSize     = 100
+)
+
+// VideoSort is a key videos can be listed by.
+type VideoSort string
+
+const (
+	VideoSortCreated  VideoSort = "created"
+	VideoSortUpdated  VideoSort = "updated"
+	VideoSortTitle    VideoSort = "title"
+	VideoSortDuration VideoSort = "duration"
+)
+
+func (s VideoSort) column() (string, bool) {
+	switch s {
+	case VideoSortCreated:
+		return "created_at", true
+	case VideoSortUpdated:
+		return "updated_at", true
+	case VideoSortTitle:
+		return "title", true
+	case VideoSortDuration:
+		return "duration_seconds", true
+	}
+	return "", false
+}
+
+// Valid reports whether s is a supported sort key.
+func (s VideoSort) Valid() bool {
+	_, ok := s.column()
+	return ok
+}
+
+// ErrInvalidCursor is returned when a pagination cursor can't be decoded or
+// was issued for a different sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListVideosParams selects one page of videos. Zero-valued filters are
+// ignored, so a zero UserID lists every user's videos.
+type ListVideosParams struct {
+	UserID uuid.UUID
+	// SharedWith lists only the videos this user has been granted a role on.
+	SharedWith uuid.UUID
+	// Limit is clamped to MaxVideoPageSize and defaults to DefaultVideoPageSize.
+	Limit int
+	// After is the NextCursor of the previous page.
+	After     string
+	Sort      VideoSort
+	Ascending bool
+
+	Status        string
+	Visibility    string
+	HasVideo      *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	AspectRatio   string
+	// Tags lists only videos that carry every one of these tags.
+	Tags []string
+}
+
+// VideoPage is one page of a video listing. NextCursor is nil on the last page.
+type VideoPage struct {
+	Videos     []Video `json:"videos"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+// VideoCursor is the decoded form of an opaque pagination cursor. It holds
+// the sort key and ID of the last video on a page.
+type VideoCursor struct {
+	Sort      VideoSort  `json:"s"`
+	Ascending bool       `json:"a,omitempty"`
+	Time      *time.Time `json:"t,omitempty"`
+	Title     *string    `json:"n,omitempty"`
+	Duration  *float64   `json:"d,omitempty"`
+	ID        uuid.UUID  `json:"id"`
+}
+
+// NewVideoCursor returns the cursor that resumes a listing after video.
+func NewVideoCursor(video Video, sort VideoSort, ascending bool) VideoCursor {
+	cursor := VideoCursor{Sort: sort, Ascending: ascending, ID: video.ID}
+	switch sort {
+	case VideoSortCreated:
+		t := video.CreatedAt.UTC()
+		cursor.Time = &t
+	case VideoSortUpdated:
+		t := video.UpdatedAt.UTC()
+		cursor.Time = &t
+	case VideoSortTitle:
+		cursor.Title = &video.Title
+	case VideoSortDuration:
+		cursor.Duration = &video.DurationSeconds
+	}
+	return cursor
+}
+
+// Encode returns the opaque string form of the cursor.
+func (vc VideoCursor) Encode() string {
+	dat, _ := json.Marshal(vc)
+	return base64.RawURLEncoding.EncodeToString(dat)
+}
+
+// DecodeVideoCursor parses a cursor and checks it belongs to the given sort order.
+func DecodeVideoCursor(s string, sort VideoSort, ascending bool) (VideoCursor, error) {
+	dat, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return VideoCursor{}, ErrInvalidCursor
+	}
+	var vc VideoCursor
+	if err := json.Unmarshal(dat, &vc); err != nil {
+		return VideoCursor{}, ErrInvalidCursor
+	}
+	if vc.Sort != sort || vc.Ascending != ascending || vc.ID == uuid.Nil {
+		return VideoCursor{}, ErrInvalidCursor
+	}
+	if _, err := vc.value(); err != nil {
+		return VideoCursor{}, err
+	}
+	return vc, nil
+}
+
+// Video returns a placeholder video carrying only the cursor's sort key and
+// ID, for comparing against real rows with CompareVideos.
+func (vc VideoCursor) Video() Video {
+	video := Video{ID: vc.ID}
+	if vc.Time != nil {
+		video.CreatedAt = *vc.Time
+		video.UpdatedAt = *vc.Time
+	}
+	if vc.Title != nil {
+		video.Title = *vc.Title
+	}
+	if vc.Duration != nil {
+		video.DurationSeconds = *vc.Duration
+	}
+	return video
+}
+
+func (vc VideoCursor) value() (any, error) {
+	switch {
+	case (vc.Sort == VideoSortCreated || vc.Sort == VideoSortUpdated) && vc.Time != nil:
+		return vc.Time.UTC(), nil
+	case vc.Sort == VideoSortTitle && vc.Title != nil:
+		return *vc.Title, nil
+	case vc.Sort == VideoSortDuration && vc.Duration != nil:
+		return *vc.Duration, nil
+	}
+	return nil, ErrInvalidCursor
+}
+
+// CompareVideos orders two videos by the sort key, then by ID, ascending.
+// It defines the order ListVideos pages through.
+func CompareVideos(a, b Video, sort VideoSort) int {
+	var c int
+	switch sort {
+	case VideoSortCreated:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	case VideoSortUpdated:
+		c = a.UpdatedAt.Compare(b.UpdatedAt)
+	case VideoSortTitle:
+		c = strings.Compare(a.Title, b.Title)
+	case VideoSortDuration:
+		switch {
+		case a.DurationSeconds < b.DurationSeconds:
+			c = -1
+		case a.DurationSeconds > b.DurationSeconds:
+			c = 1
+		}
+	}
+	if c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID.String(), b.ID.String())
+}
+
+// Normalize fills in defaults and clamps the page size.
+func (p ListVideosParams) Normalize() ListVideosParams {
+	if p.Sort == "" {
+		p.Sort = VideoSortCreated
+	}
+	if p.Limit <= 0 {
+		p.Limit = DefaultVideoPageSize
+	}
+	if p.Limit > MaxVideoPageSize {
+		p.Limit = MaxVideoPageSize
+	}
+	return p
+}
+
+// ListVideos returns one page of videos using keyset pagination, so
+// each page costs the same no matter how deep into the listing it is.
+func (c Client) ListVideos(ctx context.Context, params ListVideosParams) (VideoPage, error) {
+	params = params.Normalize()
+	column, ok := params.Sort.column()
+	if !ok {
+		return VideoPage{}, fmt.Errorf("unknown sort %q", params.Sort)
+	}
+
+	var where []string
+	var args []any
+
+	if params.UserID != uuid.Nil {
+		where = append(where, "user_id = ?")
+		args = append(args, params.UserID)
+	}
+	if params.SharedWith != uuid.Nil {
+		where = append(where, "id IN (SELECT video_id FROM video_collaborators WHERE user_id = ?)")
+		args = append(args, params.SharedWith)
+	}
+	if params.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, params.Status)
+	}
+	if params.Visibility != "" {
+		where = append(where, "visibility = ?")
+		args = append(args, params.Visibility)
+	}
+	if params.HasVideo != nil {
+		if *params.HasVideo {
+			where = append(where, "video_url IS NOT NULL")
+		} else {
+			where = append(where, "video_url IS NULL")
+		}
+	}
+	if params.CreatedAfter != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, params.CreatedAfter.UTC())
+	}
+	if params.CreatedBefore != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, params.CreatedBefore.UTC())
+	}
+	if params.AspectRatio != "" {
+		where = append(where, "aspect_ratio = ?")
+		args = append(args, params.AspectRatio)
+	}
+	for _, tag := range NormalizeTags(params.Tags) {
+		where = append(where, "id IN (SELECT vt.video_id FROM video_tags vt JOIN tags t ON t.id = vt.tag_id WHERE t.name = ?)")
+		args = append(args, tag)
+	}
+
+	op, direction := "<", "DESC"
+	if params.Ascending {
+		op, direction = ">", "ASC"
+	}
+	if params.After != "" {
+		cursor, err := DecodeVideoCursor(params.After, params.Sort, params.Ascending)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		value, _ := cursor.value()
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, op))
+		args = append(args, value, value, cursor.ID)
+	}
+
+	whereClause := ""
+	if len(where) > 0 {
+		whereClause = "WHERE " + strings.Join(where, " AND ")
+	}
+	query := `
+	SELECT ` + videoColumns("") + `
+	FROM videos
+	` + whereClause + fmt.Sprintf(`
+	ORDER BY %[1]s %[2]s, id %[2]s
+	LIMIT ?
+	`, column, direction)
+	// Fetch one extra row to learn whether there is another page.
+	args = append(args, params.Limit+1)
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return VideoPage{}, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		videos = append(videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return VideoPage{}, err
+	}
+
+	page := newVideoPage(videos, params)
+	if err := c.attachTagsToAll(ctx, page.Videos); err != nil {
+		return VideoPage{}, err
+	}
+	return page, nil
+}
+
+func newVideoPage(videos []Video, params ListVideosParams) VideoPage {
+	page := VideoPage{Videos: videos}
+	if len(videos) > params.Limit {
+		page.Videos = videos[:params.Limit]
+		next := NewVideoCursor(page.Videos[params.Limit-1], params.Sort, params.Ascending).Encode()
+		page.NextCursor = &next
+	}
+	return page
+}
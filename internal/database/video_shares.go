@@ -0,0 +1,177 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoShare is a link that lets someone without an account watch one video.
+// Only a hash of the link's token is stored; the token itself is shown to the
+// owner once, when the share is created.
+type VideoShare struct {
+	ID           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	VideoID      uuid.UUID  `json:"video_id"`
+	TokenHash    string     `json:"-"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	MaxViews     *int       `json:"max_views"`
+	ViewCount    int        `json:"view_count"`
+	PasswordHash *string    `json:"-"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+}
+
+// Active reports whether the share can still be used at time t.
+func (s VideoShare) Active(t time.Time) bool {
+	if s.RevokedAt != nil {
+		return false
+	}
+	if s.ExpiresAt != nil && !t.Before(*s.ExpiresAt) {
+		return false
+	}
+	return s.MaxViews == nil || s.ViewCount < *s.MaxViews
+}
+
+type CreateVideoShareParams struct {
+	VideoID      uuid.UUID
+	TokenHash    string
+	ExpiresAt    *time.Time
+	MaxViews     *int
+	PasswordHash *string
+}
+
+const videoShareColumns = `id, created_at, video_id, token_hash, expires_at, max_views, view_count, password_hash, revoked_at`
+
+func scanVideoShare(row rowScanner) (VideoShare, error) {
+	var share VideoShare
+	err := row.Scan(
+		&share.ID,
+		&share.CreatedAt,
+		&share.VideoID,
+		&share.TokenHash,
+		&share.ExpiresAt,
+		&share.MaxViews,
+		&share.ViewCount,
+		&share.PasswordHash,
+		&share.RevokedAt,
+	)
+	return share, err
+}
+
+func (c Client) CreateVideoShare(ctx context.Context, params CreateVideoShareParams) (VideoShare, error) {
+	query := `
+	INSERT INTO video_shares (
+		id,
+		created_at,
+		video_id,
+		token_hash,
+		expires_at,
+		max_views,
+		password_hash
+	) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	var expiresAt *time.Time
+	if params.ExpiresAt != nil {
+		t := params.ExpiresAt.UTC().Truncate(time.Microsecond)
+		expiresAt = &t
+	}
+	share := VideoShare{
+		ID:           uuid.New(),
+		CreatedAt:    now(),
+		VideoID:      params.VideoID,
+		TokenHash:    params.TokenHash,
+		ExpiresAt:    expiresAt,
+		MaxViews:     params.MaxViews,
+		PasswordHash: params.PasswordHash,
+	}
+	_, err := c.db.ExecContext(
+		ctx,
+		query,
+		share.ID,
+		share.CreatedAt,
+		share.VideoID,
+		share.TokenHash,
+		share.ExpiresAt,
+		share.MaxViews,
+		share.PasswordHash,
+	)
+	if err != nil {
+		return VideoShare{}, translateError(err)
+	}
+	return share, nil
+}
+
+// GetVideoShares lists every share of a video, newest first, including
+// revoked and expired ones.
+func (c Client) GetVideoShares(ctx context.Context, videoID uuid.UUID) ([]VideoShare, error) {
+	query := `
+	SELECT ` + videoShareColumns + `
+	FROM video_shares
+	WHERE video_id = ?
+	ORDER BY created_at DESC, id
+	`
+	rows, err := c.db.QueryContext(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []VideoShare{}
+	for rows.Next() {
+		share, err := scanVideoShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+func (c Client) GetVideoShareByTokenHash(ctx context.Context, tokenHash string) (VideoShare, error) {
+	query := `
+	SELECT ` + videoShareColumns + `
+	FROM video_shares
+	WHERE token_hash = ?
+	`
+	share, err := scanVideoShare(c.db.QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		return VideoShare{}, translateError(err)
+	}
+	return share, nil
+}
+
+// RevokeVideoShare revokes one of a video's shares. Revoking a share twice
+// keeps the first revocation time.
+func (c Client) RevokeVideoShare(ctx context.Context, videoID, id uuid.UUID) error {
+	query := `
+	UPDATE video_shares
+	SET revoked_at = COALESCE(revoked_at, ?)
+	WHERE id = ? AND video_id = ?
+	`
+	res, err := c.db.ExecContext(ctx, query, now(), id, videoID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// RecordVideoShareView counts one view of a share. The check and the
+// increment are a single statement, so concurrent views can never push a
+// share past its max_views. It returns ErrNotFound if the share is no longer
+// active at time at.
+func (c Client) RecordVideoShareView(ctx context.Context, id uuid.UUID, at time.Time) error {
+	query := `
+	UPDATE video_shares
+	SET view_count = view_count + 1
+	WHERE id = ?
+		AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > ?)
+		AND (max_views IS NULL OR view_count < max_views)
+	`
+	res, err := c.db.ExecContext(ctx, query, id, at.UTC())
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
@@ -1,72 +1,115 @@
 package database
 
 import (
-	"database/sql"
+	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Video processing states.
+const (
+	VideoStatusDraft      = "draft"
+	VideoStatusProcessing = "processing"
+	VideoStatusReady      = "ready"
+	VideoStatusFailed     = "failed"
+)
+
+// Who can see a video. Private videos are visible to their owner only,
+// unlisted videos to anyone who has the ID, and public videos are also
+// included in the public listing.
+const (
+	VideoVisibilityPrivate  = "private"
+	VideoVisibilityUnlisted = "unlisted"
+	VideoVisibilityPublic   = "public"
+)
+
+// ValidVideoVisibility reports whether v is a known visibility level.
+func ValidVideoVisibility(v string) bool {
+	switch v {
+	case VideoVisibilityPrivate, VideoVisibilityUnlisted, VideoVisibilityPublic:
+		return true
+	}
+	return false
+}
+
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID              uuid.UUID `json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	ThumbnailURL    *string   `json:"thumbnail_url"`
+	VideoURL        *string   `json:"video_url"`
+	Status          string    `json:"status"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	AspectRatio     *string   `json:"aspect_ratio"`
 	CreateVideoParams
 }
 
 type CreateVideoParams struct {
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	UserID      uuid.UUID `json:"user_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Visibility defaults to VideoVisibilityPrivate.
+	Visibility string    `json:"visibility"`
+	UserID     uuid.UUID `json:"user_id"`
+	// Tags are normalized with NormalizeTags. UpdateVideo leaves a video's
+	// tags alone when Tags is nil.
+	Tags []string `json:"tags"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
-	FROM videos
-	WHERE user_id = ?
-	ORDER BY created_at DESC
-	`
+var videoColumnNames = []string{
+	"id",
+	"created_at",
+	"updated_at",
+	"title",
+	"description",
+	"thumbnail_url",
+	"video_url",
+	"status",
+	"duration_seconds",
+	"aspect_ratio",
+	"visibility",
+	"user_id",
+}
 
-	rows, err := c.db.Query(query, userID)
-	if err != nil {
-		return nil, err
+// videoColumns lists the columns scanVideo reads, qualified with alias if
+// one is given.
+func videoColumns(alias string) string {
+	if alias == "" {
+		return strings.Join(videoColumnNames, ", ")
 	}
-	defer rows.Close()
-
-	videos := []Video{}
-	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
-			return nil, err
-		}
-		videos = append(videos, video)
+	qualified := make([]string, len(videoColumnNames))
+	for i, name := range videoColumnNames {
+		qualified[i] = alias + "." + name
 	}
+	return strings.Join(qualified, ", ")
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
-	return videos, nil
+func scanVideo(row rowScanner) (Video, error) {
+	var video Video
+	err := row.Scan(
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.VideoURL,
+		&video.Status,
+		&video.DurationSeconds,
+		&video.AspectRatio,
+		&video.Visibility,
+		&video.UserID,
+	)
+	return video, err
 }
 
-func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
+func (c Client) CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error) {
 	id := uuid.New()
 	query := `
 	INSERT INTO videos (
@@ -75,81 +118,145 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		updated_at,
 		title,
 		description,
+		status,
+		visibility,
 		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	if params.Visibility == "" {
+		params.Visibility = VideoVisibilityPrivate
+	}
+	createdAt := now()
+	var video Video
+	err := c.inTx(ctx, func(tx Client) error {
+		_, err := tx.db.ExecContext(ctx, query, id, createdAt, createdAt, params.Title, params.Description, VideoStatusDraft, params.Visibility, params.UserID)
+		if err != nil {
+			return translateError(err)
+		}
+		if err := tx.setVideoTags(ctx, id, params.UserID, params.Tags); err != nil {
+			return err
+		}
+		video, err = tx.GetVideo(ctx, id)
+		return err
+	})
 	if err != nil {
 		return Video{}, err
 	}
-
-	return c.GetVideo(id)
+	return video, nil
 }
 
-func (c Client) GetVideo(id uuid.UUID) (Video, error) {
+func (c Client) GetVideo(ctx context.Context, id uuid.UUID) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT ` + videoColumns("") + `
 	FROM videos
 	WHERE id = ?
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRowContext(ctx, query, id))
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return Video{}, nil
-		}
+		return Video{}, translateError(err)
+	}
+	if err := c.attachTags(ctx, &video); err != nil {
 		return Video{}, err
 	}
 
 	return video, nil
 }
 
-func (c Client) UpdateVideo(video Video) error {
+// UpdateVideo writes every mutable field of video and stamps updated_at. It
+// returns the video as stored.
+func (c Client) UpdateVideo(ctx context.Context, video Video) (Video, error) {
+	return c.updateVideo(ctx, video, nil)
+}
+
+// UpdateVideoIfUnmodified is UpdateVideo guarded by optimistic concurrency:
+// the write only happens if the stored updated_at still equals
+// unmodifiedSince, and ErrStale is returned otherwise.
+func (c Client) UpdateVideoIfUnmodified(ctx context.Context, video Video, unmodifiedSince time.Time) (Video, error) {
+	return c.updateVideo(ctx, video, &unmodifiedSince)
+}
+
+func (c Client) updateVideo(ctx context.Context, video Video, unmodifiedSince *time.Time) (Video, error) {
 	query := `
 	UPDATE videos
 	SET
+		updated_at = ?,
 		title = ?,
 		description = ?,
 		thumbnail_url = ?,
 		video_url = ?,
+		status = ?,
+		duration_seconds = ?,
+		aspect_ratio = ?,
+		visibility = ?,
 		user_id = ?
 	WHERE id = ?
 	`
 
-	_, err := c.db.Exec(
-		query,
+	updatedAt := now()
+	args := []any{
+		updatedAt,
 		video.Title,
 		video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
+		video.ThumbnailURL,
+		video.VideoURL,
+		video.Status,
+		video.DurationSeconds,
+		video.AspectRatio,
+		video.Visibility,
 		video.UserID,
 		video.ID,
-	)
-	return err
+	}
+	if unmodifiedSince != nil {
+		query += "AND updated_at = ?\n"
+		args = append(args, unmodifiedSince.UTC())
+	}
+
+	var updated Video
+	err := c.inTx(ctx, func(tx Client) error {
+		res, err := tx.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return translateError(err)
+		}
+		err = requireAffected(res)
+		if errors.Is(err, ErrNotFound) && unmodifiedSince != nil {
+			// Tell a stale write apart from a missing video.
+			if _, err := tx.GetVideo(ctx, video.ID); err != nil {
+				return err
+			}
+			return ErrStale
+		}
+		if err != nil {
+			return err
+		}
+		if video.Tags != nil {
+			if err := tx.setVideoTags(ctx, video.ID, video.UserID, video.Tags); err != nil {
+				return err
+			}
+		}
+		updated, err = tx.GetVideo(ctx, video.ID)
+		return err
+	})
+	if err != nil {
+		return Video{}, err
+	}
+	return updated, nil
 }
 
-func (c Client) DeleteVideo(id uuid.UUID) error {
+func (c Client) DeleteVideo(ctx context.Context, id uuid.UUID) error {
 	query := `
 	DELETE FROM videos
 	WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id)
-	return err
+	res, err := c.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// now is the timestamp the application writes. It is truncated to the
+// microsecond precision Postgres keeps so values round-trip on every backend.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
 }
@@ -0,0 +1,336 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook delivery states. Pending deliveries are retried until they succeed
+// or run out of attempts and fail.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook is an endpoint a user wants events about their videos sent to.
+// Secret signs every delivery and is only shown when the webhook is created.
+type Webhook struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"-"`
+}
+
+type CreateWebhookParams struct {
+	UserID uuid.UUID
+	URL    string
+	Events []string
+	Secret string
+}
+
+// WebhookDelivery is one event queued for one webhook. Deliveries are kept
+// after they finish, so they double as the webhook's delivery log.
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	WebhookID      uuid.UUID       `json:"webhook_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      *string         `json:"last_error"`
+	// NextAttemptAt is nil once the delivery has succeeded or failed.
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+}
+
+const webhookDeliveryColumns = `id, created_at, webhook_id, event_type, payload, status, attempts, last_status_code, last_error, next_attempt_at, delivered_at`
+
+func scanWebhook(row rowScanner) (Webhook, error) {
+	var webhook Webhook
+	var events string
+	err := row.Scan(&webhook.ID, &webhook.CreatedAt, &webhook.UserID, &webhook.URL, &events, &webhook.Secret)
+	webhook.Events = strings.Split(events, ",")
+	return webhook, err
+}
+
+func scanWebhookDelivery(row rowScanner) (WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var payload string
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.CreatedAt,
+		&delivery.WebhookID,
+		&delivery.EventType,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.NextAttemptAt,
+		&delivery.DeliveredAt,
+	)
+	delivery.Payload = json.RawMessage(payload)
+	return delivery, err
+}
+
+func (c Client) CreateWebhook(ctx context.Context, params CreateWebhookParams) (Webhook, error) {
+	query := `
+	INSERT INTO webhooks (id, created_at, user_id, url, events, secret)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+	webhook := Webhook{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UserID:    params.UserID,
+		URL:       params.URL,
+		Events:    params.Events,
+		Secret:    params.Secret,
+	}
+	_, err := c.db.ExecContext(ctx, query, webhook.ID, webhook.CreatedAt, webhook.UserID, webhook.URL, strings.Join(webhook.Events, ","), webhook.Secret)
+	if err != nil {
+		return Webhook{}, translateError(err)
+	}
+	return webhook, nil
+}
+
+func (c Client) GetWebhook(ctx context.Context, id uuid.UUID) (Webhook, error) {
+	query := `
+	SELECT id, created_at, user_id, url, events, secret
+	FROM webhooks
+	WHERE id = ?
+	`
+	webhook, err := scanWebhook(c.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return Webhook{}, translateError(err)
+	}
+	return webhook, nil
+}
+
+// GetWebhooks lists a user's webhooks, oldest first.
+func (c Client) GetWebhooks(ctx context.Context, userID uuid.UUID) ([]Webhook, error) {
+	query := `
+	SELECT id, created_at, user_id, url, events, secret
+	FROM webhooks
+	WHERE user_id = ?
+	ORDER BY created_at, id
+	`
+	rows, err := c.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook removes a webhook and its delivery log.
+func (c Client) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	res, err := c.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// EnqueueWebhookEvent queues a delivery of payload to each of userID's
+// webhooks that subscribe to eventType. Call it in the same transaction as
+// the change the event describes, so events are never lost or invented.
+func (c Client) EnqueueWebhookEvent(ctx context.Context, userID uuid.UUID, eventType string, payload []byte) error {
+	query := `
+	INSERT INTO webhook_deliveries (id, created_at, webhook_id, event_type, payload, status, next_attempt_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	return c.inTx(ctx, func(tx Client) error {
+		webhooks, err := tx.GetWebhooks(ctx, userID)
+		if err != nil {
+			return err
+		}
+		createdAt := now()
+		for _, webhook := range webhooks {
+			if !slices.Contains(webhook.Events, eventType) {
+				continue
+			}
+			_, err := tx.db.ExecContext(ctx, query, uuid.New(), createdAt, webhook.ID, eventType, string(payload), WebhookDeliveryPending, createdAt)
+			if err != nil {
+				return translateError(err)
+			}
+		}
+		return nil
+	})
+}
+
+func (c Client) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (WebhookDelivery, error) {
+	query := `
+	SELECT ` + webhookDeliveryColumns + `
+	FROM webhook_deliveries
+	WHERE id = ?
+	`
+	delivery, err := scanWebhookDelivery(c.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return WebhookDelivery{}, translateError(err)
+	}
+	return delivery, nil
+}
+
+// GetWebhookDeliveries returns a webhook's most recent deliveries, newest
+// first.
+func (c Client) GetWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]WebhookDelivery, error) {
+	query := `
+	SELECT ` + webhookDeliveryColumns + `
+	FROM webhook_deliveries
+	WHERE webhook_id = ?
+	ORDER BY created_at DESC, id
+	LIMIT ?
+	`
+	return c.queryWebhookDeliveries(ctx, query, webhookID, limit)
+}
+
+// ClaimDueWebhookDeliveries returns up to limit pending deliveries whose
+// next attempt is due, oldest first, and leases them by putting their next
+// attempt off until lease from now. A claimed delivery isn't due any more,
+// so instances that claim at the same time get different deliveries. If the
+// claimer never records the attempt, the delivery is due again once the
+// lease runs out.
+func (c Client) ClaimDueWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	// The outer WHERE repeats the check, so a row another claim updated
+	// after the subquery picked it is skipped rather than claimed twice.
+	query := `
+	UPDATE webhook_deliveries
+	SET next_attempt_at = ?
+	WHERE id IN (
+		SELECT id
+		FROM webhook_deliveries
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at
+		LIMIT ?
+	)
+		AND status = ? AND next_attempt_at <= ?
+	RETURNING ` + webhookDeliveryColumns
+	at := time.Now().UTC()
+	deliveries, err := c.queryWebhookDeliveries(ctx, query, at.Add(lease), WebhookDeliveryPending, at, limit, WebhookDeliveryPending, at)
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING has no order, and every claimed row now has the same next
+	// attempt, so order by age instead.
+	slices.SortFunc(deliveries, func(a, b WebhookDelivery) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return deliveries, nil
+}
+
+func (c Client) queryWebhookDeliveries(ctx context.Context, query string, args ...any) ([]WebhookDelivery, error) {
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// CompleteWebhookDelivery records a successful attempt.
+func (c Client) CompleteWebhookDelivery(ctx context.Context, id uuid.UUID, statusCode int) error {
+	query := `
+	UPDATE webhook_deliveries
+	SET
+		status = ?,
+		attempts = attempts + 1,
+		last_status_code = ?,
+		last_error = NULL,
+		next_attempt_at = NULL,
+		delivered_at = ?
+	WHERE id = ?
+	`
+	res, err := c.db.ExecContext(ctx, query, WebhookDeliverySucceeded, statusCode, now(), id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// RetryWebhookDelivery records a failed attempt and schedules the next one.
+// A nil nextAttemptAt gives up and marks the delivery failed. statusCode is
+// nil if the endpoint couldn't be reached.
+func (c Client) RetryWebhookDelivery(ctx context.Context, id uuid.UUID, statusCode *int, lastError string, nextAttemptAt *time.Time) error {
+	query := `
+	UPDATE webhook_deliveries
+	SET
+		status = ?,
+		attempts = attempts + 1,
+		last_status_code = ?,
+		last_error = ?,
+		next_attempt_at = ?
+	WHERE id = ?
+	`
+	status := WebhookDeliveryPending
+	if nextAttemptAt == nil {
+		status = WebhookDeliveryFailed
+	} else {
+		t := nextAttemptAt.UTC()
+		nextAttemptAt = &t
+	}
+	res, err := c.db.ExecContext(ctx, query, status, statusCode, lastError, nextAttemptAt, id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// ReplayWebhookDelivery queues a new delivery of the same event to the same
+// webhook, leaving the original in the log as it was.
+func (c Client) ReplayWebhookDelivery(ctx context.Context, id uuid.UUID) (WebhookDelivery, error) {
+	query := `
+	INSERT INTO webhook_deliveries (id, created_at, webhook_id, event_type, payload, status, next_attempt_at)
+	SELECT ?, ?, webhook_id, event_type, payload, ?, ?
+	FROM webhook_deliveries
+	WHERE id = ?
+	`
+	replayID := uuid.New()
+	createdAt := now()
+	var replay WebhookDelivery
+	err := c.inTx(ctx, func(tx Client) error {
+		res, err := tx.db.ExecContext(ctx, query, replayID, createdAt, WebhookDeliveryPending, createdAt, id)
+		if err != nil {
+			return translateError(err)
+		}
+		if err := requireAffected(res); err != nil {
+			return err
+		}
+		replay, err = tx.GetWebhookDelivery(ctx, replayID)
+		return err
+	})
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	return replay, nil
+}
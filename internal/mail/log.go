@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+// LogMailer writes messages to a writer instead of sending them, for local
+// development, and keeps them so tests can read what was sent.
+type LogMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	sent []Message
+}
+
+// NewLogMailer returns a LogMailer that writes to w, such as os.Stdout or a
+// file.
+func NewLogMailer(w io.Writer) *LogMailer {
+	return &LogMailer{w: w}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, msg)
+	_, err := fmt.Fprintf(m.w, "To: %s\nSubject: %s\n\n%s\n----\n", msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+// Sent returns every message sent so far, oldest first.
+func (m *LogMailer) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.sent)
+}
@@ -0,0 +1,117 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPMailer sends messages through an SMTP server. It upgrades the
+// connection with STARTTLS when the server offers it, or uses TLS from the
+// start on port 465.
+type SMTPMailer struct {
+	host string
+	addr string
+	auth smtp.Auth
+	from *netmail.Address
+}
+
+// NewSMTPMailer returns a Mailer for the server at host:port. username may
+// be empty for servers that don't need authentication. from is the sender,
+// such as "Tubely <no-reply@example.com>".
+func NewSMTPMailer(host string, port int, username, password, from string) (*SMTPMailer, error) {
+	fromAddr, err := netmail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", from, err)
+	}
+	m := &SMTPMailer{
+		host: host,
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		from: fromAddr,
+	}
+	if username != "" {
+		// PlainAuth refuses to send the password over an unencrypted
+		// connection to anything but localhost.
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := msg.format(m.from, time.Now())
+	if err != nil {
+		return err
+	}
+	to, err := netmail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	client, err := m.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't connect to %s: %w", m.addr, err)
+	}
+	defer client.Close()
+
+	if m.auth != nil {
+		if err := client.Auth(m.auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(m.from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (m *SMTPMailer) dial(ctx context.Context) (*smtp.Client, error) {
+	tlsConfig := &tls.Config{ServerName: m.host}
+	var conn net.Conn
+	var err error
+	if _, port, _ := net.SplitHostPort(m.addr); port == "465" {
+		dialer := &tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", m.addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", m.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// net/smtp doesn't take a context, so the deadline bounds the whole
+	// conversation instead.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
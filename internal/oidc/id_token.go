@@ -0,0 +1,240 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// idTokenLeeway is how far the provider's clock may disagree with ours.
+	idTokenLeeway = time.Minute
+	// keysMaxAge is how long signing keys are cached before being fetched
+	// again, and keysMinRefresh how soon an unknown kid may fetch them
+	// again, so bad tokens can't make us hammer the provider.
+	keysMaxAge     = time.Hour
+	keysMinRefresh = time.Minute
+)
+
+// idTokenAlgs are the signing algorithms an ID token may use. "none" and
+// HMAC, which would be keyed with our own client secret, are left out.
+var idTokenAlgs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// IDToken is what a verified ID token says about the user.
+type IDToken struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce           string       `json:"nonce"`
+	AuthorizedParty string       `json:"azp"`
+	Email           string       `json:"email"`
+	EmailVerified   flexibleBool `json:"email_verified"`
+	Name            string       `json:"name"`
+}
+
+// flexibleBool also accepts "true" and "false" as strings, which some
+// providers send for email_verified.
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*b = flexibleBool(v)
+	case string:
+		*b = v == "true"
+	default:
+		*b = false
+	}
+	return nil
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, raw, nonce string) (IDToken, error) {
+	claims := idTokenClaims{}
+	_, err := jwt.ParseWithClaims(
+		raw,
+		&claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.signingKey(ctx, kid)
+		},
+		jwt.WithValidMethods(idTokenAlgs),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithLeeway(idTokenLeeway),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return IDToken{}, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if claims.ExpiresAt == nil {
+		return IDToken{}, errors.New("invalid ID token: no expiration time")
+	}
+	if claims.Subject == "" {
+		return IDToken{}, errors.New("invalid ID token: no subject")
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return IDToken{}, errors.New("invalid ID token: nonce doesn't match")
+	}
+	// A token for several audiences must name us as the party it was
+	// issued to.
+	if (len(claims.Audience) > 1 || claims.AuthorizedParty != "") && claims.AuthorizedParty != p.config.ClientID {
+		return IDToken{}, fmt.Errorf("invalid ID token: issued to %q", claims.AuthorizedParty)
+	}
+
+	return IDToken{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+// signingKey returns the provider's key with ID kid, fetching the
+// provider's keys again if it is new. A token without a kid can use the
+// only key, if there is one.
+func (p *Provider) signingKey(ctx context.Context, kid string) (any, error) {
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stale := time.Since(p.keysFetchedAt) > keysMaxAge
+	_, known := p.keys[kid]
+	if stale || (!known && time.Since(p.keysFetchedAt) > keysMinRefresh) {
+		var set jsonWebKeySet
+		if err := p.getJSON(ctx, doc.JWKSURI, &set); err != nil {
+			return nil, fmt.Errorf("couldn't fetch signing keys: %w", err)
+		}
+		p.keys = set.publicKeys()
+		p.keysFetchedAt = time.Now()
+	}
+
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, nil
+		}
+	}
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	Curve   string `json:"crv"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// publicKeys returns the set's signing keys by ID, skipping keys for
+// encryption and of types we don't know.
+func (set jsonWebKeySet) publicKeys() map[string]any {
+	keys := map[string]any{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+	return keys
+}
+
+func (jwk jsonWebKey) publicKey() (any, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA exponent is too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[jwk.Curve]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("Ed25519 key has the wrong size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.KeyType)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
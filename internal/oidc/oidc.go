@@ -0,0 +1,229 @@
+// Package oidc logs users in with an OpenID Connect provider, using the
+// authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultScopes are requested unless a provider is configured with others.
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// Config describes a provider registered with our client.
+type Config struct {
+	// Name identifies the provider in our URLs, such as "company".
+	Name string
+	// Issuer is the provider's issuer URL. Its discovery document is at
+	// Issuer + "/.well-known/openid-configuration".
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// Provider talks to one OpenID Connect provider. It fetches the provider's
+// discovery document and signing keys when they are first needed, and
+// caches them. It is safe for concurrent use.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *discovery
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+// NewProvider returns a Provider that makes its requests with client.
+func NewProvider(config Config, client *http.Client) *Provider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = DefaultScopes
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	return &Provider{config: config, client: client}
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+type discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+func (p *Provider) getDiscovery(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var doc discovery
+	if err := p.getJSON(ctx, p.config.Issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("couldn't fetch discovery document: %w", err)
+	}
+	// The issuer must match exactly, or a document could claim tokens for
+	// another provider.
+	if strings.TrimSuffix(doc.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q, not %q", doc.Issuer, p.config.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing an endpoint")
+	}
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+// AuthRequest is what one login attempt must remember between sending the
+// user to the provider and handling the callback.
+type AuthRequest struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// NewAuthRequest returns an AuthRequest with fresh random values.
+func NewAuthRequest() (AuthRequest, error) {
+	var req AuthRequest
+	for _, v := range []*string{&req.State, &req.Nonce, &req.CodeVerifier} {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return AuthRequest{}, err
+		}
+		*v = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return req, nil
+}
+
+// codeChallenge is the S256 PKCE challenge for the request's verifier.
+func (req AuthRequest) codeChallenge() string {
+	sum := sha256.Sum256([]byte(req.CodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns where to send the user to log in. The provider sends
+// them back to redirectURI with a code for Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, redirectURI string, req AuthRequest) (string, error) {
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(doc.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.config.ClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("scope", strings.Join(p.config.Scopes, " "))
+	q.Set("state", req.State)
+	q.Set("nonce", req.Nonce)
+	q.Set("code_challenge", req.codeChallenge())
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange trades the code from the callback for an ID token, and returns
+// the token's claims once it is verified. req must be the AuthRequest the
+// login started with.
+func (p *Provider) Exchange(ctx context.Context, redirectURI, code string, req AuthRequest) (IDToken, error) {
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return IDToken{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {req.CodeVerifier},
+	}
+	useBasicAuth := p.config.ClientSecret != "" && p.supportsBasicAuth(doc)
+	if !useBasicAuth {
+		form.Set("client_id", p.config.ClientID)
+		if p.config.ClientSecret != "" {
+			form.Set("client_secret", p.config.ClientSecret)
+		}
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return IDToken{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Accept", "application/json")
+	if useBasicAuth {
+		// RFC 6749 section 2.3.1 has the credentials form-encoded first.
+		httpReq.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	res, err := p.client.Do(httpReq)
+	if err != nil {
+		return IDToken{}, fmt.Errorf("couldn't reach token endpoint: %w", err)
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&body); err != nil {
+		return IDToken{}, fmt.Errorf("couldn't decode token response (status %d): %w", res.StatusCode, err)
+	}
+	if res.StatusCode != http.StatusOK || body.Error != "" {
+		return IDToken{}, fmt.Errorf("token endpoint refused the code (status %d): %s %s", res.StatusCode, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return IDToken{}, errors.New("token response has no id_token")
+	}
+	return p.verifyIDToken(ctx, body.IDToken, req.Nonce)
+}
+
+// supportsBasicAuth reports whether the token endpoint takes client
+// credentials in an Authorization header, the default in OIDC.
+func (p *Provider) supportsBasicAuth(doc *discovery) bool {
+	if len(doc.TokenAuthMethods) == 0 {
+		return true
+	}
+	for _, method := range doc.TokenAuthMethods {
+		if method == "client_secret_basic" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", url, res.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(v)
+}
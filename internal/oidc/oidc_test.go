@@ -0,0 +1,172 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/oidc"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const redirectURI = "https://tubely.example/api/oidc/test/callback"
+
+func newProvider(t *testing.T) (*oidctest.Provider, *oidc.Provider) {
+	t.Helper()
+	idp, err := oidctest.NewProvider()
+	if err != nil {
+		t.Fatalf("oidctest.NewProvider: %v", err)
+	}
+	t.Cleanup(idp.Close)
+	provider := oidc.NewProvider(oidc.Config{
+		Name:         "test",
+		Issuer:       idp.Issuer(),
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+	}, idp.Client())
+	return idp, provider
+}
+
+// authorize goes through the provider's login page with req, which the mock
+// approves at once, and returns the code it sends back.
+func authorize(t *testing.T, idp *oidctest.Provider, provider *oidc.Provider, req oidc.AuthRequest) string {
+	t.Helper()
+	authURL, err := provider.AuthCodeURL(context.Background(), redirectURI, req)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	client := *idp.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("GET %s: %v", authURL, err)
+	}
+	res.Body.Close()
+	callback, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || res.StatusCode != http.StatusFound || !strings.HasPrefix(callback.String(), redirectURI) {
+		t.Fatalf("login page responded %s, redirecting to %q", res.Status, res.Header.Get("Location"))
+	}
+	if got := callback.Query().Get("state"); got != req.State {
+		t.Fatalf("callback state = %q, want %q", got, req.State)
+	}
+	return callback.Query().Get("code")
+}
+
+// login logs in with a fresh request and returns the verified ID token.
+func login(t *testing.T, idp *oidctest.Provider, provider *oidc.Provider) (oidc.IDToken, error) {
+	t.Helper()
+	req := newAuthRequest(t)
+	return provider.Exchange(context.Background(), redirectURI, authorize(t, idp, provider, req), req)
+}
+
+func newAuthRequest(t *testing.T) oidc.AuthRequest {
+	t.Helper()
+	req, err := oidc.NewAuthRequest()
+	if err != nil {
+		t.Fatalf("NewAuthRequest: %v", err)
+	}
+	return req
+}
+
+func TestLogin(t *testing.T) {
+	idp, provider := newProvider(t)
+	idp.SetUser(oidctest.User{Subject: "user-7", Email: "seven@example.com", EmailVerified: true, Name: "Seven"})
+
+	idToken, err := login(t, idp, provider)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	want := oidc.IDToken{Issuer: idp.Issuer(), Subject: "user-7", Email: "seven@example.com", EmailVerified: true, Name: "Seven"}
+	if idToken != want {
+		t.Fatalf("ID token = %+v, want %+v", idToken, want)
+	}
+}
+
+func TestLoginEmailVerified(t *testing.T) {
+	idp, provider := newProvider(t)
+	for _, verified := range []any{false, "false", nil} {
+		idp.ModifyClaims(func(claims jwt.MapClaims) { claims["email_verified"] = verified })
+		idToken, err := login(t, idp, provider)
+		if err != nil {
+			t.Fatalf("login: %v", err)
+		}
+		if idToken.EmailVerified {
+			t.Errorf("email_verified %#v read as verified", verified)
+		}
+	}
+
+	idp.ModifyClaims(func(claims jwt.MapClaims) { claims["email_verified"] = "true" })
+	idToken, err := login(t, idp, provider)
+	if err != nil || !idToken.EmailVerified {
+		t.Fatalf(`email_verified "true" read as %+v, %v`, idToken, err)
+	}
+}
+
+func TestLoginRejectsBadIDTokens(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tests := []struct {
+		name   string
+		modify func(claims jwt.MapClaims)
+		forge  bool
+		want   string
+	}{
+		{name: "signed with another key", forge: true, want: "signature is invalid"},
+		{name: "wrong audience", modify: func(claims jwt.MapClaims) { claims["aud"] = "someone-else" }, want: "invalid audience"},
+		{name: "wrong issuer", modify: func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example" }, want: "invalid issuer"},
+		{name: "expired", modify: func(claims jwt.MapClaims) {
+			claims["iat"] = time.Now().Add(-2 * time.Hour).Unix()
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+		}, want: "expired"},
+		{name: "no expiry", modify: func(claims jwt.MapClaims) { delete(claims, "exp") }, want: "no expiration"},
+		{name: "issued in the future", modify: func(claims jwt.MapClaims) { claims["iat"] = time.Now().Add(time.Hour).Unix() }, want: "used before issued"},
+		{name: "wrong nonce", modify: func(claims jwt.MapClaims) { claims["nonce"] = "another-login" }, want: "nonce"},
+		{name: "no subject", modify: func(claims jwt.MapClaims) { delete(claims, "sub") }, want: "no subject"},
+		{name: "issued to another party", modify: func(claims jwt.MapClaims) {
+			claims["aud"] = []string{"tubely-test", "someone-else"}
+			claims["azp"] = "someone-else"
+		}, want: "issued to"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp, provider := newProvider(t)
+			idp.ModifyClaims(tt.modify)
+			if tt.forge {
+				idp.SignWith(otherKey)
+			}
+			idToken, err := login(t, idp, provider)
+			if err == nil {
+				t.Fatalf("login succeeded with %+v", idToken)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("login error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeNeedsTheCodeVerifier(t *testing.T) {
+	idp, provider := newProvider(t)
+	req := newAuthRequest(t)
+	code := authorize(t, idp, provider, req)
+
+	// Someone who intercepted the code doesn't have the verifier.
+	stolen := newAuthRequest(t)
+	stolen.Nonce = req.Nonce
+	if _, err := provider.Exchange(context.Background(), redirectURI, code, stolen); err == nil {
+		t.Fatal("Exchange succeeded without the code verifier")
+	}
+	// The failed attempt used the code up.
+	if _, err := provider.Exchange(context.Background(), redirectURI, code, req); err == nil {
+		t.Fatal("Exchange succeeded with a code that was already tried")
+	}
+}
@@ -0,0 +1,274 @@
+// Package oidctest provides a mock OpenID Connect provider for tests. It
+// serves discovery, authorization, token and key endpoints on a local
+// server, and approves every login as its configured user.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "oidctest"
+
+// User is who the provider logs everyone in as.
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is a running mock provider. It is safe for concurrent use.
+type Provider struct {
+	ClientID     string
+	ClientSecret string
+
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu           sync.Mutex
+	user         User
+	modifyClaims func(claims jwt.MapClaims)
+	signingKey   *rsa.PrivateKey
+	codes        map[string]authorization
+}
+
+// authorization is what a code was issued for.
+type authorization struct {
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// NewProvider starts a Provider with a fresh signing key. Close it when
+// done.
+func NewProvider() (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	p := &Provider{
+		ClientID:     "tubely-test",
+		ClientSecret: "tubely-test-secret",
+		key:          key,
+		user: User{
+			Subject:       "user-1",
+			Email:         "oidc-user@example.com",
+			EmailVerified: true,
+			Name:          "OIDC User",
+		},
+		codes: map[string]authorization{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc("GET /authorize", p.handleAuthorize)
+	mux.HandleFunc("POST /token", p.handleToken)
+	mux.HandleFunc("GET /jwks", p.handleJWKS)
+	p.server = httptest.NewServer(mux)
+	return p, nil
+}
+
+// Issuer is the provider's issuer URL.
+func (p *Provider) Issuer() string {
+	return p.server.URL
+}
+
+// Client returns an HTTP client that can reach the provider.
+func (p *Provider) Client() *http.Client {
+	return p.server.Client()
+}
+
+func (p *Provider) Close() {
+	p.server.Close()
+}
+
+// SetUser changes who later logins are for.
+func (p *Provider) SetUser(user User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = user
+}
+
+// ModifyClaims makes later ID tokens pass their claims through fn before
+// they are signed, to test how bad tokens are handled. nil stops it.
+func (p *Provider) ModifyClaims(fn func(claims jwt.MapClaims)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.modifyClaims = fn
+}
+
+// SignWith makes later ID tokens signed with key, under the ID of the key
+// the provider publishes, to test forged tokens. nil goes back to the
+// published key.
+func (p *Provider) SignWith(key *rsa.PrivateKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.signingKey = key
+}
+
+func (p *Provider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.Issuer(),
+		"authorization_endpoint":                p.Issuer() + "/authorize",
+		"token_endpoint":                        p.Issuer() + "/token",
+		"jwks_uri":                              p.Issuer() + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic"},
+	})
+}
+
+// handleAuthorize approves the login at once and sends the user back with
+// a code, as if they had signed in and consented.
+func (p *Provider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	switch {
+	case q.Get("client_id") != p.ClientID:
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	case q.Get("response_type") != "code":
+		http.Error(w, "response_type must be code", http.StatusBadRequest)
+		return
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		http.Error(w, "an S256 code_challenge is required", http.StatusBadRequest)
+		return
+	case !slices.Contains(strings.Fields(q.Get("scope")), "openid"):
+		http.Error(w, "scope must include openid", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = authorization{
+		redirectURI:   redirectURI.String(),
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+	}
+	p.mu.Unlock()
+
+	callback := redirectURI.Query()
+	callback.Set("code", code)
+	callback.Set("state", q.Get("state"))
+	redirectURI.RawQuery = callback.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (p *Provider) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != p.ClientID || clientSecret != p.ClientSecret {
+		writeTokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		writeTokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Codes work once.
+	code := r.PostFormValue("code")
+	auth, ok := p.codes[code]
+	delete(p.codes, code)
+	if !ok || auth.redirectURI != r.PostFormValue("redirect_uri") {
+		writeTokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != auth.codeChallenge {
+		writeTokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            p.Issuer(),
+		"sub":            p.user.Subject,
+		"aud":            p.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          auth.nonce,
+		"email":          p.user.Email,
+		"email_verified": p.user.EmailVerified,
+		"name":           p.user.Name,
+	}
+	if p.modifyClaims != nil {
+		p.modifyClaims(claims)
+	}
+	key := p.key
+	if p.signingKey != nil {
+		key = p.signingKey
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(key)
+	if err != nil {
+		writeTokenError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (p *Provider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	public := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+func writeTokenError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
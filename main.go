@@ -2,20 +2,28 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mail"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/oidc"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
-	db               database.Client
-	jwtSecret        string
+	db               database.Store
+	jwtKeys          *auth.Keyring
 	platform         string
 	filepathRoot     string
 	assetsRoot       string
@@ -24,6 +32,19 @@ type apiConfig struct {
 	s3CfDistribution string
 	port             string
 	s3Client         *s3.Client
+	importClient     *http.Client
+	webhookClient    *http.Client
+	// allowPrivateWebhooks lets webhooks be registered for private and
+	// loopback addresses.
+	allowPrivateWebhooks bool
+	mailer               mail.Mailer
+	// appBaseURL is where the web app is served, for links in emails.
+	appBaseURL string
+	// oidcProviders are the OpenID Connect providers users can log in
+	// with, by name.
+	oidcProviders map[string]*oidc.Provider
+	// playbackLimiter limits the playback events each address can send.
+	playbackLimiter *rateLimiter
 }
 
 func main() {
@@ -38,7 +59,24 @@ func main() {
 		log.Fatalf("Couldn't connect to database: %v", err)
 	}
 
-	jwtSecret := MustGetenv("JWT_SECRET")
+	tokenConfig := auth.TokenConfig{
+		Issuer:   GetenvDefault("JWT_ISSUER", auth.DefaultTokenConfig.Issuer),
+		Audience: GetenvDefault("JWT_AUDIENCE", auth.DefaultTokenConfig.Audience),
+		Lifetime: GetenvDuration("ACCESS_TOKEN_TTL", auth.DefaultTokenConfig.Lifetime),
+		Leeway:   GetenvDuration("JWT_LEEWAY", auth.DefaultTokenConfig.Leeway),
+	}
+	// JWT_KEYS_DIR holds the Ed25519 keys access tokens are signed with.
+	// Without it tokens are signed with JWT_SECRET, as they used to be; with
+	// it, JWT_SECRET only keeps those older tokens valid.
+	var jwtKeys *auth.Keyring
+	if keysDir := os.Getenv("JWT_KEYS_DIR"); keysDir != "" {
+		jwtKeys, err = auth.LoadKeyring(keysDir, os.Getenv("JWT_SIGNING_KEY_ID"), os.Getenv("JWT_SECRET"), tokenConfig)
+	} else {
+		jwtKeys, err = auth.NewHMACKeyring(MustGetenv("JWT_SECRET"), tokenConfig)
+	}
+	if err != nil {
+		log.Fatalf("Couldn't load JWT keys: %v", err)
+	}
 	platform := MustGetenv("PLATFORM")
 	filepathRoot := MustGetenv("FILEPATH_ROOT")
 	assetsRoot := MustGetenv("ASSETS_ROOT")
@@ -46,6 +84,20 @@ func main() {
 	s3Region := MustGetenv("S3_REGION")
 	s3CfDistribution := MustGetenv("S3_CF_DISTRO")
 	port := MustGetenv("PORT")
+	appBaseURL := strings.TrimSuffix(GetenvDefault("APP_BASE_URL", "http://localhost:"+port), "/")
+	// Only for development, where the hosts to import from are local.
+	allowPrivateImports := os.Getenv("IMPORT_ALLOW_PRIVATE_HOSTS") == "true"
+	allowPrivateWebhooks := os.Getenv("WEBHOOK_ALLOW_PRIVATE_HOSTS") == "true"
+
+	mailer, err := newMailer()
+	if err != nil {
+		log.Fatalf("Couldn't set up mail: %v", err)
+	}
+
+	oidcProviders, err := newOIDCProviders()
+	if err != nil {
+		log.Fatalf("Couldn't configure OIDC providers: %v", err)
+	}
 
 	awsCfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(s3Region))
 	if err != nil {
@@ -53,16 +105,23 @@ func main() {
 	}
 
 	cfg := apiConfig{
-		db:               db,
-		jwtSecret:        jwtSecret,
-		platform:         platform,
-		filepathRoot:     filepathRoot,
-		assetsRoot:       assetsRoot,
-		s3Bucket:         s3Bucket,
-		s3Region:         s3Region,
-		s3CfDistribution: s3CfDistribution,
-		port:             port,
-		s3Client:         s3.NewFromConfig(awsCfg),
+		db:                   db,
+		jwtKeys:              jwtKeys,
+		platform:             platform,
+		filepathRoot:         filepathRoot,
+		assetsRoot:           assetsRoot,
+		s3Bucket:             s3Bucket,
+		s3Region:             s3Region,
+		s3CfDistribution:     s3CfDistribution,
+		port:                 port,
+		s3Client:             s3.NewFromConfig(awsCfg),
+		importClient:         newImportClient(allowPrivateImports),
+		webhookClient:        newWebhookClient(allowPrivateWebhooks),
+		allowPrivateWebhooks: allowPrivateWebhooks,
+		mailer:               mailer,
+		appBaseURL:           appBaseURL,
+		oidcProviders:        oidcProviders,
+		playbackLimiter:      newRateLimiter(playbackEventsPerMinute, time.Minute),
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -70,6 +129,9 @@ func main() {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
 
+	go cfg.runStorageCleanup(context.Background())
+	go cfg.runWebhookDelivery(context.Background())
+
 	mux := http.NewServeMux()
 	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
 	mux.Handle("/app/", appHandler)
@@ -77,29 +139,137 @@ func main() {
 	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
 	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
 
+	cfg.registerRoutes(mux)
+
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: mux,
+	}
+
+	log.Printf("Serving on: http://localhost:%s/app/\n", port)
+	log.Fatal(srv.ListenAndServe())
+}
+
+// registerRoutes adds every API route to mux, declaring how each one is
+// authenticated and the scope it needs.
+func (cfg *apiConfig) registerRoutes(mux *http.ServeMux) {
+	api := newRouter(mux, cfg.jwtKeys, cfg.resolveAPIKey)
+
 	// Auth
-	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
-	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
-	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
+	api.public("GET /.well-known/jwks.json", cfg.handlerJWKS)
+	api.public("POST /api/login", cfg.handlerLogin)
+	api.public("POST /api/refresh", cfg.handlerRefresh)
+	api.public("POST /api/revoke", cfg.handlerRevoke)
+	api.public("GET /api/oidc/providers", cfg.handlerOIDCProviders)
+	api.public("GET /api/oidc/{provider}/login", cfg.handlerOIDCLogin)
+	api.public("GET /api/oidc/{provider}/callback", cfg.handlerOIDCCallback)
+	api.public("POST /api/oidc/token", cfg.handlerOIDCToken)
+	api.authenticated("GET /api/sessions", auth.ScopeAdmin, cfg.handlerSessionsList)
+	api.authenticated("DELETE /api/sessions", auth.ScopeAdmin, cfg.handlerSessionsRevokeOthers)
+	api.authenticated("DELETE /api/sessions/{sessionID}", auth.ScopeAdmin, cfg.handlerSessionRevoke)
+	api.authenticated("POST /api/api_keys", auth.ScopeAdmin, cfg.handlerAPIKeysCreate)
+	api.authenticated("GET /api/api_keys", auth.ScopeAdmin, cfg.handlerAPIKeysList)
+	api.authenticated("DELETE /api/api_keys/{keyID}", auth.ScopeAdmin, cfg.handlerAPIKeyDelete)
 
 	// Users
-	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	api.public("POST /api/users", cfg.handlerUsersCreate)
+	api.public("POST /api/verify_email", cfg.handlerVerifyEmail)
+	api.authenticated("POST /api/verify_email/resend", auth.ScopeAdmin, cfg.handlerVerifyEmailResend)
+	api.public("POST /api/password_reset", cfg.handlerPasswordResetRequest)
+	api.public("POST /api/password_reset/confirm", cfg.handlerPasswordResetConfirm)
 
 	// Videos
-	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
-	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
-	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
-	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
-	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
-	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
+	api.authenticated("POST /api/videos", auth.ScopeVideosWrite, cfg.handlerVideoMetaCreate)
+	api.authenticated("POST /api/thumbnail_upload/{videoID}", auth.ScopeVideosWrite, cfg.handlerUploadThumbnail)
+	api.authenticated("POST /api/video_upload/{videoID}", auth.ScopeVideosWrite, cfg.handlerUploadVideo)
+	api.authenticated("POST /api/videos/{videoID}/import", auth.ScopeVideosWrite, cfg.handlerVideoImport)
+	api.authenticated("GET /api/videos", auth.ScopeVideosRead, cfg.handlerVideosRetrieve)
+	api.authenticated("GET /api/videos/search", auth.ScopeVideosRead, cfg.handlerVideosSearch)
+	api.authenticated("GET /api/videos/shared", auth.ScopeVideosRead, cfg.handlerVideosShared)
+	api.optionalAuth("GET /api/videos/{videoID}", auth.ScopeVideosRead, cfg.handlerVideoGet)
+	api.authenticated("PATCH /api/videos/{videoID}", auth.ScopeVideosWrite, cfg.handlerVideoMetaUpdate)
+	api.authenticated("DELETE /api/videos/{videoID}", auth.ScopeVideosDelete, cfg.handlerVideoMetaDelete)
+	api.public("GET /api/public/videos", cfg.handlerPublicVideosRetrieve)
+	api.authenticated("GET /api/tags", auth.ScopeVideosRead, cfg.handlerTagsList)
+	api.authenticated("POST /api/videos/{videoID}/shares", auth.ScopeVideosWrite, cfg.handlerVideoSharesCreate)
+	api.authenticated("GET /api/videos/{videoID}/shares", auth.ScopeVideosRead, cfg.handlerVideoSharesList)
+	api.authenticated("DELETE /api/videos/{videoID}/shares/{shareID}", auth.ScopeVideosWrite, cfg.handlerVideoSharesRevoke)
+	api.public("GET /api/shares/{token}", cfg.handlerShareResolve)
+	api.authenticated("PUT /api/videos/{videoID}/collaborators", auth.ScopeVideosWrite, cfg.handlerVideoCollaboratorsSet)
+	api.authenticated("GET /api/videos/{videoID}/collaborators", auth.ScopeVideosRead, cfg.handlerVideoCollaboratorsList)
+	api.authenticated("DELETE /api/videos/{videoID}/collaborators/{userID}", auth.ScopeVideosWrite, cfg.handlerVideoCollaboratorsDelete)
+	api.optionalAuth("POST /api/videos/{videoID}/events", auth.ScopeVideosRead, cfg.handlerVideoEvents)
+	api.authenticated("GET /api/videos/{videoID}/analytics", auth.ScopeVideosRead, cfg.handlerVideoAnalytics)
 
-	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	// Playlists
+	api.authenticated("POST /api/playlists", auth.ScopeVideosWrite, cfg.handlerPlaylistsCreate)
+	api.authenticated("GET /api/playlists", auth.ScopeVideosRead, cfg.handlerPlaylistsList)
+	api.optionalAuth("GET /api/playlists/{playlistID}", auth.ScopeVideosRead, cfg.handlerPlaylistGet)
+	api.authenticated("PATCH /api/playlists/{playlistID}", auth.ScopeVideosWrite, cfg.handlerPlaylistUpdate)
+	api.authenticated("DELETE /api/playlists/{playlistID}", auth.ScopeVideosWrite, cfg.handlerPlaylistDelete)
+	api.authenticated("POST /api/playlists/{playlistID}/videos", auth.ScopeVideosWrite, cfg.handlerPlaylistVideosAdd)
+	api.authenticated("PUT /api/playlists/{playlistID}/videos", auth.ScopeVideosWrite, cfg.handlerPlaylistVideosReorder)
+	api.authenticated("DELETE /api/playlists/{playlistID}/videos/{videoID}", auth.ScopeVideosWrite, cfg.handlerPlaylistVideosRemove)
 
-	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+	// Webhooks
+	api.authenticated("POST /api/webhooks", auth.ScopeAdmin, cfg.handlerWebhooksCreate)
+	api.authenticated("GET /api/webhooks", auth.ScopeAdmin, cfg.handlerWebhooksList)
+	api.authenticated("DELETE /api/webhooks/{webhookID}", auth.ScopeAdmin, cfg.handlerWebhookDelete)
+	api.authenticated("GET /api/webhooks/{webhookID}/deliveries", auth.ScopeAdmin, cfg.handlerWebhookDeliveries)
+	api.authenticated("POST /api/webhooks/{webhookID}/deliveries/{deliveryID}/replay", auth.ScopeAdmin, cfg.handlerWebhookDeliveryReplay)
+
+	api.public("POST /admin/reset", cfg.handlerReset)
+}
+
+// newMailer sends mail through SMTP_HOST if it is set. Otherwise mail is
+// only written to MAIL_LOG_FILE, or to stdout, for local development.
+func newMailer() (mail.Mailer, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		logPath := os.Getenv("MAIL_LOG_FILE")
+		if logPath == "" {
+			return mail.NewLogMailer(os.Stdout), nil
+		}
+		f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		return mail.NewLogMailer(f), nil
 	}
 
-	log.Printf("Serving on: http://localhost:%s/app/\n", port)
-	log.Fatal(srv.ListenAndServe())
+	port, err := strconv.Atoi(GetenvDefault("SMTP_PORT", "587"))
+	if err != nil {
+		return nil, fmt.Errorf("SMTP_PORT must be a number: %w", err)
+	}
+	return mail.NewSMTPMailer(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), MustGetenv("MAIL_FROM"))
+}
+
+// oidcProviderName keeps provider names safe to use in URLs.
+var oidcProviderName = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// newOIDCProviders reads the OpenID Connect providers named in the
+// comma-separated OIDC_PROVIDERS. A provider named "my-idp" is configured
+// with OIDC_MY_IDP_ISSUER, OIDC_MY_IDP_CLIENT_ID, OIDC_MY_IDP_CLIENT_SECRET
+// and, optionally, a space-separated OIDC_MY_IDP_SCOPES.
+func newOIDCProviders() (map[string]*oidc.Provider, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	providers := map[string]*oidc.Provider{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !oidcProviderName.MatchString(name) {
+			return nil, fmt.Errorf("provider name %q must only use lowercase letters, digits and '-'", name)
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		providers[name] = oidc.NewProvider(oidc.Config{
+			Name:         name,
+			Issuer:       MustGetenv(prefix + "ISSUER"),
+			ClientID:     MustGetenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}, client)
+	}
+	return providers, nil
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter allows each key limit requests per window. It counts in fixed
+// windows, which is rough at window edges but cheap, and forgets keys once
+// their window has passed. Limits are per server instance.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu      sync.Mutex
+	windows map[string]rateWindow
+	swept   time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, windows: map[string]rateWindow{}}
+}
+
+// allow reports whether key may make another request at now, and counts it
+// if so.
+func (l *rateLimiter) allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.swept) >= l.window {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= l.window {
+				delete(l.windows, k)
+			}
+		}
+		l.swept = now
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = rateWindow{start: now}
+	}
+	if w.count >= l.limit {
+		return false
+	}
+	w.count++
+	l.windows[key] = w
+	return true
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+// router registers API routes. Every route is declared with the access it
+// needs, so one can't be added without deciding whether it is authenticated
+// and which scope it needs.
+type router struct {
+	mux  *http.ServeMux
+	auth *auth.Authenticator
+}
+
+func newRouter(mux *http.ServeMux, jwtKeys *auth.Keyring, apiKeys auth.APIKeyResolver) router {
+	return router{
+		mux:  mux,
+		auth: auth.NewAuthenticator(jwtKeys, apiKeys, respondWithAuthError),
+	}
+}
+
+// authenticated routes need a valid access token, or an API key with scope.
+// Handlers get the caller from auth.UserIDFromContext.
+func (rt router) authenticated(pattern string, scope auth.Scope, handler http.HandlerFunc) {
+	rt.mux.Handle(pattern, rt.auth.Required(scope, handler))
+}
+
+// optionalAuth routes also serve anonymous callers, for whom
+// auth.UserIDFromContext returns uuid.Nil. Credentials that are sent must be
+// valid and have scope.
+func (rt router) optionalAuth(pattern string, scope auth.Scope, handler http.HandlerFunc) {
+	rt.mux.Handle(pattern, rt.auth.Optional(scope, handler))
+}
+
+// public routes don't look at credentials at all. Some, like refresh, check
+// credentials of their own.
+func (rt router) public(pattern string, handler http.HandlerFunc) {
+	rt.mux.Handle(pattern, handler)
+}
+
+// authRealm names the protection space in WWW-Authenticate challenges.
+const authRealm = "tubely"
+
+// respondWithAuthError sends a WWW-Authenticate challenge as RFC 6750
+// describes, so clients can tell a token they should refresh from
+// credentials that will never work.
+func respondWithAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	var scopeErr *auth.ScopeError
+	switch {
+	case errors.Is(err, auth.ErrNoAuthHeaderIncluded):
+		setAuthChallenge(w, "Bearer", "", "", "")
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+	case errors.As(err, &scopeErr):
+		scheme := "Bearer"
+		if _, keyErr := auth.GetAPIKey(r.Header); keyErr == nil {
+			scheme = "ApiKey"
+		}
+		message := "Credentials don't have the scope this endpoint needs"
+		setAuthChallenge(w, scheme, "insufficient_scope", message, scopeErr.Scope)
+		respondWithError(w, http.StatusForbidden, message, err)
+	case errors.Is(err, auth.ErrInvalidAPIKey):
+		message := "Couldn't validate API key"
+		setAuthChallenge(w, "ApiKey", "invalid_token", message, "")
+		respondWithError(w, http.StatusUnauthorized, message, err)
+	default:
+		message := tokenErrorMessage(err)
+		setAuthChallenge(w, "Bearer", "invalid_token", message, "")
+		respondWithError(w, http.StatusUnauthorized, message, err)
+	}
+}
+
+func tokenErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrTokenExpired):
+		return "Access token expired"
+	case errors.Is(err, auth.ErrTokenNotYetValid):
+		return "Access token isn't valid yet"
+	case errors.Is(err, auth.ErrTokenSignatureInvalid):
+		return "Access token signature is invalid"
+	case errors.Is(err, auth.ErrTokenWrongIssuer):
+		return "Access token has the wrong issuer"
+	case errors.Is(err, auth.ErrTokenWrongAudience):
+		return "Access token is for a different audience"
+	default:
+		return "Couldn't validate JWT"
+	}
+}
+
+// setAuthChallenge sets the WWW-Authenticate header. code, description and
+// scope are left out when empty.
+func setAuthChallenge(w http.ResponseWriter, scheme, code, description string, scope auth.Scope) {
+	challenge := fmt.Sprintf("%s realm=%q", scheme, authRealm)
+	if code != "" {
+		challenge += fmt.Sprintf(", error=%q", code)
+	}
+	if description != "" {
+		challenge += fmt.Sprintf(", error_description=%q", description)
+	}
+	if scope != "" {
+		challenge += fmt.Sprintf(", scope=%q", scope)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+}
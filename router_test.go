@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAuthChallenges(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signup(t, "challenged@example.com")
+
+	// sign returns an access token for user whose claims have been changed
+	// by edit, signed like newTestAPI's keyring signs.
+	sign := func(secret string, edit func(jwt.MapClaims)) string {
+		now := time.Now()
+		claims := jwt.MapClaims{
+			"iss": auth.DefaultTokenConfig.Issuer,
+			"aud": []string{auth.DefaultTokenConfig.Audience},
+			"sub": user.ID.String(),
+			"iat": now.Unix(),
+			"exp": now.Add(time.Minute).Unix(),
+		}
+		edit(claims)
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		return token
+	}
+	invalid := func(description string) string {
+		return `Bearer realm="tubely", error="invalid_token", error_description="` + description + `"`
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		challenge string
+	}{
+		{
+			name:      "no credentials",
+			challenge: `Bearer realm="tubely"`,
+		},
+		{
+			name:      "expired",
+			token:     sign("test-secret", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }),
+			challenge: invalid("Access token expired"),
+		},
+		{
+			name:      "not valid yet",
+			token:     sign("test-secret", func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Hour).Unix() }),
+			challenge: invalid("Access token isn't valid yet"),
+		},
+		{
+			name:      "issued in the future",
+			token:     sign("test-secret", func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }),
+			challenge: invalid("Access token isn't valid yet"),
+		},
+		{
+			name:      "signed with another secret",
+			token:     sign("other-secret", func(jwt.MapClaims) {}),
+			challenge: invalid("Access token signature is invalid"),
+		},
+		{
+			name:      "wrong issuer",
+			token:     sign("test-secret", func(c jwt.MapClaims) { c["iss"] = "someone-else" }),
+			challenge: invalid("Access token has the wrong issuer"),
+		},
+		{
+			name:      "wrong audience",
+			token:     sign("test-secret", func(c jwt.MapClaims) { c["aud"] = []string{"another-api"} }),
+			challenge: invalid("Access token is for a different audience"),
+		},
+		{
+			name:      "malformed",
+			token:     "not-a-jwt",
+			challenge: invalid("Couldn't validate JWT"),
+		},
+		{
+			name:      "not a user ID",
+			token:     sign("test-secret", func(c jwt.MapClaims) { c["sub"] = "alice" }),
+			challenge: invalid("Couldn't validate JWT"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := api.expectStatus(t, http.StatusUnauthorized, "GET", "/api/videos", tt.token, nil, nil)
+			if got := res.Header.Get("WWW-Authenticate"); got != tt.challenge {
+				t.Fatalf("WWW-Authenticate = %s, want %s", got, tt.challenge)
+			}
+		})
+	}
+
+	// The token the same claims would have without the edits is fine.
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos", sign("test-secret", func(jwt.MapClaims) {}), nil, nil)
+}
+
+func TestRouteScopes(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signup(t, "scoped@example.com")
+	insufficient := func(scheme string, scope auth.Scope) string {
+		return scheme + ` realm="tubely", error="insufficient_scope", error_description="Credentials don't have the scope this endpoint needs", scope="` + string(scope) + `"`
+	}
+	video := map[string]string{"title": "Scoped", "description": "scopes"}
+
+	reader := api.createAPIKey(t, user.Token, auth.ScopeVideosRead)
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos", reader.Key, nil, nil)
+	res := api.expectStatus(t, http.StatusForbidden, "POST", "/api/videos", reader.Key, video, nil)
+	expectChallenge(t, res, insufficient("ApiKey", auth.ScopeVideosWrite))
+
+	// No API key can administer the account, including its keys.
+	writer := api.createAPIKey(t, user.Token, auth.APIKeyScopes...)
+	var created database.Video
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos", writer.Key, video, &created)
+	res = api.expectStatus(t, http.StatusForbidden, "POST", "/api/api_keys", writer.Key, map[string]any{"name": "ci", "scopes": []string{"videos:read"}}, nil)
+	expectChallenge(t, res, insufficient("ApiKey", auth.ScopeAdmin))
+
+	// Sharing, collaborators and playlists are part of managing videos, so
+	// keys that can write videos can manage them too.
+	var playlist database.Playlist
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/playlists", writer.Key, map[string]string{"title": "Scoped"}, &playlist)
+	api.expectStatus(t, http.StatusOK, "POST", "/api/playlists/"+playlist.ID.String()+"/videos", writer.Key, map[string]any{"video_id": created.ID}, nil)
+	api.expectStatus(t, http.StatusCreated, "POST", "/api/videos/"+created.ID.String()+"/shares", writer.Key, map[string]any{}, nil)
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos/"+created.ID.String()+"/shares", reader.Key, nil, nil)
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos/"+created.ID.String()+"/collaborators", reader.Key, nil, nil)
+	for _, route := range []struct{ method, path string }{
+		{"POST", "/api/playlists"},
+		{"PATCH", "/api/playlists/" + playlist.ID.String()},
+		{"DELETE", "/api/playlists/" + playlist.ID.String()},
+		{"POST", "/api/videos/" + created.ID.String() + "/shares"},
+		{"PUT", "/api/videos/" + created.ID.String() + "/collaborators"},
+	} {
+		res := api.expectStatus(t, http.StatusForbidden, route.method, route.path, reader.Key, map[string]any{}, nil)
+		expectChallenge(t, res, insufficient("ApiKey", auth.ScopeVideosWrite))
+	}
+
+	// A login that asks for fewer scopes gets, and keeps after refreshing,
+	// only those.
+	var login loginResponse
+	api.expectStatus(t, http.StatusOK, "POST", "/api/login", "", map[string]any{"email": "scoped@example.com", "password": testPassword, "scopes": []string{"videos:read"}}, &login)
+	res = api.expectStatus(t, http.StatusForbidden, "POST", "/api/videos", login.Token, video, nil)
+	expectChallenge(t, res, insufficient("Bearer", auth.ScopeVideosWrite))
+	var refreshed loginResponse
+	api.expectStatus(t, http.StatusOK, "POST", "/api/refresh", login.RefreshToken, nil, &refreshed)
+	api.expectStatus(t, http.StatusForbidden, "POST", "/api/videos", refreshed.Token, video, nil)
+	api.expectStatus(t, http.StatusOK, "GET", "/api/videos", refreshed.Token, nil, nil)
+
+	api.expectStatus(t, http.StatusBadRequest, "POST", "/api/login", "", map[string]any{"email": "scoped@example.com", "password": testPassword, "scopes": []string{"videos:everything"}}, nil)
+}
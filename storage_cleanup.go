@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	storageCleanupInterval   = 30 * time.Second
+	storageCleanupBatchSize  = 50
+	storageCleanupMaxBackoff = 6 * time.Hour
+)
+
+// enqueueVideoFileCleanup records the S3 object behind a stored video URL for deletion.
+func enqueueVideoFileCleanup(ctx context.Context, tx database.Store, videoURL *string) error {
+	if videoURL == nil {
+		return nil
+	}
+	bucket, key, err := parseVideoURL(*videoURL)
+	if err != nil {
+		return err
+	}
+	return tx.EnqueueStorageCleanup(ctx, database.CleanupKindS3, bucket, key)
+}
+
+// enqueueThumbnailCleanup records a thumbnail in the assets directory for deletion.
+func enqueueThumbnailCleanup(ctx context.Context, tx database.Store, thumbnailURL *string) error {
+	if thumbnailURL == nil {
+		return nil
+	}
+	_, name, found := strings.Cut(*thumbnailURL, "/assets/")
+	if !found || name == "" {
+		// Not one of ours, so there is nothing to delete.
+		return nil
+	}
+	return tx.EnqueueStorageCleanup(ctx, database.CleanupKindAsset, "", filepath.Base(name))
+}
+
+// runStorageCleanup deletes orphaned files from the cleanup outbox until ctx is done.
+func (cfg *apiConfig) runStorageCleanup(ctx context.Context) {
+	ticker := time.NewTicker(storageCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		cfg.processStorageCleanup(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) processStorageCleanup(ctx context.Context) {
+	items, err := cfg.db.GetDueStorageCleanup(ctx, storageCleanupBatchSize)
+	if err != nil {
+		log.Printf("Couldn't load storage cleanup queue: %v", err)
+		return
+	}
+
+	for _, item := range items {
+		if err := cfg.deleteStoredFile(ctx, item); err != nil {
+			backoff := min(time.Minute<<min(item.Attempts, 16), storageCleanupMaxBackoff)
+			log.Printf("Couldn't delete %s object %q (attempt %d): %v", item.Kind, item.Key, item.Attempts+1, err)
+			if err := cfg.db.RetryStorageCleanup(ctx, item.ID, err.Error(), time.Now().Add(backoff)); err != nil {
+				log.Printf("Couldn't reschedule storage cleanup %s: %v", item.ID, err)
+			}
+			continue
+		}
+		if err := cfg.db.CompleteStorageCleanup(ctx, item.ID); err != nil {
+			log.Printf("Couldn't complete storage cleanup %s: %v", item.ID, err)
+		}
+	}
+}
+
+func (cfg *apiConfig) deleteStoredFile(ctx context.Context, item database.StorageCleanup) error {
+	switch item.Kind {
+	case database.CleanupKindS3:
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		_, err := cfg.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(item.Bucket),
+			Key:    aws.String(item.Key),
+		})
+		return err
+	case database.CleanupKindAsset:
+		err := os.Remove(filepath.Join(cfg.assetsRoot, filepath.Base(item.Key)))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	default:
+		return fmt.Errorf("unknown storage cleanup kind %q", item.Kind)
+	}
+}
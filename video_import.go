@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	videoImportTimeout      = 30 * time.Minute
+	videoImportMaxRedirects = 5
+)
+
+var errNonPublicAddress = errors.New("address is not publicly routable")
+
+// nonPublicPrefixes are special-purpose ranges that netip doesn't already
+// classify as private, loopback, link-local or multicast.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+// isPublicAddr reports whether addr is safe to connect to for a user: a
+// global unicast address outside every private and special-purpose range.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// newPublicDialer returns the dialer for requests to URLs users give us.
+// Unless allowPrivate is set, it refuses to connect to anything but public
+// addresses. The check runs on every connection after DNS has resolved, so
+// redirects and hostnames that resolve to internal addresses can't get
+// around it.
+func newPublicDialer(allowPrivate bool) *net.Dialer {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddr(addr) {
+				return fmt.Errorf("%w: %s", errNonPublicAddress, addr)
+			}
+			return nil
+		}
+	}
+	return dialer
+}
+
+// newImportClient returns the HTTP client that fetches remote videos,
+// connecting only to public addresses unless allowPrivate is set.
+func newImportClient(allowPrivate bool) *http.Client {
+	dialer := newPublicDialer(allowPrivate)
+	return &http.Client{
+		Transport: &http.Transport{
+			// No proxy: it would hide the real destination from the
+			// address check.
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > videoImportMaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", videoImportMaxRedirects)
+			}
+			if err := validateImportURL(req.URL); err != nil {
+				return err
+			}
+			if via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme != "https" {
+				return errors.New("refusing to follow a redirect from https to http")
+			}
+			return nil
+		},
+	}
+}
+
+// validateImportURL checks that u is something imports may fetch. Where it
+// points is checked when connecting.
+func validateImportURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("url must be an http or https URL")
+	}
+	if u.Host == "" {
+		return errors.New("url must include a host")
+	}
+	if u.User != nil {
+		return errors.New("url can't include credentials")
+	}
+	return nil
+}
+
+// importVideo downloads a video file and stores it like an upload. It runs
+// in the background after handlerVideoImport has marked the video
+// processing, and leaves it ready or failed.
+func (cfg *apiConfig) importVideo(videoID uuid.UUID, rawURL string) {
+	ctx, cancel := context.WithTimeout(context.Background(), videoImportTimeout)
+	defer cancel()
+
+	path, err := cfg.downloadVideo(ctx, rawURL, uploadLimit)
+	if err != nil {
+		log.Printf("Couldn't import video %s from %s: %v", videoID, rawURL, err)
+		cfg.markVideoFailed(ctx, videoID)
+		return
+	}
+	defer os.Remove(path)
+
+	if _, err := cfg.markVideoUploaded(ctx, videoID); err != nil {
+		log.Printf("Couldn't update video %s after import: %v", videoID, err)
+		cfg.markVideoFailed(ctx, videoID)
+		return
+	}
+	if _, err := cfg.storeVideoFile(ctx, videoID, path); err != nil {
+		log.Printf("Couldn't store imported video %s: %v", videoID, err)
+	}
+}
+
+// downloadVideo fetches a remote video into a temp file and returns its path;
+// the caller removes it. It applies the same checks as uploads: at most
+// limit bytes, and the content must sniff as MP4 whatever the server says it
+// is.
+func (cfg *apiConfig) downloadVideo(ctx context.Context, rawURL string, limit int64) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "Tubely-Import/1.0")
+
+	res, err := cfg.importClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("remote responded %s", res.Status)
+	}
+	if res.ContentLength > limit {
+		return "", fmt.Errorf("remote file is %d bytes, over the %d byte limit", res.ContentLength, limit)
+	}
+	body := io.LimitReader(res.Body, limit+1)
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(body, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	if mediaType := http.DetectContentType(buf[:n]); mediaType != "video/mp4" {
+		return "", fmt.Errorf("remote file is %s, not MP4", mediaType)
+	}
+
+	file, err := os.CreateTemp("", tempFileName)
+	if err != nil {
+		return "", err
+	}
+	written, err := io.Copy(file, io.MultiReader(bytes.NewReader(buf[:n]), body))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written > limit {
+		err = fmt.Errorf("remote file is over the %d byte limit", limit)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
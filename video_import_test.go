@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testImportLimit = 64 << 10
+
+// fakeMP4 returns size bytes that sniff as MP4: an ftyp box, then zeros.
+func fakeMP4(size int) []byte {
+	data := make([]byte, size)
+	copy(data, "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom")
+	return data
+}
+
+// downloadFrom serves handler locally and downloads its root with a client
+// that may connect to it. It checks no temp file is left behind on failure.
+func downloadFrom(t *testing.T, handler http.Handler) (string, error) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	cfg := &apiConfig{importClient: newImportClient(true)}
+	path, err := cfg.downloadVideo(context.Background(), server.URL+"/", testImportLimit)
+	if err != nil {
+		if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+			t.Errorf("download failed but left %d temp files", len(entries))
+		}
+	}
+	return path, err
+}
+
+func TestDownloadVideo(t *testing.T) {
+	video := fakeMP4(testImportLimit)
+	path, err := downloadFrom(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(video)
+	}))
+	if err != nil {
+		t.Fatalf("downloadVideo: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading download: %v", err)
+	}
+	if !bytes.Equal(got, video) {
+		t.Fatalf("downloaded %d bytes, want the %d served", len(got), len(video))
+	}
+}
+
+func TestDownloadVideoSizeLimit(t *testing.T) {
+	t.Run("Content-Length over the limit", func(t *testing.T) {
+		// The header claims more than the limit while the body is small,
+		// so only the header can have stopped the download.
+		_, err := downloadFrom(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", strconv.Itoa(testImportLimit+1))
+			w.Write(fakeMP4(1024))
+		}))
+		if err == nil || !strings.Contains(err.Error(), "over the") {
+			t.Fatalf("downloadVideo error = %v, want it over the limit", err)
+		}
+	})
+
+	t.Run("streamed past the limit", func(t *testing.T) {
+		// No Content-Length: the body is chunked and simply keeps going.
+		_, err := downloadFrom(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(fakeMP4(4096))
+			for sent := 4096; sent <= 2*testImportLimit; sent += 4096 {
+				w.Write(make([]byte, 4096))
+				w.(http.Flusher).Flush()
+			}
+		}))
+		if err == nil || !strings.Contains(err.Error(), "over the") {
+			t.Fatalf("downloadVideo error = %v, want it over the limit", err)
+		}
+	})
+}
+
+func TestDownloadVideoSniffsContent(t *testing.T) {
+	// The server says it's a video; the body says otherwise.
+	_, err := downloadFrom(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write([]byte("<!DOCTYPE html><html><body>not a video</body></html>"))
+	}))
+	if err == nil || !strings.Contains(err.Error(), "not MP4") {
+		t.Fatalf("downloadVideo error = %v, want the body rejected as not MP4", err)
+	}
+}
+
+func TestDownloadVideoRedirects(t *testing.T) {
+	// /N redirects to /N-1 and /0 serves the video.
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if n == 0 {
+			w.Write(fakeMP4(1024))
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/%d", n-1), http.StatusFound)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	cfg := &apiConfig{importClient: newImportClient(true)}
+
+	path, err := cfg.downloadVideo(context.Background(), fmt.Sprintf("%s/%d", server.URL, videoImportMaxRedirects), testImportLimit)
+	if err != nil {
+		t.Fatalf("downloadVideo with %d redirects: %v", videoImportMaxRedirects, err)
+	}
+	os.Remove(path)
+
+	_, err = cfg.downloadVideo(context.Background(), fmt.Sprintf("%s/%d", server.URL, videoImportMaxRedirects+1), testImportLimit)
+	if err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Fatalf("downloadVideo with %d redirects: error = %v, want it stopped", videoImportMaxRedirects+1, err)
+	}
+}
+
+func TestDownloadVideoBlocksPrivateAddresses(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(fakeMP4(1024))
+	}))
+	defer server.Close()
+
+	// The server listens on 127.0.0.1, which the production client must
+	// refuse to connect to.
+	cfg := &apiConfig{importClient: newImportClient(false)}
+	_, err := cfg.downloadVideo(context.Background(), server.URL+"/", testImportLimit)
+	if !errors.Is(err, errNonPublicAddress) {
+		t.Fatalf("downloadVideo error = %v, want %v", err, errNonPublicAddress)
+	}
+	if requests != 0 {
+		t.Fatalf("server got %d requests, want none", requests)
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:2800:21f:cb07:6820:80da:af6b:8b2c", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"fc00::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
@@ -55,6 +56,22 @@ func GetVideoAspectRatio(filePath string) (string, error) {
 	}
 }
 
+// GetVideoDuration returns the duration of a video file in seconds by calling ffprobe
+func GetVideoDuration(filePath string) (float64, error) {
+	var buf bytes.Buffer
+	cmd := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", filePath)
+	cmd.Stdout = &buf
+	if err := cmd.Run(); err != nil {
+		return 0, err
+	}
+
+	duration, err := strconv.ParseFloat(strings.TrimSpace(buf.String()), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration: %w", err)
+	}
+	return duration, nil
+}
+
 // ProcessVideoForFastStart takes a video file and returns a new video file with fast start enabled.
 func ProcessVideoForFastStart(filePath string) (string, error) {
 	outPath := filePath + ".processing"
@@ -87,18 +104,35 @@ func GeneratePresignedURL(s3Client *s3.Client, bucket, key string, expireTime ti
 	return res.URL, nil
 }
 
+// parseVideoURL splits a stored "bucket,key" video URL into its parts.
+func parseVideoURL(videoURL string) (bucket, key string, err error) {
+	parts := strings.Split(videoURL, ",")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid video URL")
+	}
+	return parts[0], parts[1], nil
+}
+
+// presignedURLTTL is how long a signed video URL stays valid.
+const presignedURLTTL = 1 * time.Hour
+
 // DbVideoToSignedVideo takes a database video and returns a signed video URL.
+// Videos that have no file yet are returned unchanged.
 func (cfg *apiConfig) DbVideoToSignedVideo(video database.Video) (database.Video, error) {
+	return cfg.signVideo(video, presignedURLTTL)
+}
+
+// signVideo is DbVideoToSignedVideo with a caller-chosen URL lifetime.
+func (cfg *apiConfig) signVideo(video database.Video, ttl time.Duration) (database.Video, error) {
 	if video.VideoURL == nil {
-		return video, fmt.Errorf("video URL is nil")
+		return video, nil
 	}
-	parts := strings.Split(*video.VideoURL, ",")
-	if len(parts) != 2 {
-		return video, fmt.Errorf("invalid video URL")
+	bucket, key, err := parseVideoURL(*video.VideoURL)
+	if err != nil {
+		return video, err
 	}
-	bucket, key := parts[0], parts[1]
 
-	presignedURL, err := GeneratePresignedURL(cfg.s3Client, bucket, key, 1*time.Hour)
+	presignedURL, err := GeneratePresignedURL(cfg.s3Client, bucket, key, ttl)
 	if err != nil {
 		return video, err
 	}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Events a webhook can subscribe to.
+const (
+	webhookEventVideoCreated     = "video.created"
+	webhookEventVideoUpdated     = "video.updated"
+	webhookEventVideoUploaded    = "video.uploaded"
+	webhookEventVideoProcessed   = "video.processed"
+	webhookEventVideoFailed      = "video.failed"
+	webhookEventThumbnailUpdated = "thumbnail.updated"
+	webhookEventVideoDeleted     = "video.deleted"
+)
+
+var webhookEventTypes = []string{
+	webhookEventVideoCreated,
+	webhookEventVideoUpdated,
+	webhookEventVideoUploaded,
+	webhookEventVideoProcessed,
+	webhookEventVideoFailed,
+	webhookEventThumbnailUpdated,
+	webhookEventVideoDeleted,
+}
+
+const (
+	webhookDeliveryInterval   = 5 * time.Second
+	webhookDeliveryBatchSize  = 50
+	webhookDeliveryTimeout    = 10 * time.Second
+	webhookDeliveryMinBackoff = 30 * time.Second
+	webhookDeliveryMaxBackoff = 6 * time.Hour
+	// webhookDeliveryLease is how long a claimed batch stays hidden from
+	// other instances: long enough for every delivery in it to time out.
+	webhookDeliveryLease = webhookDeliveryBatchSize*webhookDeliveryTimeout + time.Minute
+	// webhookMaxAttempts spans about 15 hours of retries before a delivery
+	// is marked failed; it can still be replayed after that.
+	webhookMaxAttempts = 12
+
+	webhookSignatureHeader = "X-Webhook-Signature"
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// errWebhookUnreachable is what the delivery log records when no response
+// came back. The underlying error is only logged, since it can reveal
+// things about our network to whoever registered the URL.
+var errWebhookUnreachable = errors.New("couldn't connect to the endpoint")
+
+// newWebhookClient returns the HTTP client that sends deliveries. Like the
+// import client, it only connects to public addresses unless allowPrivate
+// is set.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := newPublicDialer(allowPrivate)
+	return &http.Client{
+		Timeout: webhookDeliveryTimeout,
+		Transport: &http.Transport{
+			// No proxy: it would hide the real destination from the
+			// address check.
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		// A redirect would resend the signed payload somewhere the user
+		// never registered, so it counts as a failed attempt instead.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// webhookEvent is the body of every delivery. ID identifies the event, so a
+// receiver can ignore retries and replays it has already handled.
+type webhookEvent struct {
+	ID        uuid.UUID      `json:"id"`
+	Type      string         `json:"type"`
+	CreatedAt time.Time      `json:"created_at"`
+	Data      database.Video `json:"data"`
+}
+
+// enqueueVideoEvent queues eventType for the video owner's webhooks. Call it
+// in the transaction that makes the change, so the event is only sent if the
+// change commits.
+func enqueueVideoEvent(ctx context.Context, tx database.Store, eventType string, video database.Video) error {
+	// The stored URL is a bucket and key, not something a receiver can use;
+	// they fetch the video through the API for a signed URL instead.
+	video.VideoURL = nil
+	payload, err := json.Marshal(webhookEvent{
+		ID:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      video,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.EnqueueWebhookEvent(ctx, video.UserID, eventType, payload)
+}
+
+// signWebhookPayload returns the signature header for a delivery body:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">". Signing the
+// timestamp lets receivers reject old deliveries being replayed at them.
+func signWebhookPayload(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// runWebhookDelivery sends due webhook deliveries until ctx is done.
+func (cfg *apiConfig) runWebhookDelivery(ctx context.Context) {
+	ticker := time.NewTicker(webhookDeliveryInterval)
+	defer ticker.Stop()
+
+	for {
+		cfg.processWebhookDeliveries(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processWebhookDeliveries claims a batch of due deliveries and attempts
+// each once. Claiming leases the batch, so any number of instances can run
+// it side by side without sending a delivery twice.
+func (cfg *apiConfig) processWebhookDeliveries(ctx context.Context) {
+	deliveries, err := cfg.db.ClaimDueWebhookDeliveries(ctx, webhookDeliveryBatchSize, webhookDeliveryLease)
+	if err != nil {
+		log.Printf("Couldn't load webhook deliveries: %v", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		cfg.deliverWebhook(ctx, delivery)
+	}
+}
+
+// deliverWebhook makes one attempt at a claimed delivery and records how it
+// went, scheduling a retry or giving up if it failed.
+func (cfg *apiConfig) deliverWebhook(ctx context.Context, delivery database.WebhookDelivery) {
+	webhook, err := cfg.db.GetWebhook(ctx, delivery.WebhookID)
+	if errors.Is(err, database.ErrNotFound) {
+		// Deleted since the batch was loaded; its deliveries went with it.
+		return
+	}
+	if err != nil {
+		log.Printf("Couldn't load webhook %s: %v", delivery.WebhookID, err)
+		return
+	}
+
+	statusCode, err := sendWebhook(ctx, cfg.webhookClient, webhook, delivery)
+	if err != nil {
+		var nextAttemptAt *time.Time
+		if delivery.Attempts+1 < webhookMaxAttempts {
+			next := time.Now().Add(webhookBackoff(delivery.Attempts))
+			nextAttemptAt = &next
+		}
+		log.Printf("Couldn't deliver %s to webhook %s (attempt %d): %v", delivery.EventType, webhook.ID, delivery.Attempts+1, err)
+		if statusCode == nil {
+			err = errWebhookUnreachable
+		}
+		if err := cfg.db.RetryWebhookDelivery(ctx, delivery.ID, statusCode, err.Error(), nextAttemptAt); err != nil {
+			log.Printf("Couldn't reschedule webhook delivery %s: %v", delivery.ID, err)
+		}
+		return
+	}
+	if err := cfg.db.CompleteWebhookDelivery(ctx, delivery.ID, *statusCode); err != nil {
+		log.Printf("Couldn't complete webhook delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// webhookBackoff is how long to wait before retrying a delivery that has
+// failed attempts+1 times: it doubles from webhookDeliveryMinBackoff up to
+// webhookDeliveryMaxBackoff.
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookDeliveryMinBackoff
+	for range attempts {
+		if backoff >= webhookDeliveryMaxBackoff {
+			break
+		}
+		backoff *= 2
+	}
+	return min(backoff, webhookDeliveryMaxBackoff)
+}
+
+// sendWebhook makes one delivery attempt. Only a 2xx response counts as
+// delivered. The status code is nil if no response was received.
+func sendWebhook(ctx context.Context, client *http.Client, webhook database.Webhook, delivery database.WebhookDelivery) (*int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Tubely-Webhooks/1.0")
+	req.Header.Set(webhookEventHeader, delivery.EventType)
+	req.Header.Set(webhookDeliveryHeader, delivery.ID.String())
+	req.Header.Set(webhookSignatureHeader, signWebhookPayload(webhook.Secret, time.Now(), delivery.Payload))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	// Drain a little of the body so the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 4<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &res.StatusCode, fmt.Errorf("endpoint responded %s", res.Status)
+	}
+	return &res.StatusCode, nil
+}